@@ -15,9 +15,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/agents": {
-            "get": {
-                "description": "Retrieve a list of agents based on optional query parameters",
+        "/admin/agents/{agent_id}": {
+            "delete": {
+                "description": "Permanently delete an agent, whether it is soft deleted or not",
                 "consumes": [
                     "application/json"
                 ],
@@ -25,46 +25,78 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "agents"
+                    "admin"
                 ],
-                "summary": "Get a list of agents",
+                "summary": "Purge an agent",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Page number for pagination (default is 1)",
-                        "name": "page",
-                        "in": "query"
+                        "description": "ID of the agent to purge",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully purged agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DeleteAgentResponse"
+                        }
                     },
-                    {
-                        "type": "integer",
-                        "description": "Number of agents per page (default is 10)",
-                        "name": "page_size",
-                        "in": "query"
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     },
-                    {
-                        "type": "string",
-                        "description": "Filter agents by IP address",
-                        "name": "ip_address",
-                        "in": "query"
+                    "404": {
+                        "description": "Agent not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/api-keys": {
+            "get": {
+                "description": "List the API keys without their secrets, the revoked keys are excluded by default",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List API keys",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "Field to sort agents by (e.g., 'id')",
-                        "name": "sort_by",
+                        "description": "Owner of the keys",
+                        "name": "owner",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "Sorting order ('asc' or 'desc')",
-                        "name": "order",
+                        "type": "boolean",
+                        "description": "Include the revoked keys",
+                        "name": "include_revoked",
                         "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved agents",
+                        "description": "Successfully retrieved API keys",
                         "schema": {
-                            "$ref": "#/definitions/handlers.GetAgentsResponse"
+                            "$ref": "#/definitions/handlers.GetAPIKeysResponse"
                         }
                     },
                     "400": {
@@ -73,12 +105,6 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "No agents found",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.GetAgentsResponse"
-                        }
-                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -88,7 +114,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Create a new agent with the provided IP address and retrieve its details",
+                "description": "Create a new API key, the secret and the signing secret are only returned in this response.\nThe admin scope can only be granted to the keys of the default tenant.",
                 "consumes": [
                     "application/json"
                 ],
@@ -96,25 +122,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "agents"
+                    "admin"
                 ],
-                "summary": "Create a new agent",
+                "summary": "Create an API key",
                 "parameters": [
                     {
-                        "description": "Request body for creating a new agent",
+                        "description": "Request body for creating an API key",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.CreateAgentRequest"
+                            "$ref": "#/definitions/handlers.CreateAPIKeyRequest"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Successfully created agent",
+                        "description": "Successfully created API key",
                         "schema": {
-                            "$ref": "#/definitions/handlers.CreateAgentResponse"
+                            "$ref": "#/definitions/handlers.CreateAPIKeyResponse"
                         }
                     },
                     "400": {
@@ -132,9 +158,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/agents/{agent_id}": {
-            "get": {
-                "description": "Retrieve detailed information of a specific agent by ID",
+        "/admin/api-keys/{key_id}": {
+            "delete": {
+                "description": "Revoke an API key, other instances may accept it until their cache of the key expires",
                 "consumes": [
                     "application/json"
                 ],
@@ -142,23 +168,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "agents"
+                    "admin"
                 ],
-                "summary": "Get details of a specific agent",
+                "summary": "Revoke an API key",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "ID of the agent to retrieve",
-                        "name": "agent_id",
+                        "description": "ID of the API key to revoke",
+                        "name": "key_id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved agent details",
+                        "description": "Successfully revoked API key",
                         "schema": {
-                            "$ref": "#/definitions/handlers.AgentDetailedResponse"
+                            "$ref": "#/definitions/handlers.APIKeyResponse"
                         }
                     },
                     "400": {
@@ -168,7 +194,13 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Agent not found",
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
@@ -176,9 +208,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/ping": {
-            "get": {
-                "description": "Check if the health of system is ok or not",
+        "/admin/api-keys/{key_id}/limits": {
+            "put": {
+                "description": "Replace the rate limit and the quotas of an API key, null limits are the defaults and zero means unlimited",
                 "consumes": [
                     "application/json"
                 ],
@@ -186,104 +218,2523 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "ping"
+                    "admin"
+                ],
+                "summary": "Update the limits of an API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the API key",
+                        "name": "key_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Limits of the API key",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.APIKeyLimits"
+                        }
+                    }
                 ],
-                "summary": "Check health status",
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Successfully updated API key",
                         "schema": {
-                            "$ref": "#/definitions/handlers.PingResponse"
+                            "$ref": "#/definitions/handlers.APIKeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handlers.Agent": {
-            "type": "object",
-            "properties": {
-                "asn": {
-                    "type": "string"
-                },
-                "city": {
-                    "type": "string"
-                },
-                "country": {
-                    "type": "string"
-                },
-                "created_at": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "ip_address": {
-                    "type": "string"
-                },
-                "isp": {
-                    "type": "string"
-                },
-                "location": {
-                    "type": "string"
+        },
+        "/admin/api-keys/{key_id}/scopes": {
+            "put": {
+                "description": "Replace the scopes of an API key, the scopes are agents:read, agents:write, agents:delete, export and admin.\nThe admin scope can only be granted to the keys of the default tenant.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update the scopes of an API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the API key",
+                        "name": "key_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Scopes of the API key",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateAPIKeyScopesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully updated API key",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.APIKeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
                 }
             }
         },
-        "handlers.AgentDetailedResponse": {
-            "type": "object",
-            "properties": {
-                "agent": {
-                    "$ref": "#/definitions/handlers.Agent"
-                },
-                "message": {
-                    "type": "string"
+        "/admin/api-keys/{key_id}/signing": {
+            "put": {
+                "description": "Require the requests of an API key to be signed or rotate its signing secret, the new secret is only returned in this response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update the signing of an API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the API key",
+                        "name": "key_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Signing of the API key",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateAPIKeySigningRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully updated API key",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateAPIKeySigningResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
                 }
             }
         },
-        "handlers.AgentPagination": {
-            "type": "object",
-            "properties": {
+        "/admin/audit": {
+            "get": {
+                "description": "List the audited requests, i.e. the changes, the exports and the denied requests, newest first.\nThe next page starts after the last event of the page with the next cursor.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List audit events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the tenant of the client",
+                        "name": "tenant_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the client, e.g. api_key:1a2b3c4d",
+                        "name": "subject",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the prefix of an API key",
+                        "name": "key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the action, e.g. agent.delete",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the resource, e.g. agent",
+                        "name": "resource",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the ID of the resource",
+                        "name": "resource_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the outcome (succeeded, failed, denied)",
+                        "name": "outcome",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter the events by the ID of the request",
+                        "name": "request_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the page, from next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of events in the page, 100 by default and at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetAuditEventsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/tenants": {
+            "get": {
+                "description": "List the tenants with their settings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List tenants",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved tenants",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetTenantsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new tenant, its clients only see the agents of the tenant",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create a tenant",
+                "parameters": [
+                    {
+                        "description": "Request body for creating a tenant",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateTenantRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully created tenant",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TenantResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Tenant already exists",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/tenants/{tenant_id}": {
+            "get": {
+                "description": "Get a tenant with its settings",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get a tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the tenant",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved tenant",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TenantResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Tenant not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace the name and the settings of a tenant, null settings are the defaults",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update a tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the tenant",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Name and settings of the tenant",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateTenantRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully updated tenant",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TenantResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Tenant not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/usage": {
+            "get": {
+                "description": "Summarize the requests and the upstream lookups of the API keys by endpoint and response status",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get the usage of API keys",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Prefix of the API key, all keys by default",
+                        "name": "key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to the start of the month",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to now",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UsageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/usage/invoice": {
+            "get": {
+                "description": "Export the requests and the upstream lookups of the API keys in a month by endpoint, with a total row for each key",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get the usage invoice of a month",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Prefix of the API key, all keys by default",
+                        "name": "key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Month of the invoice (YYYY-MM), defaults to the current month",
+                        "name": "month",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file of the usage",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents": {
+            "get": {
+                "description": "Retrieve a list of agents based on optional query parameters",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Get a list of agents",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number for pagination (default is 1)",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of agents per page (default is 10, at most 100)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by IP address",
+                        "name": "ip_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by country codes",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by cities",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by regions",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by ASNs (e.g., 'AS3320')",
+                        "name": "asn",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by ISP containing this value",
+                        "name": "isp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Field to sort agents by ('id', 'created_at', 'country', 'asn' or 'city')",
+                        "name": "sort_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sorting order ('asc' or 'desc')",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include the soft deleted agents",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of keyset pagination, an empty cursor starts from the first page and page is ignored",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Counting method in keyset pagination ('exact', 'estimate' or 'none', default is 'estimate')",
+                        "name": "total",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Fields to count the matching agents by ('country', 'asn', 'isp', 'city' or 'region')",
+                        "name": "facets",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of the most frequent values of each facet (default is 10)",
+                        "name": "facets_limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved agents",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetAgentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.QueryErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No agents found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetAgentsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new agent with the provided IP address and retrieve its details.\nWith async, the agent is created as pending and the Location header points to the status of its\nenrichment job.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Create a new agent",
+                "parameters": [
+                    {
+                        "description": "Request body for creating a new agent",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAgentRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Create the agent as pending and gather its details in the background",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully created agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAgentResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "The agent has been created and its details will be gathered",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAgentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Soft delete all the agents matching the filters, use dry_run to preview the affected agents",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Delete agents by filter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter agents by IP address",
+                        "name": "ip_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by country codes",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by cities",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by regions",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by ASNs (e.g., 'AS3320')",
+                        "name": "asn",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by ISP containing this value",
+                        "name": "isp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only return the number and a sample of the matching agents",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Allow deleting with an empty filter",
+                        "name": "force",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully deleted agents",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkDeleteAgentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/export": {
+            "get": {
+                "description": "Stream all the agents matching the filters as a CSV or NDJSON file",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Export agents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Format of the file (csv, ndjson), default is csv",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by IP address",
+                        "name": "ip_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by country codes",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by cities",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by regions",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by ASNs (e.g., 'AS3320')",
+                        "name": "asn",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by ISP containing this value",
+                        "name": "isp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include the deleted agents",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The exported agents",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/import": {
+            "post": {
+                "description": "Create agents from the IP addresses in a CSV (ip_address column or the first one) or NDJSON ({\"ip_address\": ...} per line) body.\nExisting and repeated IP addresses are skipped. Use async to run big imports as a background job.\nThe jobs are kept in memory by the instance running them, so they can only be polled on it.",
+                "consumes": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Import agents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Format of the body (csv, ndjson), defaults to the content type",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Run the import as a background job",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The per-line report of the import",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ImportAgentsResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "The import job has been started",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ImportJobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request, or the body cannot be read from a line",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "The body is too large",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/import/{job_id}": {
+            "get": {
+                "description": "Get the status and, when it is finished, the report of an import job of the tenant of the client",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Get an import job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Import Job ID",
+                        "name": "job_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ImportJobResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Import job not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/self": {
+            "get": {
+                "description": "Gather the statistics and the classification of the IP address of the caller, e.g. for agents behind NAT.\nForwarding headers are only used for requests coming from the trusted proxies.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Look up the client IP address",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Name of the IP stats provider to use, default is the configured one",
+                        "name": "provider",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LookupIPResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Cannot gather statistics",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new agent with the IP address of the caller, e.g. for agents behind NAT.\nForwarding headers are only used for requests coming from the trusted proxies.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Create an agent for the client IP address",
+                "responses": {
+                    "201": {
+                        "description": "Successfully created agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAgentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Cannot gather statistics",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/{agent_id}": {
+            "get": {
+                "description": "Retrieve detailed information of a specific agent by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Get details of a specific agent",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the agent to retrieve",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved agent details",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AgentDetailedResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Agent not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Soft delete an agent, it is excluded from the lists and can be restored later",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Delete an agent",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the agent to delete",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully deleted agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DeleteAgentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Agent not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/{agent_id}/enrichment": {
+            "get": {
+                "description": "Get the status, the attempts and the last error of the background enrichment of an agent created with\nasync. Dead jobs have no attempts left and are kept for inspection.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Get the enrichment job of an agent",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the agent",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.EnrichmentJobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Enrichment job not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/{agent_id}/refresh": {
+            "post": {
+                "description": "Gather fresh statistics about the IP address of an agent, store them and return both old and new values",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Refresh the details of an agent",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the agent to refresh",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the provider to gather statistics from (e.g., 'ipinfo')",
+                        "name": "provider",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully refreshed agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RefreshAgentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Agent not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The agent is still being enriched",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Cannot gather statistics",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents/{agent_id}/restore": {
+            "post": {
+                "description": "Restore a soft deleted agent",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Restore an agent",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the agent to restore",
+                        "name": "agent_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully restored agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AgentDetailedResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Agent not found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/agents:batch": {
+            "post": {
+                "description": "Create agents for the IP addresses, each of them succeeds or fails separately.\nThe status of each result is the HTTP status code of creating it on its own, the repeated IP addresses are 409.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "agents"
+                ],
+                "summary": "Create multiple agents",
+                "parameters": [
+                    {
+                        "description": "Request body for creating multiple agents",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BatchCreateAgentsRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the IP stats provider to use, default is the configured one",
+                        "name": "provider",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "207": {
+                        "description": "The result of creating each agent",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BatchCreateAgentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ip/{ip}": {
+            "get": {
+                "description": "Gather the statistics and the classification of an IP address without creating an agent.\nThe statistics are not gathered for bogon IP addresses, e.g. private ones.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ip"
+                ],
+                "summary": "Look up an IP address",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "IPv4 or IPv6 address",
+                        "name": "ip",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the IP stats provider to use, default is the configured one",
+                        "name": "provider",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LookupIPResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Cannot gather statistics",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ping": {
+            "get": {
+                "description": "Check if the health of system is ok or not",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ping"
+                ],
+                "summary": "Check health status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PingResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stats/agents": {
+            "get": {
+                "description": "Count the agents matching the filters, grouped by fields and bucketed by their creation time",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get statistics of agents",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Fields to group the agents by (country, asn, isp, city)",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Time buckets of the creation time (hour, day, week)",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to 30 buckets before the end",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to now",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Format of the response (json, grafana), the grafana format requires an interval",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by IP address",
+                        "name": "ip_address",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by country codes",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by cities",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by regions",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Filter agents by ASNs (e.g., 'AS3320')",
+                        "name": "asn",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by ISP containing this value",
+                        "name": "isp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter agents by a query (see README)",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include the deleted agents",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetAgentStatsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handlers.APIKey": {
+            "type": "object",
+            "properties": {
+                "can_sign": {
+                    "description": "CanSign is true if the key has a signing secret, RequireSignature rejects the unsigned requests of the key",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "limits": {
+                    "description": "Limits overrides the default limits, the limits missing here are the defaults",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/handlers.APIKeyLimits"
+                        }
+                    ]
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "require_signature": {
+                    "type": "boolean"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.APIKeyLimits": {
+            "type": "object",
+            "properties": {
+                "burst": {
+                    "type": "integer"
+                },
+                "daily_quota": {
+                    "type": "integer"
+                },
+                "monthly_quota": {
+                    "type": "integer"
+                },
+                "rate_limit": {
+                    "description": "RateLimit is the number of requests per second, Burst is the number of requests allowed at once",
+                    "type": "number"
+                }
+            }
+        },
+        "handlers.APIKeyResponse": {
+            "type": "object",
+            "properties": {
+                "api_key": {
+                    "$ref": "#/definitions/handlers.APIKey"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.Agent": {
+            "type": "object",
+            "properties": {
+                "asn": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "enrichment_status": {
+                    "description": "EnrichmentStatus is pending, completed or failed",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "isp": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.AgentDetailedResponse": {
+            "type": "object",
+            "properties": {
+                "agent": {
+                    "$ref": "#/definitions/handlers.Agent"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.AgentFacetValue": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.AgentPagination": {
+            "type": "object",
+            "properties": {
                 "current_page": {
                     "type": "integer"
                 },
-                "per_page": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "per_page": {
+                    "type": "integer"
+                },
+                "prev_cursor": {
+                    "type": "string"
+                },
+                "total_agents": {
+                    "type": "integer"
+                },
+                "total_is_estimate": {
+                    "type": "boolean"
+                },
+                "total_pages": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.AgentStatsBucket": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "group": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.AgentStatsData": {
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.AgentStatsBucket"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "group_by": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "interval": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "truncated": {
+                    "description": "Truncated reports whether there were more buckets than the maximum number of them",
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.AgentsData": {
+            "type": "object",
+            "properties": {
+                "agents": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.Agent"
+                    }
+                },
+                "facets": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/handlers.AgentFacetValue"
+                        }
+                    }
+                },
+                "pagination": {
+                    "$ref": "#/definitions/handlers.AgentPagination"
+                }
+            }
+        },
+        "handlers.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "api_key_id": {
+                    "type": "integer"
+                },
+                "client_ip": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "resource": {
+                    "type": "string"
+                },
+                "resource_id": {
+                    "type": "string"
+                },
+                "route": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "summary": {
+                    "type": "object"
+                },
+                "tenant_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BatchCreateAgentResult": {
+            "type": "object",
+            "properties": {
+                "agent": {
+                    "$ref": "#/definitions/handlers.Agent"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.BatchCreateAgentsRequest": {
+            "type": "object",
+            "properties": {
+                "ip_addresses": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handlers.BatchCreateAgentsResponse": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.BatchCreateAgentResult"
+                    }
+                }
+            }
+        },
+        "handlers.BulkDeleteAgentsResponse": {
+            "type": "object",
+            "properties": {
+                "deleted_agents": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "matched_agents": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "sample": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.Agent"
+                    }
+                }
+            }
+        },
+        "handlers.CreateAPIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt is optional, the key does not expire without it",
+                    "type": "string"
+                },
+                "limits": {
+                    "$ref": "#/definitions/handlers.APIKeyLimits"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "require_signature": {
+                    "description": "RequireSignature rejects the requests of the key which are not signed by its signing secret",
+                    "type": "boolean"
+                },
+                "scopes": {
+                    "description": "Scopes are the permissions of the key, agents:read by default",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant_id": {
+                    "description": "TenantID is the tenant of the clients of the key, the tenant of the creator by default",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.CreateAPIKeyResponse": {
+            "type": "object",
+            "properties": {
+                "api_key": {
+                    "$ref": "#/definitions/handlers.APIKey"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "signing_secret": {
+                    "description": "SigningSecret signs the requests of the key",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.CreateAgentRequest": {
+            "type": "object",
+            "properties": {
+                "ip_address": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.CreateAgentResponse": {
+            "type": "object",
+            "properties": {
+                "agent": {
+                    "$ref": "#/definitions/handlers.Agent"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.CreateTenantRequest": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID identifies the tenant in the bearer tokens and the API keys, e.g. acme",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "settings": {
+                    "$ref": "#/definitions/handlers.TenantSettings"
+                }
+            }
+        },
+        "handlers.DeleteAgentResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.EndpointUsage": {
+            "type": "object",
+            "properties": {
+                "endpoint": {
+                    "type": "string"
+                },
+                "requests": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "upstream_lookups": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.EnrichmentJob": {
+            "type": "object",
+            "properties": {
+                "agent_id": {
+                    "type": "integer"
+                },
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "max_attempts": {
+                    "type": "integer"
+                },
+                "run_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.EnrichmentJobResponse": {
+            "type": "object",
+            "properties": {
+                "job": {
+                    "$ref": "#/definitions/handlers.EnrichmentJob"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GetAPIKeysResponse": {
+            "type": "object",
+            "properties": {
+                "api_keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.APIKey"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GetAgentStatsResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/handlers.AgentStatsData"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GetAgentsResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/handlers.AgentsData"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GetAuditEventsResponse": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.AuditEvent"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GetTenantsResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "tenants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.Tenant"
+                    }
+                }
+            }
+        },
+        "handlers.ImportAgentsResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "report": {
+                    "$ref": "#/definitions/handlers.ImportReport"
+                }
+            }
+        },
+        "handlers.ImportJob": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "report": {
+                    "$ref": "#/definitions/handlers.ImportReport"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ImportJobResponse": {
+            "type": "object",
+            "properties": {
+                "job": {
+                    "$ref": "#/definitions/handlers.ImportJob"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ImportLineResult": {
+            "type": "object",
+            "properties": {
+                "agent_id": {
                     "type": "integer"
                 },
-                "total_agents": {
+                "ip_address": {
+                    "type": "string"
+                },
+                "line": {
                     "type": "integer"
                 },
-                "total_pages": {
+                "reason": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ImportReport": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.ImportLineResult"
+                    }
+                },
+                "skipped": {
                     "type": "integer"
                 }
             }
         },
-        "handlers.AgentsData": {
+        "handlers.KeyUsage": {
             "type": "object",
             "properties": {
-                "agents": {
+                "api_key_id": {
+                    "type": "integer"
+                },
+                "endpoints": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/handlers.Agent"
+                        "$ref": "#/definitions/handlers.EndpointUsage"
                     }
                 },
-                "pagination": {
-                    "$ref": "#/definitions/handlers.AgentPagination"
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "requests": {
+                    "type": "integer"
+                },
+                "upstream_lookups": {
+                    "type": "integer"
                 }
             }
         },
-        "handlers.CreateAgentRequest": {
+        "handlers.LookupIPResponse": {
             "type": "object",
             "properties": {
+                "classification": {
+                    "$ref": "#/definitions/iputil.Classification"
+                },
                 "ip_address": {
                     "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "stats": {
+                    "description": "Stats is not gathered for the bogon IP addresses",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/iputil.Stats"
+                        }
+                    ]
                 }
             }
         },
-        "handlers.CreateAgentResponse": {
+        "handlers.PingResponse": {
             "type": "object",
             "properties": {
-                "agent": {
+                "database_status": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.QueryErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "position": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.RefreshAgentResponse": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "$ref": "#/definitions/handlers.Agent"
+                },
+                "before": {
                     "$ref": "#/definitions/handlers.Agent"
                 },
                 "message": {
@@ -291,29 +2742,160 @@ const docTemplate = `{
                 }
             }
         },
-        "handlers.ErrorResponse": {
+        "handlers.Tenant": {
             "type": "object",
             "properties": {
-                "error": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "settings": {
+                    "$ref": "#/definitions/handlers.TenantSettings"
+                },
+                "updated_at": {
                     "type": "string"
                 }
             }
         },
-        "handlers.GetAgentsResponse": {
+        "handlers.TenantResponse": {
             "type": "object",
             "properties": {
-                "data": {
-                    "$ref": "#/definitions/handlers.AgentsData"
+                "message": {
+                    "type": "string"
+                },
+                "tenant": {
+                    "$ref": "#/definitions/handlers.Tenant"
+                }
+            }
+        },
+        "handlers.TenantSettings": {
+            "type": "object",
+            "properties": {
+                "enrichment_provider": {
+                    "description": "EnrichmentProvider gathers the stats of the IP addresses of the tenant when no provider is asked for",
+                    "type": "string"
+                },
+                "retention_days": {
+                    "description": "RetentionDays is the number of days the deleted agents are kept before being purged, zero keeps them forever",
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.UpdateAPIKeyScopesRequest": {
+            "type": "object",
+            "properties": {
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handlers.UpdateAPIKeySigningRequest": {
+            "type": "object",
+            "properties": {
+                "require_signature": {
+                    "description": "RequireSignature rejects the requests of the key which are not signed",
+                    "type": "boolean"
+                },
+                "rotate_secret": {
+                    "description": "RotateSecret replaces the signing secret, a secret is always created if the key has none",
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.UpdateAPIKeySigningResponse": {
+            "type": "object",
+            "properties": {
+                "api_key": {
+                    "$ref": "#/definitions/handlers.APIKey"
                 },
                 "message": {
                     "type": "string"
+                },
+                "signing_secret": {
+                    "type": "string"
                 }
             }
         },
-        "handlers.PingResponse": {
+        "handlers.UpdateTenantRequest": {
             "type": "object",
             "properties": {
-                "database_status": {
+                "name": {
+                    "type": "string"
+                },
+                "settings": {
+                    "$ref": "#/definitions/handlers.TenantSettings"
+                }
+            }
+        },
+        "handlers.UsageResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.KeyUsage"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "iputil.Classification": {
+            "type": "object",
+            "properties": {
+                "bogon": {
+                    "description": "Bogon reports whether the IP address should not appear on the public internet",
+                    "type": "boolean"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version is either ipv4 or ipv6",
+                    "type": "string"
+                }
+            }
+        },
+        "iputil.Stats": {
+            "type": "object",
+            "properties": {
+                "asn": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "country_name": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "isp": {
+                    "type": "string"
+                },
+                "loc": {
+                    "type": "string"
+                },
+                "region": {
                     "type": "string"
                 }
             }
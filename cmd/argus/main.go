@@ -3,20 +3,33 @@ package main
 import (
 	"argus/config"
 	"argus/internal/db"
+	"argus/internal/enrichment"
 	"argus/internal/iputil"
 	"argus/internal/routes"
+	"argus/internal/tenant"
+	"argus/internal/usage"
 	"argus/pkg/logger"
 	tracing "argus/pkg/otel"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/ipinfo/go/v2/ipinfo"
 	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
+// ShutdownTimeout is the time given to the requests in progress to finish on shutdown
+const ShutdownTimeout = 30 * time.Second
+
 func main() {
-	ctx := context.Background()
+	// The server and the background work are stopped on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Load the config
 	var cfg config.Config
@@ -24,6 +37,9 @@ func main() {
 	if err != nil {
 		panic(err.Error())
 	}
+	if err = cfg.Validate(); err != nil {
+		panic(err.Error())
+	}
 
 	fmt.Printf(`
 ___  ____ ____ _    ___  
@@ -83,15 +99,67 @@ Configuration: %+v
 	if err != nil {
 		log.WithError(err).Fatal(err)
 	}
+	ipStatsProviders := iputil.NewProviders(iputil.ProviderIPInfo, argusIpClient)
+
+	// The usage of the requests and of the background work is metered together
+	meter := usage.NewMeter(gormDB, usage.DefaultFlushInterval)
+
+	// Start the workers enriching the agents created asynchronously
+	if cfg.Enrichment.Workers > 0 {
+		worker := enrichment.New(gormDB, ipStatsProviders, enrichment.Options{
+			Concurrency:  cfg.Enrichment.Workers,
+			PollInterval: time.Duration(cfg.Enrichment.PollIntervalInSecs) * time.Second,
+			Timeout:      time.Duration(cfg.IPInfo.DefaultTimeoutInSecs) * time.Second,
+			Meter:        meter,
+		})
+		go worker.Run(ctx)
+		log.WithField("workers", cfg.Enrichment.Workers).Info("the enrichment workers are started")
+	}
+
+	// Start purging the deleted agents after the retention of their tenant
+	retention := tenant.NewRetention(gormDB, cfg.Retention.DeletedAgentsInDays, time.Duration(cfg.Retention.IntervalInSecs)*time.Second)
+	go retention.Run(ctx)
 
 	// Create Gin HTTP Server
-	s, err := routes.NewGinServer(cfg, gormDB, argusIpClient)
+	s, err := routes.NewGinServer(cfg, gormDB, ipStatsProviders, meter)
 	if err != nil {
 		log.WithError(err).Fatal("error in creating API server")
 	}
 	log.Info("created the gin server")
 
+	// Serve the metrics on their own port
+	if metricsServer := routes.NewMetricsServer(cfg); metricsServer != nil {
+		go func() {
+			log.WithField("port", cfg.Metrics.Port).Info("the metrics server is going to be started")
+			log.WithError(metricsServer.ListenAndServe()).Fatal("")
+		}()
+	}
+
 	// Start Listening and Serving
-	log.WithField("port", cfg.Argus.Port).Info("the server is going to be started")
-	log.WithError(s.ListenAndServe()).Fatal("")
+	go func() {
+		var err error
+		if s.TLSConfig != nil {
+			// The certificate is provided by the TLS config
+			log.WithField("port", cfg.Argus.Port).Info("the tls server is going to be started")
+			err = s.ListenAndServeTLS("", "")
+		} else {
+			log.WithField("port", cfg.Argus.Port).Info("the server is going to be started")
+			err = s.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).Fatal("")
+		}
+	}()
+
+	// Shut down gracefully, the usage of the finished requests is flushed before exiting
+	<-ctx.Done()
+	log.Info("the server is shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err = s.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("cannot finish the requests in progress")
+	}
+	if err = meter.Close(shutdownCtx); err != nil {
+		log.WithError(err).Error("cannot flush the usage")
+	}
 }
@@ -1,6 +1,15 @@
 package config
 
-import "strings"
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultAPIKey is the default bootstrap key, for development only as it is public
+const DefaultAPIKey = "test_api_key"
+
+// ErrDefaultAPIKey is returned when the default bootstrap key is used in production mode
+var ErrDefaultAPIKey = errors.New("API_KEY should be changed or left empty in production mode")
 
 type Config struct {
 	Argus struct {
@@ -12,7 +21,7 @@ type Config struct {
 		GinMode string `env:"GIN_MODE" env-default:"debug" env-description:"Gin framework mode (release or debug)"`
 		Port    string `env:"SERVING_PORT" env-default:"8081" env-description:"Port number for Argus API"`
 
-		// APIKey: Just for testing purposes, API_Keys of agents should be managed by a separate table
+		// APIKey is always accepted besides the keys in the database, e.g. to create the first keys
 		APIKey string `env:"API_KEY" env-default:"test_api_key" env-description:"API key"`
 	}
 	IPInfo struct {
@@ -32,6 +41,62 @@ type Config struct {
 		IsReportCallerMode bool   `env:"LOGGER_IS_REPORT_CALLER_MODE" env-default:"false" env-description:"Does the logger have report caller"`
 		IsPrettyPrint      bool   `env:"LOGGER_PRETTY_PRINT" env-default:"false" env-description:"Pretty JSON Print flag"`
 	}
+	TLS struct {
+		CertFile             string   `env:"TLS_CERT_FILE" env-default:"" env-description:"PEM certificate of the server, the server is served over plain HTTP if it is empty"`
+		KeyFile              string   `env:"TLS_KEY_FILE" env-default:"" env-description:"PEM private key of the server certificate"`
+		ReloadIntervalInSecs int64    `env:"TLS_RELOAD_INTERVAL_IN_SECS" env-default:"60" env-description:"Seconds between checking the certificate files for changes"`
+		ClientCAFile         string   `env:"TLS_CLIENT_CA_FILE" env-default:"" env-description:"PEM bundle of the CAs verifying the client certificates, the client certificates are not requested if it is empty"`
+		RequireClientCert    bool     `env:"TLS_REQUIRE_CLIENT_CERT" env-default:"false" env-description:"Reject the connections without a verified client certificate"`
+		ClientCertScopes     []string `env:"TLS_CLIENT_CERT_SCOPES" env-default:"agents:read" env-description:"Comma-separated scopes of the clients authenticated by their certificates"`
+	}
+	Metrics struct {
+		Port string `env:"METRICS_PORT" env-default:"9090" env-description:"Port number of the metrics, they are served with the APIs if empty"`
+	}
+	Proxy struct {
+		TrustedProxies  []string `env:"TRUSTED_PROXIES" env-default:"" env-description:"Comma-separated CIDRs or IPs of the trusted reverse proxies, no proxy is trusted if empty"`
+		RemoteIPHeaders []string `env:"REMOTE_IP_HEADERS" env-default:"X-Forwarded-For,X-Real-IP,Forwarded" env-description:"Comma-separated headers containing the client IP set by the trusted proxies, in order of priority"`
+	}
+	Lookup struct {
+		RateLimit float64 `env:"IP_LOOKUP_RATE_LIMIT" env-default:"1" env-description:"Allowed IP lookups per second for each client, 0 disables the limit"`
+		Burst     int     `env:"IP_LOOKUP_BURST" env-default:"10" env-description:"Allowed burst of IP lookups for each client"`
+	}
+	Auth struct {
+		APIKeyCacheTTLInSecs int64 `env:"API_KEY_CACHE_TTL_IN_SECS" env-default:"30" env-description:"Seconds the API keys are cached for, a revoked key may be accepted during this time"`
+	}
+	Tenants struct {
+		CacheTTLInSecs int64 `env:"TENANT_CACHE_TTL_IN_SECS" env-default:"30" env-description:"Seconds the tenants are cached for, the changes of their settings may take effect after this time"`
+	}
+	Retention struct {
+		DeletedAgentsInDays int   `env:"DELETED_AGENTS_RETENTION_IN_DAYS" env-default:"0" env-description:"Default days the deleted agents are kept before being purged, 0 keeps them forever"`
+		IntervalInSecs      int64 `env:"RETENTION_INTERVAL_IN_SECS" env-default:"3600" env-description:"Seconds between purging the deleted agents"`
+	}
+	Audit struct {
+		LogSink string `env:"AUDIT_LOG_SINK" env-default:"" env-description:"Where the audit events are forwarded to as JSON lines besides the database (stdout, stderr or a file), they are not forwarded if it is empty"`
+	}
+	JWT struct {
+		JWKSURL               string `env:"JWT_JWKS_URL" env-default:"" env-description:"URL of the JWKS verifying the bearer tokens, the tokens are not accepted if neither the URL nor the file is set"`
+		JWKSFile              string `env:"JWT_JWKS_FILE" env-default:"" env-description:"Local file of the JWKS verifying the bearer tokens"`
+		RefreshIntervalInSecs int64  `env:"JWT_JWKS_REFRESH_INTERVAL_IN_SECS" env-default:"300" env-description:"Seconds between reloading the JWKS"`
+		Issuer                string `env:"JWT_ISSUER" env-default:"" env-description:"Expected issuer (iss) of the bearer tokens"`
+		Audience              string `env:"JWT_AUDIENCE" env-default:"argus" env-description:"Expected audience (aud) of the bearer tokens"`
+		ClockSkewInSecs       int64  `env:"JWT_CLOCK_SKEW_IN_SECS" env-default:"60" env-description:"Allowed clock skew in seconds when checking the times of the bearer tokens"`
+		ScopesClaim           string `env:"JWT_SCOPES_CLAIM" env-default:"scope" env-description:"Claim of the bearer tokens containing the scopes, separated by spaces or as an array"`
+		TenantClaim           string `env:"JWT_TENANT_CLAIM" env-default:"tenant" env-description:"Claim of the bearer tokens containing the tenant"`
+	}
+	Signature struct {
+		MaxSkewInSecs int64 `env:"SIGNATURE_MAX_SKEW_IN_SECS" env-default:"300" env-description:"Seconds the timestamp of a signed request can differ from the server time"`
+	}
+	Quota struct {
+		RateLimit    float64 `env:"API_KEY_RATE_LIMIT" env-default:"10" env-description:"Default requests per second of each API key, 0 disables the limit"`
+		Burst        int     `env:"API_KEY_BURST" env-default:"20" env-description:"Default burst of requests of each API key"`
+		DailyQuota   int64   `env:"API_KEY_DAILY_QUOTA" env-default:"0" env-description:"Default requests per day (UTC) of each API key, 0 means unlimited"`
+		MonthlyQuota int64   `env:"API_KEY_MONTHLY_QUOTA" env-default:"0" env-description:"Default requests per month (UTC) of each API key, 0 means unlimited"`
+	}
+	Enrichment struct {
+		Workers            int   `env:"ENRICHMENT_WORKERS" env-default:"4" env-description:"Number of agents enriched at the same time in the background, 0 disables the workers"`
+		MaxAttempts        int   `env:"ENRICHMENT_MAX_ATTEMPTS" env-default:"5" env-description:"Attempts of enriching an agent before its job is dead-lettered"`
+		PollIntervalInSecs int64 `env:"ENRICHMENT_POLL_INTERVAL_IN_SECS" env-default:"1" env-description:"Seconds between checking the queue of the enrichment jobs"`
+	}
 	Tracing struct {
 		Enabled      bool    `env:"IS_TRACING_ENABLED"  env-default:"false" env-description:"activate tracing"`
 		Endpoint     string  `env:"JAEGER_ENDPOINT" env-default:"http://localhost:14268/api/traces" env-description:"Endpoint to send tracing requests"`
@@ -40,6 +105,15 @@ type Config struct {
 	}
 }
 
+// Validate checks the config is safe to run with, e.g. the default bootstrap key is not used in production mode
+func (c Config) Validate() error {
+	if c.Argus.IsProductionMode && c.Argus.APIKey == DefaultAPIKey {
+		return ErrDefaultAPIKey
+	}
+
+	return nil
+}
+
 // maskString Masks sensitive information with asterisks from string
 func maskString(s string) string {
 	if len(s) <= 4 {
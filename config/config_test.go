@@ -88,3 +88,18 @@ func TestSecureClone(t *testing.T) {
 	assert.Equal(t, c.Argus.Version, sc.Argus.Version, "Expected Argus.Version to be %s, got %s", c.Argus.Version, sc.Argus.Version)
 	assert.Equal(t, c.Logger.Level, sc.Logger.Level, "Expected Logger.Level to be %s, got %s", c.Logger.Level, sc.Logger.Level)
 }
+
+func TestValidate(t *testing.T) {
+	var c Config
+	c.Argus.APIKey = DefaultAPIKey
+	assert.NoError(t, c.Validate())
+
+	// The default bootstrap key is rejected in production mode
+	c.Argus.IsProductionMode = true
+	assert.ErrorIs(t, c.Validate(), ErrDefaultAPIKey)
+
+	c.Argus.APIKey = ""
+	assert.NoError(t, c.Validate())
+	c.Argus.APIKey = "changed_api_key"
+	assert.NoError(t, c.Validate())
+}
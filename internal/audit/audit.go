@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink receives a copy of the audit events, e.g. to forward them to a log pipeline
+type Sink interface {
+	Send(event db.AuditEvent) error
+}
+
+// Recorder stores the audit events and forwards them to its sink
+type Recorder struct {
+	db db.DB
+
+	mu   sync.RWMutex
+	sink Sink
+}
+
+// NewRecorder creates a recorder storing the events in the database, without a sink
+func NewRecorder(database db.DB) *Recorder {
+	return &Recorder{db: database}
+}
+
+// SetSink changes the sink the events are forwarded to, nil stops forwarding them
+func (r *Recorder) SetSink(sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sink = sink
+}
+
+// Record stores the event and forwards it to the sink. The event is forwarded even if it cannot be stored, so it is
+// not lost, but the error of storing it is returned.
+func (r *Recorder) Record(ctx context.Context, event *db.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	err := r.db.CreateAuditEvent(ctx, event)
+
+	r.mu.RLock()
+	sink := r.sink
+	r.mu.RUnlock()
+	if sink != nil {
+		if sinkErr := sink.Send(*event); sinkErr != nil {
+			logger.WithError(sinkErr).WithField("request_id", event.RequestID).Warn("cannot forward the audit event")
+		}
+	}
+
+	return err
+}
+
+// logEntry is the format of the audit events in the log sinks
+type logEntry struct {
+	ID         uint            `json:"id,omitempty"`
+	Time       time.Time       `json:"time"`
+	TenantID   string          `json:"tenant_id"`
+	Subject    string          `json:"subject"`
+	APIKeyID   uint            `json:"api_key_id"`
+	Action     string          `json:"action,omitempty"`
+	Resource   string          `json:"resource,omitempty"`
+	ResourceID string          `json:"resource_id,omitempty"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"`
+	Status     int             `json:"status"`
+	Outcome    string          `json:"outcome"`
+	Reason     string          `json:"reason,omitempty"`
+	RequestID  string          `json:"request_id"`
+	ClientIP   string          `json:"client_ip"`
+	Summary    json.RawMessage `json:"summary,omitempty"`
+}
+
+// LogSink writes the audit events as JSON lines, which are tagged with "audit": true
+type LogSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogSink creates a sink writing the events to w
+func NewLogSink(w io.Writer) *LogSink {
+	return &LogSink{w: w}
+}
+
+// Send writes the event as a line
+func (s *LogSink) Send(event db.AuditEvent) error {
+	entry := struct {
+		Audit bool `json:"audit"`
+		logEntry
+	}{Audit: true, logEntry: logEntry{
+		ID:         event.ID,
+		Time:       event.CreatedAt.UTC(),
+		TenantID:   event.TenantID,
+		Subject:    event.Subject,
+		APIKeyID:   event.APIKeyID,
+		Action:     event.Action,
+		Resource:   event.Resource,
+		ResourceID: event.ResourceID,
+		Method:     event.Method,
+		Route:      event.Route,
+		Status:     event.Status,
+		Outcome:    event.Outcome,
+		Reason:     event.Reason,
+		RequestID:  event.RequestID,
+		ClientIP:   event.ClientIP,
+	}}
+	if json.Valid([]byte(event.Summary)) {
+		entry.Summary = json.RawMessage(event.Summary)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// OpenSink opens the log sink of the target, which is stdout, stderr or a file the events are appended to.
+// An empty target means no sink.
+func OpenSink(target string) (Sink, error) {
+	switch target {
+	case "":
+		return nil, nil
+	case "stdout":
+		return NewLogSink(os.Stdout), nil
+	case "stderr":
+		return NewLogSink(os.Stderr), nil
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the audit log file: %w", err)
+	}
+	return NewLogSink(f), nil
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Setup the logger
+	logger.SetupLogger(logrus.New())
+
+	m.Run()
+}
+
+// fakeDB keeps the audit events in memory, the other methods of db.DB are not implemented
+type fakeDB struct {
+	db.DB
+	events []db.AuditEvent
+	err    error
+}
+
+func (f *fakeDB) CreateAuditEvent(ctx context.Context, event *db.AuditEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+	event.ID = uint(len(f.events) + 1)
+	f.events = append(f.events, *event)
+	return nil
+}
+
+// fakeSink keeps the forwarded events in memory
+type fakeSink struct {
+	events []db.AuditEvent
+}
+
+func (f *fakeSink) Send(event db.AuditEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	fdb := &fakeDB{}
+	recorder := NewRecorder(fdb)
+
+	// The events are stored without a sink
+	assert.NoError(t, recorder.Record(ctx, &db.AuditEvent{Action: "agent.create"}))
+	assert.Len(t, fdb.events, 1)
+	assert.False(t, fdb.events[0].CreatedAt.IsZero())
+
+	// The stored events are forwarded with their ID
+	sink := &fakeSink{}
+	recorder.SetSink(sink)
+	assert.NoError(t, recorder.Record(ctx, &db.AuditEvent{Action: "agent.delete"}))
+	assert.Len(t, sink.events, 1)
+	assert.Equal(t, uint(2), sink.events[0].ID)
+
+	// The events which cannot be stored are still forwarded
+	fdb.err = errors.New("connection refused")
+	assert.ErrorIs(t, recorder.Record(ctx, &db.AuditEvent{Action: "agent.purge"}), fdb.err)
+	assert.Len(t, sink.events, 2)
+	assert.Equal(t, "agent.purge", sink.events[1].Action)
+}
+
+func TestLogSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewLogSink(&buf)
+
+	assert.NoError(t, sink.Send(db.AuditEvent{ID: 1, Subject: "api_key:1a2b3c4d", Action: "agent.delete", Summary: `{"query":{"force":["true"]}}`}))
+	assert.NoError(t, sink.Send(db.AuditEvent{ID: 2, Subject: "api_key:1a2b3c4d", Outcome: db.AuditDenied, Summary: "not json"}))
+
+	// Each event is a JSON line
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, true, entry["audit"])
+	assert.Equal(t, "agent.delete", entry["action"])
+	assert.Equal(t, map[string]any{"query": map[string]any{"force": []any{"true"}}}, entry["summary"])
+
+	entry = nil
+	assert.NoError(t, json.Unmarshal(lines[1], &entry))
+	assert.Equal(t, db.AuditDenied, entry["outcome"])
+	assert.NotContains(t, entry, "summary")
+}
+
+func TestOpenSink(t *testing.T) {
+	sink, err := OpenSink("")
+	assert.NoError(t, err)
+	assert.Nil(t, sink)
+
+	sink, err = OpenSink("stdout")
+	assert.NoError(t, err)
+	assert.NotNil(t, sink)
+
+	// The events are appended to the file
+	path := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o600))
+	sink, err = OpenSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Send(db.AuditEvent{ID: 1}))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, bytes.Split(bytes.TrimSpace(content), []byte("\n")), 2)
+
+	_, err = OpenSink(filepath.Join(t.TempDir(), "missing", "audit.log"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyScheme is the first part of the API keys, e.g. argus_1a2b3c4d_<secret>
+const APIKeyScheme = "argus"
+
+// LastUsedResolution is the minimum time between updating the last used time of a key
+const LastUsedResolution = time.Minute
+
+// APIKeyHeader is the header of the API keys
+const APIKeyHeader = "API-Key"
+
+var ErrInvalidAPIKey error = credentialsError("invalid api key")
+
+// BootstrapAPIKey is the key returned when the bootstrap key of the config is used, it is granted every scope
+var BootstrapAPIKey = db.APIKey{Name: "bootstrap", Scopes: db.Scopes{ScopeAdmin}}
+
+// GenerateAPIKey creates a random key and returns it with its prefix, the key cannot be recovered after hashing
+func GenerateAPIKey() (key string, prefix string, err error) {
+	b := make([]byte, 4+32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(b[:4])
+	return fmt.Sprintf("%s_%s_%s", APIKeyScheme, prefix, hex.EncodeToString(b[4:])), prefix, nil
+}
+
+// HashAPIKey returns the hash of the key which is stored instead of the key
+func HashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// parseAPIKeyPrefix returns the prefix of a key in the format of GenerateAPIKey
+func parseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != APIKeyScheme || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// cachedAPIKey is a key looked up from the database, key is nil if there is no key with the prefix
+type cachedAPIKey struct {
+	key       *db.APIKey
+	expiresAt time.Time
+}
+
+// APIKeyStore authenticates the API keys stored in the database. The keys are cached for a short time,
+// so a revoked key may be accepted until its cache entry expires on other instances.
+type APIKeyStore struct {
+	db           db.DB
+	ttl          time.Duration
+	bootstrapKey string
+	now          func() time.Time
+
+	mu        sync.Mutex
+	cache     map[string]*cachedAPIKey
+	lastSweep time.Time
+}
+
+// NewAPIKeyStore creates a store caching the keys for the ttl, the bootstrap key is accepted too if it is not empty
+func NewAPIKeyStore(database db.DB, ttl time.Duration, bootstrapKey string) *APIKeyStore {
+	return &APIKeyStore{
+		db:           database,
+		ttl:          ttl,
+		bootstrapKey: bootstrapKey,
+		now:          time.Now,
+		cache:        map[string]*cachedAPIKey{},
+	}
+}
+
+// Authenticate returns the stored key matching the given key, ErrInvalidAPIKey is returned if there is no such
+// active key. Other errors mean the key cannot be checked.
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string) (*db.APIKey, error) {
+	if s.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.bootstrapKey)) == 1 {
+		bootstrap := BootstrapAPIKey
+		return &bootstrap, nil
+	}
+
+	prefix, ok := parseAPIKeyPrefix(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	entry, err := s.lookup(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.key == nil || subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(entry.key.Hash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if entry.key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: the key is revoked", ErrInvalidAPIKey)
+	}
+	now := s.now()
+	if !entry.key.IsActive(now) {
+		return nil, fmt.Errorf("%w: the key is expired", ErrInvalidAPIKey)
+	}
+
+	// The last used time is not exact, updating it on every request would be a write per request
+	if entry.key.LastUsedAt == nil || now.Sub(*entry.key.LastUsedAt) >= LastUsedResolution {
+		entry.key.LastUsedAt = &now
+		go s.touch(entry.key.ID, now)
+	}
+
+	found := *entry.key
+	return &found, nil
+}
+
+// AuthenticateRequest authenticates the request by its API key, it implements Authenticator
+func (s *APIKeyStore) AuthenticateRequest(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+
+	apiKey, err := s.Authenticate(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	return NewAPIKeyPrincipal(apiKey), nil
+}
+
+// touch stores the last used time of the key
+func (s *APIKeyStore) touch(keyID uint, usedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.TouchAPIKey(ctx, keyID, usedAt); err != nil {
+		logger.WithError(err).WithField("api_key_id", keyID).Warn("cannot update the last used time of the api key")
+	}
+}
+
+// Invalidate removes the key from the cache, e.g. after it is revoked
+func (s *APIKeyStore) Invalidate(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, prefix)
+}
+
+// lookup returns the cached key of the prefix, or looks it up in the database
+func (s *APIKeyStore) lookup(ctx context.Context, prefix string) (*cachedAPIKey, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[prefix]
+	s.mu.Unlock()
+	if ok && s.now().Before(entry.expiresAt) {
+		return entry, nil
+	}
+
+	key, err := s.db.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil && !errors.Is(err, db.ErrAPIKeyNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	entry = &cachedAPIKey{key: key, expiresAt: now.Add(s.ttl)}
+	s.cache[prefix] = entry
+
+	return entry, nil
+}
+
+// sweep removes the expired entries, unknown prefixes are cached too and would pile up otherwise
+func (s *APIKeyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for prefix, entry := range s.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(s.cache, prefix)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Setup the logger
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+	logger.SetupLogger(log)
+
+	m.Run()
+}
+
+// fakeDB keeps the API keys in memory, the other methods of db.DB are not implemented
+type fakeDB struct {
+	db.DB
+	mu      sync.Mutex
+	keys    map[string]db.APIKey
+	lookups int
+	touches int
+	err     error
+	// nonces are the expiry times of the used nonces by the key id and the nonce
+	nonces map[string]time.Time
+}
+
+func (f *fakeDB) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*db.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	key, ok := f.keys[prefix]
+	if !ok {
+		return nil, db.ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (f *fakeDB) TouchAPIKey(ctx context.Context, keyID uint, usedAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touches++
+	return nil
+}
+
+func (f *fakeDB) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookups, f.touches
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.Len(t, prefix, 8)
+
+	parsed, ok := parseAPIKeyPrefix(key)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, parsed)
+
+	other, _, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, HashAPIKey(key), HashAPIKey(other))
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	ctx := context.Background()
+
+	key, prefix, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	revokedKey, revokedPrefix, err := GenerateAPIKey()
+	assert.NoError(t, err)
+	expiredKey, expiredPrefix, err := GenerateAPIKey()
+	assert.NoError(t, err)
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	fdb := &fakeDB{keys: map[string]db.APIKey{
+		prefix:        {ID: 1, Prefix: prefix, Hash: HashAPIKey(key), Name: "active"},
+		revokedPrefix: {ID: 2, Prefix: revokedPrefix, Hash: HashAPIKey(revokedKey), Name: "revoked", RevokedAt: &yesterday},
+		expiredPrefix: {ID: 3, Prefix: expiredPrefix, Hash: HashAPIKey(expiredKey), Name: "expired", ExpiresAt: &yesterday},
+	}}
+	store := NewAPIKeyStore(fdb, time.Minute, "bootstrap_key")
+
+	tests := []struct {
+		name         string
+		key          string
+		expectedName string
+		expectedErr  error
+	}{
+		{name: "Active Key", key: key, expectedName: "active"},
+		{name: "Bootstrap Key", key: "bootstrap_key", expectedName: "bootstrap"},
+		{name: "Wrong Secret", key: "argus_" + prefix + "_0000", expectedErr: ErrInvalidAPIKey},
+		{name: "Unknown Prefix", key: "argus_00000000_0000", expectedErr: ErrInvalidAPIKey},
+		{name: "Malformed Key", key: "test_api_key", expectedErr: ErrInvalidAPIKey},
+		{name: "Revoked Key", key: revokedKey, expectedErr: ErrInvalidAPIKey},
+		{name: "Expired Key", key: expiredKey, expectedErr: ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey, err := store.Authenticate(ctx, tt.key)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedName, apiKey.Name)
+		})
+	}
+}
+
+func TestAPIKeyStoreCache(t *testing.T) {
+	ctx := context.Background()
+
+	key, prefix, err := GenerateAPIKey()
+	assert.NoError(t, err)
+
+	fdb := &fakeDB{keys: map[string]db.APIKey{prefix: {ID: 1, Prefix: prefix, Hash: HashAPIKey(key)}}}
+	store := NewAPIKeyStore(fdb, time.Minute, "")
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	// The key and the unknown prefix are looked up once
+	for i := 0; i < 3; i++ {
+		_, err = store.Authenticate(ctx, key)
+		assert.NoError(t, err)
+		_, err = store.Authenticate(ctx, "argus_00000000_0000")
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	}
+	lookups, _ := fdb.counts()
+	assert.Equal(t, 2, lookups)
+	assert.Eventually(t, func() bool {
+		_, touches := fdb.counts()
+		return touches == 1
+	}, time.Second, 10*time.Millisecond, "the last used time should be updated once")
+
+	// The revocation is seen after the cache is expired or invalidated
+	revokedAt := now
+	fdb.mu.Lock()
+	fdb.keys[prefix] = db.APIKey{ID: 1, Prefix: prefix, Hash: HashAPIKey(key), RevokedAt: &revokedAt}
+	fdb.mu.Unlock()
+
+	_, err = store.Authenticate(ctx, key)
+	assert.NoError(t, err)
+
+	store.Invalidate(prefix)
+	_, err = store.Authenticate(ctx, key)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Database errors are not cached
+	now = now.Add(2 * time.Minute)
+	fdb.mu.Lock()
+	fdb.err = errors.New("connection refused")
+	fdb.mu.Unlock()
+	_, err = store.Authenticate(ctx, key)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = store.Authenticate(ctx, key)
+	assert.Error(t, err)
+
+	lookups, _ = fdb.counts()
+	assert.Equal(t, 5, lookups)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidCredentials matches the errors of all the invalid credentials, e.g. ErrInvalidAPIKey and ErrInvalidToken
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// credentialsError is an error of invalid credentials
+type credentialsError string
+
+func (e credentialsError) Error() string {
+	return string(e)
+}
+
+// Is makes the invalid credentials match ErrInvalidCredentials
+func (e credentialsError) Is(target error) bool {
+	return target == ErrInvalidCredentials
+}
+
+// Authenticator authenticates the requests by one kind of credentials
+type Authenticator interface {
+	// AuthenticateRequest returns the principal of the credentials of the request, or nil if the request has no such
+	// credentials. An error matching ErrInvalidCredentials is returned for the invalid credentials, other errors mean
+	// the credentials cannot be checked.
+	AuthenticateRequest(r *http.Request) (*Principal, error)
+}
+
+// ClientCertAuthenticator authenticates the requests by the verified client certificate of their connection, the
+// clients are granted the Scopes
+type ClientCertAuthenticator struct {
+	Scopes []string
+}
+
+// AuthenticateRequest implements Authenticator
+func (a ClientCertAuthenticator) AuthenticateRequest(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+
+	// The first certificate of the verified chains is the certificate of the client
+	return NewClientCertPrincipal(r.TLS.VerifiedChains[0][0], a.Scopes), nil
+}
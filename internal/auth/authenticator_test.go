@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateRequest(t *testing.T) {
+	store := NewAPIKeyStore(&fakeDB{}, time.Minute, "bootstrap_key")
+	clientCert := ClientCertAuthenticator{Scopes: []string{ScopeAgentsRead}}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "inventory"}},
+	}}}
+
+	tests := []struct {
+		name            string
+		authenticator   Authenticator
+		headers         map[string]string
+		tls             *tls.ConnectionState
+		expectedSubject string
+		expectedErr     error
+	}{
+		{name: "API Key", authenticator: store, headers: map[string]string{APIKeyHeader: "bootstrap_key"}, expectedSubject: "api_key:bootstrap"},
+		{name: "Invalid API Key", authenticator: store, headers: map[string]string{APIKeyHeader: "test_api_key"}, expectedErr: ErrInvalidAPIKey},
+		{name: "Without API Key", authenticator: store},
+		{name: "Client Certificate", authenticator: clientCert, tls: verified, expectedSubject: "cert:CN=inventory"},
+		{name: "Unverified Connection", authenticator: clientCert, tls: &tls.ConnectionState{}},
+		{name: "Plain HTTP", authenticator: clientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			req.TLS = tt.tls
+
+			principal, err := tt.authenticator.AuthenticateRequest(req)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expectedSubject == "" {
+				assert.Nil(t, principal)
+				return
+			}
+			assert.Equal(t, tt.expectedSubject, principal.Subject)
+		})
+	}
+
+	// The other errors are not invalid credentials
+	assert.False(t, errors.Is(errors.New("connection refused"), ErrInvalidCredentials))
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"argus/pkg/logger"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinJWKSRefreshInterval is the minimum time between reloading the JWKS for tokens signed by unknown keys
+const MinJWKSRefreshInterval = 10 * time.Second
+
+var ErrInvalidToken error = credentialsError("invalid token")
+
+// jwtSigningMethods are the accepted algorithms, the symmetric ones are excluded as the keys are public
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWTOptions configures a JWTAuthenticator
+type JWTOptions struct {
+	// JWKSURL or JWKSFile is the location of the JSON Web Key Set verifying the tokens
+	JWKSURL  string
+	JWKSFile string
+	// RefreshInterval is the time between reloading the JWKS, e.g. to get the rotated keys
+	RefreshInterval time.Duration
+	// Issuer and Audience should be the iss and aud claims of the tokens
+	Issuer   string
+	Audience string
+	// ClockSkew is the leeway of checking the times of the tokens
+	ClockSkew time.Duration
+	// ScopesClaim contains the scopes of the client, separated by spaces or as an array
+	ScopesClaim string
+	// TenantClaim contains the tenant of the client
+	TenantClaim string
+}
+
+// JWTAuthenticator authenticates bearer tokens signed by the keys of a JWKS, the JWKS is reloaded every
+// RefreshInterval and when a token is signed by an unknown key.
+type JWTAuthenticator struct {
+	opts   JWTOptions
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	checkedAt time.Time
+	// refreshMu makes the concurrent requests wait for one reload of the JWKS
+	refreshMu sync.Mutex
+}
+
+// NewJWTAuthenticator creates an authenticator and loads its JWKS
+func NewJWTAuthenticator(ctx context.Context, opts JWTOptions) (*JWTAuthenticator, error) {
+	if (opts.JWKSURL == "") == (opts.JWKSFile == "") {
+		return nil, errors.New("either the url or the file of the jwks should be set")
+	}
+	if opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("the issuer and the audience of the tokens should be set")
+	}
+
+	a := &JWTAuthenticator{
+		opts:   opts,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+	keys, err := a.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = keys
+	a.checkedAt = a.now()
+
+	return a, nil
+}
+
+// Authenticate returns the principal of a valid token, ErrInvalidToken is returned for the invalid tokens
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.key(ctx, kid)
+	},
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithIssuer(a.opts.Issuer),
+		jwt.WithAudience(a.opts.Audience),
+		jwt.WithLeeway(a.opts.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	tenant, _ := claims[a.opts.TenantClaim].(string)
+	return &Principal{
+		Subject: "token:" + subject,
+		Scopes:  scopesOfTenant(tenant, scopesOfClaim(claims[a.opts.ScopesClaim])),
+		Tenant:  tenant,
+	}, nil
+}
+
+// AuthenticateRequest authenticates the request by the bearer token of its Authorization header, it implements
+// Authenticator
+func (a *JWTAuthenticator) AuthenticateRequest(r *http.Request) (*Principal, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	return a.Authenticate(r.Context(), strings.TrimSpace(token))
+}
+
+// scopesOfClaim returns the known scopes of a claim, which is a space separated string or an array of strings
+func scopesOfClaim(claim any) []string {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var scopes []string
+	for _, value := range values {
+		if IsValidScope(value) {
+			scopes = append(scopes, value)
+		}
+	}
+	return scopes
+}
+
+// key returns the key verifying the tokens of the key id, a token without a key id can only be verified if the
+// JWKS has a single key
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.RLock()
+	stale := a.now().Sub(a.checkedAt) >= a.opts.RefreshInterval
+	a.mu.RUnlock()
+	if stale {
+		a.refresh(ctx, a.opts.RefreshInterval)
+	}
+
+	key, err := a.find(kid)
+	if err != nil {
+		// The key may be rotated since the last reload
+		a.refresh(ctx, MinJWKSRefreshInterval)
+		return a.find(kid)
+	}
+	return key, nil
+}
+
+// find returns the loaded key of the key id
+func (a *JWTAuthenticator) find(kid string) (crypto.PublicKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// refresh reloads the JWKS if it is not checked in the interval, the loaded keys are kept if it cannot be loaded
+func (a *JWTAuthenticator) refresh(ctx context.Context, interval time.Duration) {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	a.mu.RLock()
+	checked := a.now().Sub(a.checkedAt) < interval
+	a.mu.RUnlock()
+	if checked {
+		return
+	}
+
+	// The reload is shared by the waiting requests, so it is not canceled with the request starting it
+	keys, err := a.load(context.WithoutCancel(ctx))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.checkedAt = a.now()
+	if err != nil {
+		logger.WithError(err).Warn("cannot reload the jwks, the loaded keys are used")
+		return
+	}
+	a.keys = keys
+}
+
+// load reads and parses the JWKS
+func (a *JWTAuthenticator) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if a.opts.JWKSFile != "" {
+		data, err := os.ReadFile(a.opts.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the jwks: %w", err)
+		}
+		return parseJWKS(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.opts.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch the jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the jwks: %w", err)
+	}
+	return parseJWKS(data)
+}
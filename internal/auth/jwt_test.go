@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testJWK returns the JWK of a public key
+func testJWK(t *testing.T, kid string, key crypto.PublicKey) map[string]string {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": encode(k.N.Bytes()), "e": encode(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(k.X.FillBytes(make([]byte, 32))), "y": encode(k.Y.FillBytes(make([]byte, 32)))}
+	}
+	t.Fatalf("unexpected key %T", key)
+	return nil
+}
+
+// writeJWKS writes the JWKS of the keys to the file
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	ctx := context.Background()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, testJWK(t, "rsa", &rsaKey.PublicKey), testJWK(t, "ec", &ecKey.PublicKey),
+		map[string]string{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"})
+
+	authenticator, err := NewJWTAuthenticator(ctx, JWTOptions{
+		JWKSFile:        jwksFile,
+		RefreshInterval: time.Hour,
+		Issuer:          "https://idp.example.com",
+		Audience:        "argus",
+		ClockSkew:       time.Minute,
+		ScopesClaim:     "scope",
+		TenantClaim:     "tenant",
+	})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    "https://idp.example.com",
+			"aud":    []string{"argus", "other"},
+			"sub":    "inventory-service",
+			"exp":    now.Add(time.Hour).Unix(),
+			"scope":  "agents:read export unknown",
+			"tenant": "acme",
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+	withClaim := func(name string, value any) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name            string
+		token           string
+		expectedScopes  []string
+		expectedInvalid bool
+	}{
+		{
+			name:           "RSA Token",
+			token:          sign(jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()),
+			expectedScopes: []string{ScopeAgentsRead, ScopeExport},
+		},
+		{
+			name:           "EC Token With Scopes Array",
+			token:          sign(jwt.SigningMethodES256, "ec", ecKey, withClaim("scope", []string{"agents:write"})),
+			expectedScopes: []string{ScopeAgentsWrite},
+		},
+		{
+			name:           "Admin Of Another Tenant",
+			token:          sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("scope", "admin agents:read")),
+			expectedScopes: []string{ScopeAgentsRead},
+		},
+		{
+			name:           "Expired Within Clock Skew",
+			token:          sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("exp", now.Add(-30*time.Second).Unix())),
+			expectedScopes: []string{ScopeAgentsRead, ScopeExport},
+		},
+		{
+			name:            "Expired",
+			token:           sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("exp", now.Add(-2*time.Minute).Unix())),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Without Expiry",
+			token:           sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("exp", nil)),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Not Valid Yet",
+			token:           sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("nbf", now.Add(2*time.Minute).Unix())),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Wrong Issuer",
+			token:           sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("iss", "https://evil.example.com")),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Wrong Audience",
+			token:           sign(jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("aud", "other")),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Wrong Signature",
+			token:           sign(jwt.SigningMethodRS256, "rsa", otherKey, validClaims()),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Unknown Key",
+			token:           sign(jwt.SigningMethodRS256, "unknown", otherKey, validClaims()),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Symmetric Algorithm",
+			token:           sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), validClaims()),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Malformed",
+			token:           "not.a.token",
+			expectedInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(ctx, tt.token)
+			if tt.expectedInvalid {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "token:inventory-service", principal.Subject)
+			assert.Equal(t, "acme", principal.Tenant)
+			assert.Equal(t, tt.expectedScopes, principal.Scopes)
+			assert.Nil(t, principal.APIKey)
+		})
+	}
+
+	// The rotated keys are loaded for the tokens of unknown keys
+	writeJWKS(t, jwksFile, testJWK(t, "rotated", &otherKey.PublicKey))
+	authenticator.now = func() time.Time { return now.Add(MinJWKSRefreshInterval) }
+	_, err = authenticator.Authenticate(ctx, sign(jwt.SigningMethodRS256, "rotated", otherKey, validClaims()))
+	assert.NoError(t, err)
+	_, err = authenticator.Authenticate(ctx, sign(jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidToken, "the removed keys should not be accepted")
+}
+
+func TestJWTAuthenticator_URL(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{testJWK(t, "", &key.PublicKey)}})
+	}))
+	defer server.Close()
+
+	opts := JWTOptions{JWKSURL: server.URL, RefreshInterval: time.Minute, Issuer: "issuer", Audience: "argus", ScopesClaim: "scp"}
+	authenticator, err := NewJWTAuthenticator(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// A token without a key id is verified by the only key
+	now := time.Now()
+	claims := jwt.MapClaims{"iss": "issuer", "aud": "argus", "sub": "svc", "exp": now.Add(time.Hour).Unix(), "scp": []string{"admin"}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	assert.NoError(t, err)
+
+	principal, err := authenticator.Authenticate(ctx, token)
+	assert.NoError(t, err)
+	assert.True(t, principal.HasScope(ScopeAgentsDelete))
+	assert.Empty(t, principal.Tenant)
+
+	// The keys are reloaded periodically, the loaded keys are kept if the JWKS is not available
+	failing.Store(true)
+	authenticator.now = func() time.Time { return now.Add(2 * time.Minute) }
+	_, err = authenticator.Authenticate(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+	_, err = authenticator.Authenticate(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load(), "the failed reload should not be retried before the interval")
+
+	// The JWKS should be available at the start
+	_, err = NewJWTAuthenticator(ctx, opts)
+	assert.Error(t, err)
+	_, err = NewJWTAuthenticator(ctx, JWTOptions{JWKSURL: server.URL, JWKSFile: "jwks.json", Issuer: "issuer", Audience: "argus"})
+	assert.Error(t, err)
+	_, err = NewJWTAuthenticator(ctx, JWTOptions{JWKSURL: server.URL})
+	assert.Error(t, err, "the issuer and the audience should be required")
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"crypto/x509"
+	"slices"
+)
+
+// Principal is the authenticated client of a request, by an API key, a bearer token or a client certificate
+type Principal struct {
+	// Subject identifies the client, e.g. api_key:1a2b3c4d, token:<subject of the token> or cert:CN=inventory
+	Subject string
+	Scopes  []string
+	// Tenant of the client, it is empty if the client is not bound to a tenant
+	Tenant string
+	// APIKey is the key of the client, it is nil if the client is not authenticated by an API key
+	APIKey *db.APIKey
+}
+
+// NewAPIKeyPrincipal returns the principal authenticated by the API key, the admin scope is ignored for the keys of
+// the tenants other than the default one
+func NewAPIKeyPrincipal(key *db.APIKey) *Principal {
+	subject := "api_key:" + key.Prefix
+	if key.ID == 0 {
+		subject = "api_key:" + key.Name
+	}
+	return &Principal{Subject: subject, Scopes: scopesOfTenant(key.TenantID, key.Scopes), Tenant: key.TenantID, APIKey: key}
+}
+
+// HasScope reports whether the principal is granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// NewClientCertPrincipal returns the principal authenticated by a verified client certificate, the certificate only
+// identifies the client, so it is granted the given scopes
+func NewClientCertPrincipal(cert *x509.Certificate, scopes []string) *Principal {
+	return &Principal{Subject: "cert:" + cert.Subject.String(), Scopes: scopes}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrincipal_HasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   db.Scopes
+		tenant   string
+		scope    string
+		expected bool
+	}{
+		{name: "Granted", scopes: db.Scopes{ScopeAgentsRead, ScopeExport}, scope: ScopeExport, expected: true},
+		{name: "Not Granted", scopes: db.Scopes{ScopeAgentsRead}, scope: ScopeAgentsWrite, expected: false},
+		{name: "No Scopes", scope: ScopeAgentsRead, expected: false},
+		{name: "Admin", scopes: db.Scopes{ScopeAdmin}, scope: ScopeAgentsDelete, expected: true},
+		{name: "Bootstrap Key", scopes: BootstrapAPIKey.Scopes, scope: ScopeAdmin, expected: true},
+		{name: "Admin Of Default Tenant", scopes: db.Scopes{ScopeAdmin}, tenant: db.DefaultTenant, scope: ScopeAdmin, expected: true},
+		{name: "Admin Of Another Tenant", scopes: db.Scopes{ScopeAdmin}, tenant: "acme", scope: ScopeAdmin, expected: false},
+		{name: "Admin And Read Of Another Tenant", scopes: db.Scopes{ScopeAdmin, ScopeAgentsRead}, tenant: "acme", scope: ScopeAgentsRead, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewAPIKeyPrincipal(&db.APIKey{Scopes: tt.scopes, TenantID: tt.tenant}).HasScope(tt.scope))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"slices"
+)
+
+// Scopes of the API keys
+const (
+	ScopeAgentsRead   = "agents:read"
+	ScopeAgentsWrite  = "agents:write"
+	ScopeAgentsDelete = "agents:delete"
+	ScopeExport       = "export"
+	// ScopeAdmin grants every other scope too, it is only granted to the clients of the default tenant as the
+	// admin APIs are not restricted to a tenant
+	ScopeAdmin = "admin"
+)
+
+// Scopes are all the scopes which can be granted to the API keys
+var Scopes = []string{ScopeAgentsRead, ScopeAgentsWrite, ScopeAgentsDelete, ScopeExport, ScopeAdmin}
+
+// DefaultScopes are granted to the API keys created without scopes
+var DefaultScopes = []string{ScopeAgentsRead}
+
+// IsValidScope reports whether the scope is one of Scopes
+func IsValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// CanGrantAdmin reports whether the admin scope can be granted to the clients of the tenant, an empty tenant is the
+// default one
+func CanGrantAdmin(tenant string) bool {
+	return tenant == "" || tenant == db.DefaultTenant
+}
+
+// scopesOfTenant returns the scopes of a client of the tenant without the admin scope if it cannot be granted to them
+func scopesOfTenant(tenant string, scopes []string) []string {
+	if CanGrantAdmin(tenant) || !slices.Contains(scopes, ScopeAdmin) {
+		return scopes
+	}
+	return slices.DeleteFunc(slices.Clone(scopes), func(scope string) bool { return scope == ScopeAdmin })
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the signed requests
+const (
+	SignatureHeader = "X-Argus-Signature"
+	TimestampHeader = "X-Argus-Timestamp"
+	NonceHeader     = "X-Argus-Nonce"
+)
+
+// MaxNonceLength is the maximum length of the nonces of the signed requests
+const MaxNonceLength = 128
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// GenerateSigningSecret creates a random secret signing the requests of an API key
+func GenerateSigningSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignRequest returns the signature of a request, which is the hex encoded HMAC-SHA256 of the lines
+//
+//	METHOD
+//	/request/uri?with=query
+//	timestamp in unix seconds
+//	nonce
+//	hex encoded SHA-256 of the body
+func SignRequest(secret string, method string, uri string, timestamp string, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedRequest is a request signed by the signing secret of an API key
+type SignedRequest struct {
+	Method    string
+	URI       string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Body      []byte
+}
+
+// SignatureVerifier verifies the signed requests, the requests are accepted if their timestamp is at most maxSkew
+// away from now and their nonce is not used by the key before
+type SignatureVerifier struct {
+	db      db.DB
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewSignatureVerifier creates a verifier accepting the timestamps at most maxSkew away from now
+func NewSignatureVerifier(database db.DB, maxSkew time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{
+		db:      database,
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// Verify checks the signed request of the key, ErrInvalidSignature is returned for the requests which should be
+// rejected. Other errors mean the request cannot be checked.
+func (v *SignatureVerifier) Verify(ctx context.Context, key *db.APIKey, req SignedRequest) error {
+	if key.Signing.SigningSecret == "" {
+		return fmt.Errorf("%w: the api key has no signing secret", ErrInvalidSignature)
+	}
+	if req.Nonce == "" || len(req.Nonce) > MaxNonceLength {
+		return fmt.Errorf("%w: the nonce should have 1 to %d characters", ErrInvalidSignature, MaxNonceLength)
+	}
+
+	unix, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: the timestamp should be in unix seconds", ErrInvalidSignature)
+	}
+	now := v.now()
+	if skew := now.Sub(time.Unix(unix, 0)).Abs(); skew > v.maxSkew {
+		return fmt.Errorf("%w: the timestamp is stale", ErrInvalidSignature)
+	}
+
+	expected := SignRequest(key.Signing.SigningSecret, req.Method, req.URI, req.Timestamp, req.Nonce, req.Body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Signature))) {
+		return ErrInvalidSignature
+	}
+
+	// The nonce is only kept while its timestamp is accepted, the request cannot be replayed after it anyway
+	fresh, err := v.db.UseNonce(ctx, key.ID, req.Nonce, time.Unix(unix, 0).Add(v.maxSkew))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return fmt.Errorf("%w: the nonce is used before", ErrInvalidSignature)
+	}
+	v.sweep(now)
+
+	return nil
+}
+
+// sweep deletes the expired nonces in the background, at most once per maxSkew
+func (v *SignatureVerifier) sweep(now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.lastSweep) < v.maxSkew {
+		return
+	}
+	v.lastSweep = now
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, err := v.db.DeleteExpiredNonces(ctx, now); err != nil {
+			logger.WithError(err).Warn("cannot delete the expired nonces")
+		}
+	}()
+}
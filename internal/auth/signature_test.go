@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"argus/internal/db"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func (f *fakeDB) UseNonce(ctx context.Context, apiKeyID uint, nonce string, expiresAt time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.nonces == nil {
+		f.nonces = map[string]time.Time{}
+	}
+	key := fmt.Sprintf("%d:%s", apiKeyID, nonce)
+	if _, ok := f.nonces[key]; ok {
+		return false, nil
+	}
+	f.nonces[key] = expiresAt
+	return true, nil
+}
+
+func (f *fakeDB) DeleteExpiredNonces(ctx context.Context, now time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	for key, expiresAt := range f.nonces {
+		if !expiresAt.After(now) {
+			delete(f.nonces, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	ctx := context.Background()
+
+	secret, err := GenerateSigningSecret()
+	assert.NoError(t, err)
+	key := &db.APIKey{ID: 1, Signing: db.APIKeySigning{SigningSecret: secret}}
+
+	now := time.Now()
+	verifier := NewSignatureVerifier(&fakeDB{}, 5*time.Minute)
+	verifier.now = func() time.Time { return now }
+
+	body := []byte(`{"ip_address":"8.8.8.8"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signed := func(nonce string) SignedRequest {
+		return SignedRequest{
+			Method:    "POST",
+			URI:       "/api/v1/agents?async=true",
+			Timestamp: timestamp,
+			Nonce:     nonce,
+			Signature: SignRequest(secret, "POST", "/api/v1/agents?async=true", timestamp, nonce, body),
+			Body:      body,
+		}
+	}
+	tampered := func(tamper func(r *SignedRequest)) SignedRequest {
+		req := signed("tampered")
+		tamper(&req)
+		return req
+	}
+
+	tests := []struct {
+		name            string
+		key             *db.APIKey
+		req             SignedRequest
+		expectedInvalid bool
+	}{
+		{
+			name: "Signed Request",
+			key:  key,
+			req:  signed("first"),
+		},
+		{
+			name:            "Replayed Request",
+			key:             key,
+			req:             signed("first"),
+			expectedInvalid: true,
+		},
+		{
+			name: "Same Nonce Of Another Key",
+			key:  &db.APIKey{ID: 2, Signing: key.Signing},
+			req:  signed("first"),
+		},
+		{
+			name:            "Tampered Body",
+			key:             key,
+			req:             tampered(func(r *SignedRequest) { r.Body = []byte(`{"ip_address":"1.1.1.1"}`) }),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Tampered Path",
+			key:             key,
+			req:             tampered(func(r *SignedRequest) { r.URI = "/api/v1/agents" }),
+			expectedInvalid: true,
+		},
+		{
+			name: "Stale Timestamp",
+			key:  key,
+			req: tampered(func(r *SignedRequest) {
+				r.Timestamp = strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+				r.Signature = SignRequest(secret, r.Method, r.URI, r.Timestamp, r.Nonce, r.Body)
+			}),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Invalid Timestamp",
+			key:             key,
+			req:             tampered(func(r *SignedRequest) { r.Timestamp = "yesterday" }),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Without Nonce",
+			key:             key,
+			req:             signed(""),
+			expectedInvalid: true,
+		},
+		{
+			name:            "Key Without Signing Secret",
+			key:             &db.APIKey{ID: 3},
+			req:             signed("other"),
+			expectedInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(ctx, tt.key, tt.req)
+			if tt.expectedInvalid {
+				assert.ErrorIs(t, err, ErrInvalidSignature)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
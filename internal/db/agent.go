@@ -3,25 +3,120 @@ package db
 import (
 	tracing "argus/pkg/otel"
 	"context"
+	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	ErrAgentNotFound   = errors.New("agent not found")
+	ErrInvalidSort     = errors.New("invalid sort field")
+	ErrInvalidPageSize = errors.New("invalid page size")
+)
+
 // Agent contains data for each agent request
 type Agent struct {
-	ID        uint `gorm:"primarykey"`
-	CreatedAt time.Time
-	IPAddress string `gorm:"index,not null"`
-	ASN       string
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	TenantID  string    `gorm:"index;not null;default:'default'"`
+	IPAddress string    `gorm:"index,not null"`
+	ASN       string    `gorm:"index"`
 	ISP       string
-	City      string
-	Country   string
+	City      string `gorm:"index"`
+	Region    string
+	Country   string `gorm:"index"`
 	Location  string
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	// EnrichmentStatus is pending until the stats of the IP address are gathered asynchronously
+	EnrichmentStatus string `gorm:"index;not null;default:'completed'"`
 }
 
+// Enrichment statuses of the agents
+const (
+	EnrichmentPending   = "pending"
+	EnrichmentCompleted = "completed"
+	EnrichmentFailed    = "failed"
+)
+
+// AgentFilter filters the agents, multi-value fields match any of their values
 type AgentFilter struct {
 	IPAddress *string
+	Countries []string
+	Cities    []string
+	Regions   []string
+	ASNs      []string
+	// ISP matches the agents with ISP containing this value, case-insensitively
+	ISP *string
+	// CreatedAfter is inclusive, while CreatedBefore is exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Query is an arbitrary query created by ParseAgentQuery
+	Query *AgentQuery
+
+	IncludeDeleted bool
+}
+
+// IsEmpty reports whether the filter matches all the agents
+func (f *AgentFilter) IsEmpty() bool {
+	return f == nil ||
+		f.IPAddress == nil &&
+			len(f.Countries) == 0 &&
+			len(f.Cities) == 0 &&
+			len(f.Regions) == 0 &&
+			len(f.ASNs) == 0 &&
+			f.ISP == nil &&
+			f.CreatedAfter == nil &&
+			f.CreatedBefore == nil &&
+			f.Query == nil
+}
+
+// applyAgentFilter adds the conditions of the filter to the query
+func applyAgentFilter(query *gorm.DB, filter *AgentFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+	if filter.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if filter.IPAddress != nil {
+		query = query.Where("agents.ip_address = ?", *filter.IPAddress)
+	}
+	if len(filter.Countries) > 0 {
+		query = query.Where("agents.country IN ?", filter.Countries)
+	}
+	if len(filter.Cities) > 0 {
+		query = query.Where("agents.city IN ?", filter.Cities)
+	}
+	if len(filter.Regions) > 0 {
+		query = query.Where("agents.region IN ?", filter.Regions)
+	}
+	if len(filter.ASNs) > 0 {
+		query = query.Where("agents.asn IN ?", filter.ASNs)
+	}
+	if filter.ISP != nil {
+		query = query.Where("agents.isp ILIKE ?", "%"+escapeLike(*filter.ISP)+"%")
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("agents.created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("agents.created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.Query != nil {
+		query = query.Where(filter.Query.sql, filter.Query.args...)
+	}
+
+	return query
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 type AgentSort struct {
@@ -29,6 +124,50 @@ type AgentSort struct {
 	OrderBy *string
 }
 
+// agentSortColumn describes a column which agents can be sorted by
+type agentSortColumn struct {
+	// column is the qualified name of the column, it is safe to be used in raw SQL
+	column string
+	// value returns the value of the column for an agent in its cursor representation
+	value func(a *Agent) string
+	// parse converts the cursor representation of a value to a query argument
+	parse func(v string) (any, error)
+}
+
+// agentSortColumns is the allow-list of the fields agents can be sorted by
+var agentSortColumns = map[string]agentSortColumn{
+	"id": {
+		column: "agents.id",
+		value:  func(a *Agent) string { return strconv.FormatUint(uint64(a.ID), 10) },
+		parse:  func(v string) (any, error) { return strconv.ParseUint(v, 10, 0) },
+	},
+	"created_at": {
+		column: "agents.created_at",
+		value:  func(a *Agent) string { return a.CreatedAt.Format(time.RFC3339Nano) },
+		parse:  func(v string) (any, error) { return time.Parse(time.RFC3339Nano, v) },
+	},
+	"country": {
+		column: "agents.country",
+		value:  func(a *Agent) string { return a.Country },
+		parse:  parseStringSortValue,
+	},
+	"asn": {
+		column: "agents.asn",
+		value:  func(a *Agent) string { return a.ASN },
+		parse:  parseStringSortValue,
+	},
+	"city": {
+		column: "agents.city",
+		value:  func(a *Agent) string { return a.City },
+		parse:  parseStringSortValue,
+	},
+}
+
+// parseStringSortValue uses the cursor representation of a string column as it is
+func parseStringSortValue(v string) (any, error) {
+	return v, nil
+}
+
 type AgentsResult struct {
 	Agents      []Agent
 	TotalAgents int64
@@ -40,25 +179,59 @@ func (gdb *GormDB) CreateNewAgent(ctx context.Context, a *Agent) (*Agent, error)
 	defer span.End()
 
 	a.CreatedAt = time.Now()
+	a.TenantID = TenantFromContext(ctx)
 
-	return a, gdb.db.Create(a).Error
+	return a, gdb.db.WithContext(ctx).Create(a).Error
+}
+
+// CreateAgents creates the agents in the database using multi-row inserts of batchSize agents
+func (gdb *GormDB) CreateAgents(ctx context.Context, agents []*Agent, batchSize int) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CreateAgents")
+	defer span.End()
+
+	now := time.Now()
+	tenantID := TenantFromContext(ctx)
+	for _, a := range agents {
+		a.CreatedAt = now
+		a.TenantID = tenantID
+	}
+
+	return gdb.db.WithContext(ctx).CreateInBatches(agents, batchSize).Error
+}
+
+// FindExistingIPAddresses returns the IP addresses which already have an agent, deleted agents are ignored
+func (gdb *GormDB) FindExistingIPAddresses(ctx context.Context, ipAddresses []string) ([]string, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "FindExistingIPAddresses")
+	defer span.End()
+
+	var existing []string
+	if len(ipAddresses) == 0 {
+		return existing, nil
+	}
+
+	return existing, gdb.db.WithContext(ctx).
+		Model(&Agent{}).
+		Scopes(scopeTenant(ctx, "agents")).
+		Distinct("ip_address").
+		Where("ip_address IN ?", ipAddresses).
+		Pluck("ip_address", &existing).Error
 }
 
 func (gdb *GormDB) GetAllAgents(ctx context.Context, filter *AgentFilter, page int, pageSize int, sort *AgentSort) (*AgentsResult, error) {
 	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAllAgents")
 	defer span.End()
 
+	if page < 1 || pageSize < 1 {
+		return nil, ErrInvalidPageSize
+	}
+
 	var agents []Agent
 	var count int64
 
-	query := gdb.db.Model(&Agent{})
+	query := gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents"))
 
 	// Apply filters
-	if filter != nil {
-		if filter.IPAddress != nil {
-			query.Where("ip_address = ?", filter.IPAddress)
-		}
-	}
+	query = applyAgentFilter(query, filter)
 
 	// Calculate the number of campaigns
 	err := query.Count(&count).Error
@@ -70,13 +243,20 @@ func (gdb *GormDB) GetAllAgents(ctx context.Context, filter *AgentFilter, page i
 	offset := (page - 1) * pageSize
 	query = query.Offset(offset).Limit(pageSize)
 
-	// Handle sort
+	// Handle sort, only the allow-listed columns and orders are used in the raw SQL
 	if sort != nil && sort.SortBy != nil {
+		sortColumn, ok := agentSortColumns[*sort.SortBy]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
 		orderBy := "desc"
 		if sort.OrderBy != nil {
 			orderBy = *sort.OrderBy
 		}
-		query = query.Order(fmt.Sprintf("%s %s", *sort.SortBy, orderBy))
+		if orderBy != "asc" && orderBy != "desc" {
+			return nil, ErrInvalidSort
+		}
+		query = query.Order(fmt.Sprintf("%s %s", sortColumn.column, orderBy))
 	}
 	query.Order("agents.id")
 
@@ -92,10 +272,151 @@ func (gdb *GormDB) GetAllAgents(ctx context.Context, filter *AgentFilter, page i
 	}, nil
 }
 
+// FindAgentsInBatches calls fn with the agents matching the filter in batches, ordered by their ID.
+// Only one batch is kept in memory, it stops at the first error of fn or when the context is done.
+func (gdb *GormDB) FindAgentsInBatches(ctx context.Context, filter *AgentFilter, batchSize int, fn func(agents []Agent) error) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "FindAgentsInBatches")
+	defer span.End()
+
+	var agents []Agent
+	return applyAgentFilter(gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter).
+		FindInBatches(&agents, batchSize, func(tx *gorm.DB, batch int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(agents)
+		}).Error
+}
+
+// UpdateAgent stores the enrichment data of an existing agent
+func (gdb *GormDB) UpdateAgent(ctx context.Context, a *Agent) (*Agent, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UpdateAgent")
+	defer span.End()
+
+	return a, gdb.db.WithContext(ctx).
+		Model(a).
+		Scopes(scopeTenant(ctx, "agents")).
+		Select("ip_address", "asn", "isp", "city", "region", "country", "location", "enrichment_status").
+		Updates(a).Error
+}
+
 func (gdb *GormDB) GetAgentByID(ctx context.Context, agentID uint) (*Agent, error) {
 	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAgentByID")
 	defer span.End()
 
 	var agent Agent
-	return &agent, gdb.db.Where("id = ?", agentID).First(&agent).Error
+	return &agent, gdb.db.WithContext(ctx).Scopes(scopeTenant(ctx, "agents")).Where("id = ?", agentID).First(&agent).Error
+}
+
+// DeleteAgent soft deletes the agent, so it is excluded from the queries unless it is restored
+func (gdb *GormDB) DeleteAgent(ctx context.Context, agentID uint) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "DeleteAgent")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).Scopes(scopeTenant(ctx, "agents")).Delete(&Agent{}, agentID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAgentNotFound
+	}
+
+	return nil
+}
+
+// RestoreAgent brings back a soft deleted agent, restoring an agent which is not deleted has no effect
+func (gdb *GormDB) RestoreAgent(ctx context.Context, agentID uint) (*Agent, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "RestoreAgent")
+	defer span.End()
+
+	var agent Agent
+	err := gdb.db.WithContext(ctx).Unscoped().Scopes(scopeTenant(ctx, "agents")).Where("id = ?", agentID).First(&agent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAgentNotFound
+		}
+		return nil, err
+	}
+	if !agent.DeletedAt.Valid {
+		return &agent, nil
+	}
+
+	agent.DeletedAt = gorm.DeletedAt{}
+	err = gdb.db.WithContext(ctx).Unscoped().Model(&agent).Update("deleted_at", nil).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &agent, nil
+}
+
+// PurgeAgent permanently deletes the agent, whether it is soft deleted or not
+func (gdb *GormDB) PurgeAgent(ctx context.Context, agentID uint) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "PurgeAgent")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).Unscoped().Scopes(scopeTenant(ctx, "agents")).Delete(&Agent{}, agentID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAgentNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeletedAgents permanently deletes the agents which were soft deleted before the given time, it returns the
+// number of purged agents
+func (gdb *GormDB) PurgeDeletedAgents(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "PurgeDeletedAgents")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).
+		Unscoped().
+		Scopes(scopeTenant(ctx, "agents")).
+		Where("agents.deleted_at < ?", deletedBefore).
+		Delete(&Agent{})
+
+	return result.RowsAffected, result.Error
+}
+
+// BulkDeleteAgents soft deletes all the agents matching the filter.
+// Agents are deleted in chunks, each one in its own transaction, to avoid long-running locks on the table.
+// It returns the IDs of the deleted agents, even if one of the chunks fails.
+func (gdb *GormDB) BulkDeleteAgents(ctx context.Context, filter *AgentFilter, chunkSize int) ([]uint, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "BulkDeleteAgents")
+	defer span.End()
+
+	// Deleted agents cannot be deleted again
+	activeFilter := AgentFilter{}
+	if filter != nil {
+		activeFilter = *filter
+	}
+	activeFilter.IncludeDeleted = false
+
+	var deleted []uint
+	for {
+		// The chunk is locked, so all of its agents are deleted
+		var ids []uint
+		err := gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := applyAgentFilter(tx.Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), &activeFilter).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Order("id").
+				Limit(chunkSize).
+				Pluck("id", &ids).Error
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+
+			return tx.Delete(&Agent{}, ids).Error
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, ids...)
+		if len(ids) < chunkSize {
+			return deleted, nil
+		}
+	}
 }
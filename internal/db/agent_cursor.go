@@ -0,0 +1,183 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"slices"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// AgentCursor points to an agent in a sorted list of agents
+type AgentCursor struct {
+	SortBy   string `json:"s"`
+	OrderBy  string `json:"o"`
+	Value    string `json:"v"`
+	ID       uint   `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Encode converts the cursor to an opaque string
+func (c AgentCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeAgentCursor parses an opaque cursor created by AgentCursor.Encode
+func DecodeAgentCursor(s string) (*AgentCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor AgentCursor
+	if err = json.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+type AgentsPage struct {
+	Agents     []Agent
+	NextCursor *AgentCursor
+	PrevCursor *AgentCursor
+}
+
+// GetAgentsPage retrieves a page of agents using keyset pagination.
+// The page starts right after (or before, for backward cursors) the agent the cursor points to,
+// a nil cursor means the first page.
+func (gdb *GormDB) GetAgentsPage(ctx context.Context, filter *AgentFilter, cursor *AgentCursor, limit int, sort *AgentSort) (*AgentsPage, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAgentsPage")
+	defer span.End()
+
+	// A page has at least one agent, so the extra agent fetched below tells whether there is another page
+	if limit < 1 {
+		return nil, ErrInvalidPageSize
+	}
+
+	// Resolve the sort, it is the same as the one in GetAllAgents
+	sortBy, orderBy := "id", "asc"
+	if sort != nil && sort.SortBy != nil {
+		sortBy, orderBy = *sort.SortBy, "desc"
+		if sort.OrderBy != nil {
+			orderBy = *sort.OrderBy
+		}
+	}
+	sortColumn, ok := agentSortColumns[sortBy]
+	if !ok || !slices.Contains([]string{"asc", "desc"}, orderBy) {
+		return nil, ErrInvalidSort
+	}
+
+	query := applyAgentFilter(gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter)
+
+	// Seek to the position of the cursor
+	backward := cursor != nil && cursor.Backward
+	direction := orderBy
+	if backward {
+		direction = map[string]string{"asc": "desc", "desc": "asc"}[orderBy]
+	}
+	if cursor != nil {
+		if cursor.SortBy != sortBy || cursor.OrderBy != orderBy {
+			return nil, ErrInvalidCursor
+		}
+		value, err := sortColumn.parse(cursor.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		operator := ">"
+		if direction == "desc" {
+			operator = "<"
+		}
+		if sortBy == "id" {
+			query = query.Where(fmt.Sprintf("agents.id %s ?", operator), value)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s, agents.id) %s (?, ?)", sortColumn.column, operator), value, cursor.ID)
+		}
+	}
+
+	// Fetch one more agent to know whether there is another page
+	if sortBy != "id" {
+		query = query.Order(fmt.Sprintf("%s %s", sortColumn.column, direction))
+	}
+	query = query.Order(fmt.Sprintf("agents.id %s", direction)).Limit(limit + 1)
+
+	var agents []Agent
+	err := query.Find(&agents).Error
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(agents) > limit
+	if hasMore {
+		agents = agents[:limit]
+	}
+	if backward {
+		slices.Reverse(agents)
+	}
+
+	page := &AgentsPage{Agents: agents}
+	if len(agents) == 0 {
+		return page, nil
+	}
+	cursorOf := func(a *Agent, backward bool) *AgentCursor {
+		return &AgentCursor{
+			SortBy:   sortBy,
+			OrderBy:  orderBy,
+			Value:    sortColumn.value(a),
+			ID:       a.ID,
+			Backward: backward,
+		}
+	}
+	if (!backward && hasMore) || (backward && cursor != nil) {
+		page.NextCursor = cursorOf(&agents[len(agents)-1], false)
+	}
+	if (!backward && cursor != nil) || (backward && hasMore) {
+		page.PrevCursor = cursorOf(&agents[0], true)
+	}
+
+	return page, nil
+}
+
+// CountAgents counts the agents matching the filter
+func (gdb *GormDB) CountAgents(ctx context.Context, filter *AgentFilter) (int64, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CountAgents")
+	defer span.End()
+
+	var count int64
+	return count, applyAgentFilter(gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter).Count(&count).Error
+}
+
+// EstimateAgentsCount returns the number of agents matching the filter estimated by the Postgres planner,
+// it is much cheaper than CountAgents on big tables, but it is not exact.
+func (gdb *GormDB) EstimateAgentsCount(ctx context.Context, filter *AgentFilter) (int64, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "EstimateAgentsCount")
+	defer span.End()
+
+	query := applyAgentFilter(gdb.db.Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter).Select("agents.id")
+
+	var plan string
+	err := gdb.db.WithContext(ctx).Raw("EXPLAIN (FORMAT JSON) ?", query).Row().Scan(&plan)
+	if err != nil {
+		return 0, err
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err = json.Unmarshal([]byte(plan), &explained); err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, errors.New("empty query plan")
+	}
+
+	return int64(explained[0].Plan.Rows), nil
+}
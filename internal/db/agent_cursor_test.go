@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAgentCursorEncoding(t *testing.T) {
+	cursor := AgentCursor{
+		SortBy:   "id",
+		OrderBy:  "asc",
+		Value:    "42",
+		ID:       42,
+		Backward: true,
+	}
+
+	decoded, err := DecodeAgentCursor(cursor.Encode())
+	assert.NoError(t, err, "error decoding cursor")
+	assert.Equal(t, cursor, *decoded, "decoded cursor should match")
+
+	_, err = DecodeAgentCursor("not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestGetAgentsPage(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing
+	ipAddress := "192.168.1.106"
+	var ids []uint
+	for i := 0; i < 5; i++ {
+		createdAgent, err := tdb.CreateNewAgent(ctx, &Agent{
+			IPAddress: ipAddress,
+		})
+		assert.NoError(t, err, "error creating new agent")
+		ids = append(ids, createdAgent.ID)
+	}
+	filter := &AgentFilter{IPAddress: &ipAddress}
+
+	// Pages without agents are invalid
+	for _, limit := range []int{0, -1, -5} {
+		_, err := tdb.GetAgentsPage(ctx, filter, nil, limit, nil)
+		assert.ErrorIs(t, err, ErrInvalidPageSize)
+	}
+
+	// First page
+	page, err := tdb.GetAgentsPage(ctx, filter, nil, 2, nil)
+	assert.NoError(t, err, "error fetching first page")
+	assert.Len(t, page.Agents, 2)
+	assert.Equal(t, ids[0], page.Agents[0].ID)
+	assert.Nil(t, page.PrevCursor, "first page should not have a previous page")
+	assert.NotNil(t, page.NextCursor, "first page should have a next page")
+
+	// Second page
+	page, err = tdb.GetAgentsPage(ctx, filter, page.NextCursor, 2, nil)
+	assert.NoError(t, err, "error fetching second page")
+	assert.Len(t, page.Agents, 2)
+	assert.Equal(t, ids[2], page.Agents[0].ID)
+	assert.NotNil(t, page.PrevCursor, "second page should have a previous page")
+	assert.NotNil(t, page.NextCursor, "second page should have a next page")
+	prevCursor := page.PrevCursor
+
+	// Last page
+	page, err = tdb.GetAgentsPage(ctx, filter, page.NextCursor, 2, nil)
+	assert.NoError(t, err, "error fetching last page")
+	assert.Len(t, page.Agents, 1)
+	assert.Equal(t, ids[4], page.Agents[0].ID)
+	assert.Nil(t, page.NextCursor, "last page should not have a next page")
+
+	// Going back to the first page
+	page, err = tdb.GetAgentsPage(ctx, filter, prevCursor, 2, nil)
+	assert.NoError(t, err, "error fetching previous page")
+	assert.Len(t, page.Agents, 2)
+	assert.Equal(t, ids[0], page.Agents[0].ID)
+	assert.Equal(t, ids[1], page.Agents[1].ID)
+	assert.Nil(t, page.PrevCursor, "first page should not have a previous page")
+
+	// Cursors cannot be used with another sort
+	sortBy, orderBy := "id", "desc"
+	_, err = tdb.GetAgentsPage(ctx, filter, prevCursor, 2, &AgentSort{SortBy: &sortBy, OrderBy: &orderBy})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Counting the agents
+	count, err := tdb.CountAgents(ctx, filter)
+	assert.NoError(t, err, "error counting agents")
+	assert.Equal(t, int64(5), count)
+	_, err = tdb.EstimateAgentsCount(ctx, filter)
+	assert.NoError(t, err, "error estimating agents count")
+}
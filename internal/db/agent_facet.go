@@ -0,0 +1,54 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+)
+
+var ErrInvalidFacet = errors.New("invalid facet field")
+
+// agentFacetColumns is the allow-list of the fields agents can be faceted by
+var agentFacetColumns = map[string]string{
+	"country": "agents.country",
+	"asn":     "agents.asn",
+	"isp":     "agents.isp",
+	"city":    "agents.city",
+	"region":  "agents.region",
+}
+
+// FacetValue is the number of agents having a value
+type FacetValue struct {
+	Value string
+	Count int64
+}
+
+// GetAgentFacets counts the agents matching the filter by the values of each field.
+// Only the limit most frequent values of each field are returned.
+func (gdb *GormDB) GetAgentFacets(ctx context.Context, filter *AgentFilter, fields []string, limit int) (map[string][]FacetValue, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAgentFacets")
+	defer span.End()
+
+	facets := make(map[string][]FacetValue, len(fields))
+	for _, field := range fields {
+		column, ok := agentFacetColumns[field]
+		if !ok {
+			return nil, ErrInvalidFacet
+		}
+
+		var values []FacetValue
+		err := applyAgentFilter(gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter).
+			Select(column + " AS value, COUNT(*) AS count").
+			Group(column).
+			Order("count DESC, value").
+			Limit(limit).
+			Scan(&values).Error
+		if err != nil {
+			return nil, err
+		}
+		facets[field] = values
+	}
+
+	return facets, nil
+}
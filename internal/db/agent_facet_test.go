@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetAgentFacets(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing
+	region := "Facet Region"
+	for _, a := range []*Agent{
+		{IPAddress: "192.168.3.1", Region: region, Country: "DE", ASN: "AS3320"},
+		{IPAddress: "192.168.3.2", Region: region, Country: "DE", ASN: "AS3209"},
+		{IPAddress: "192.168.3.3", Region: region, Country: "FR", ASN: "AS3320"},
+		{IPAddress: "192.168.3.4", Region: region, Country: "DE", ASN: "AS3320"},
+	} {
+		_, err := tdb.CreateNewAgent(ctx, a)
+		assert.NoError(t, err, "error creating new agent")
+	}
+	filter := &AgentFilter{Regions: []string{region}}
+
+	// Count the values
+	facets, err := tdb.GetAgentFacets(ctx, filter, []string{"country", "asn"}, 10)
+	assert.NoError(t, err, "error counting facets")
+	assert.Equal(t, []FacetValue{{Value: "DE", Count: 3}, {Value: "FR", Count: 1}}, facets["country"])
+	assert.Equal(t, []FacetValue{{Value: "AS3320", Count: 3}, {Value: "AS3209", Count: 1}}, facets["asn"])
+
+	// Only the most frequent values are returned
+	facets, err = tdb.GetAgentFacets(ctx, filter, []string{"country"}, 1)
+	assert.NoError(t, err, "error counting facets")
+	assert.Equal(t, []FacetValue{{Value: "DE", Count: 3}}, facets["country"])
+
+	// Other fields cannot be used
+	_, err = tdb.GetAgentFacets(ctx, filter, []string{"ip_address"}, 10)
+	assert.ErrorIs(t, err, ErrInvalidFacet)
+}
@@ -0,0 +1,35 @@
+package db
+
+import "argus/pkg/filterql"
+
+// agentQueryFields is the allow-list of the fields agents can be queried by
+var agentQueryFields = filterql.Fields{
+	"id":         {Column: "agents.id", Type: filterql.Number},
+	"created_at": {Column: "agents.created_at", Type: filterql.Time},
+	"ip_address": {Column: "agents.ip_address", Type: filterql.Text},
+	"asn":        {Column: "agents.asn", Type: filterql.Text},
+	"isp":        {Column: "agents.isp", Type: filterql.Text},
+	"city":       {Column: "agents.city", Type: filterql.Text},
+	"region":     {Column: "agents.region", Type: filterql.Text},
+	"country":    {Column: "agents.country", Type: filterql.Text},
+}
+
+// AgentQuery is a compiled filterql query over the agents
+type AgentQuery struct {
+	sql  string
+	args []any
+}
+
+// ParseAgentQuery parses and compiles a filterql query over the agents, errors are of type *filterql.Error
+func ParseAgentQuery(query string) (*AgentQuery, error) {
+	node, err := filterql.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sql, args, err := filterql.Compile(node, agentQueryFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AgentQuery{sql: sql, args: args}, nil
+}
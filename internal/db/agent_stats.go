@@ -0,0 +1,112 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidStatsGroup    = errors.New("invalid stats group field")
+	ErrInvalidStatsInterval = errors.New("invalid stats interval")
+)
+
+// agentStatsGroupColumns is the allow-list of the fields agents can be grouped by in the stats
+var agentStatsGroupColumns = map[string]string{
+	"country": "agents.country",
+	"asn":     "agents.asn",
+	"isp":     "agents.isp",
+	"city":    "agents.city",
+}
+
+// agentStatsIntervals is the allow-list of the time buckets, mapped to the date_trunc fields
+var agentStatsIntervals = map[string]string{
+	"hour": "hour",
+	"day":  "day",
+	"week": "week",
+}
+
+// AgentStatsRow is the number of agents in a time bucket and group
+type AgentStatsRow struct {
+	// Bucket is the start of the time bucket in UTC, it is nil if there is no interval
+	Bucket *time.Time
+	// Group contains the values of the group by fields, in the same order
+	Group []string
+	Count int64
+}
+
+// GetAgentStats counts the agents matching the filter, grouped by the fields and bucketed by the interval of
+// their creation time. Both groupBy and interval are optional, rows are ordered by the bucket and then the count.
+func (gdb *GormDB) GetAgentStats(ctx context.Context, filter *AgentFilter, groupBy []string, interval string, limit int) ([]AgentStatsRow, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAgentStats")
+	defer span.End()
+
+	// Build the selected columns, only the allow-listed expressions are used in the raw SQL
+	var columns, orders []string
+	if interval != "" {
+		field, ok := agentStatsIntervals[interval]
+		if !ok {
+			return nil, ErrInvalidStatsInterval
+		}
+		columns = append(columns, fmt.Sprintf("date_trunc('%s', agents.created_at AT TIME ZONE 'UTC') AS bucket", field))
+		orders = append(orders, "bucket")
+	}
+	for _, field := range groupBy {
+		column, ok := agentStatsGroupColumns[field]
+		if !ok {
+			return nil, ErrInvalidStatsGroup
+		}
+		columns = append(columns, column)
+	}
+	groups := make([]string, len(columns))
+	for i := range columns {
+		groups[i] = fmt.Sprint(i + 1)
+	}
+	columns = append(columns, "COUNT(*) AS count")
+	orders = append(orders, "count DESC")
+
+	query := applyAgentFilter(gdb.db.WithContext(ctx).Model(&Agent{}).Scopes(scopeTenant(ctx, "agents")), filter).
+		Select(strings.Join(columns, ", ")).
+		Order(strings.Join(orders, ", ")).
+		Limit(limit)
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", "))
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []AgentStatsRow
+	for rows.Next() {
+		var row AgentStatsRow
+		var bucket time.Time
+		row.Group = make([]string, len(groupBy))
+
+		dest := make([]any, 0, len(columns))
+		if interval != "" {
+			dest = append(dest, &bucket)
+		}
+		for i := range row.Group {
+			dest = append(dest, &row.Group[i])
+		}
+		dest = append(dest, &row.Count)
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		if interval != "" {
+			bucket = bucket.UTC()
+			row.Bucket = &bucket
+		}
+		stats = append(stats, row)
+	}
+
+	return stats, rows.Err()
+}
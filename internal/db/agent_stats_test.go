@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetAgentStats(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing, created in two days
+	region := "Stats Region"
+	firstDay := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	secondDay := firstDay.AddDate(0, 0, 1)
+	for _, a := range []struct {
+		agent     *Agent
+		createdAt time.Time
+	}{
+		{agent: &Agent{IPAddress: "192.168.4.1", Region: region, Country: "DE"}, createdAt: firstDay.Add(time.Hour)},
+		{agent: &Agent{IPAddress: "192.168.4.2", Region: region, Country: "DE"}, createdAt: firstDay.Add(2 * time.Hour)},
+		{agent: &Agent{IPAddress: "192.168.4.3", Region: region, Country: "FR"}, createdAt: firstDay.Add(3 * time.Hour)},
+		{agent: &Agent{IPAddress: "192.168.4.4", Region: region, Country: "DE"}, createdAt: secondDay.Add(time.Hour)},
+	} {
+		_, err := tdb.CreateNewAgent(ctx, a.agent)
+		assert.NoError(t, err, "error creating new agent")
+		err = tdb.(*GormDB).db.Model(a.agent).Update("created_at", a.createdAt).Error
+		assert.NoError(t, err, "error updating the creation time")
+	}
+	filter := &AgentFilter{Regions: []string{region}}
+
+	// Count all of them
+	stats, err := tdb.GetAgentStats(ctx, filter, nil, "", 10)
+	assert.NoError(t, err, "error getting stats")
+	assert.Equal(t, []AgentStatsRow{{Group: []string{}, Count: 4}}, stats)
+
+	// Group and bucket them
+	stats, err = tdb.GetAgentStats(ctx, filter, []string{"country"}, "day", 10)
+	assert.NoError(t, err, "error getting stats")
+	assert.Equal(t, []AgentStatsRow{
+		{Bucket: &firstDay, Group: []string{"DE"}, Count: 2},
+		{Bucket: &firstDay, Group: []string{"FR"}, Count: 1},
+		{Bucket: &secondDay, Group: []string{"DE"}, Count: 1},
+	}, stats)
+
+	// Only the allow-listed fields and intervals can be used
+	_, err = tdb.GetAgentStats(ctx, filter, []string{"ip_address"}, "", 10)
+	assert.ErrorIs(t, err, ErrInvalidStatsGroup)
+	_, err = tdb.GetAgentStats(ctx, filter, nil, "minute", 10)
+	assert.ErrorIs(t, err, ErrInvalidStatsInterval)
+}
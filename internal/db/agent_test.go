@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestCreateNewAgent(t *testing.T) {
@@ -65,3 +68,265 @@ func TestGetAgentByID(t *testing.T) {
 	assert.Equal(t, createdAgent.ID, fetchedAgent.ID, "fetched agent ID should match created agent ID")
 	assert.Equal(t, newAgent.IPAddress, fetchedAgent.IPAddress, "fetched agent IP address should match")
 }
+
+func TestUpdateAgent(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create a new agent for testing
+	createdAgent, err := tdb.CreateNewAgent(ctx, &Agent{
+		IPAddress:        "192.168.1.102",
+		ASN:              "AS11111",
+		ISP:              "Old ISP",
+		City:             "Old City",
+		EnrichmentStatus: EnrichmentFailed,
+	})
+	assert.NoError(t, err, "error creating new agent")
+
+	// Update the enrichment data
+	createdAgent.EnrichmentStatus = EnrichmentCompleted
+	createdAgent.ASN = "AS22222"
+	createdAgent.ISP = "New ISP"
+	createdAgent.City = ""
+	_, err = tdb.UpdateAgent(ctx, createdAgent)
+	assert.NoError(t, err, "error updating agent")
+
+	// Fetch the agent by ID
+	fetchedAgent, err := tdb.GetAgentByID(ctx, createdAgent.ID)
+	assert.NoError(t, err, "error fetching agent by ID")
+	assert.Equal(t, "AS22222", fetchedAgent.ASN, "ASN should be updated")
+	assert.Equal(t, "New ISP", fetchedAgent.ISP, "ISP should be updated")
+	assert.Empty(t, fetchedAgent.City, "City should be cleared")
+	assert.Equal(t, EnrichmentCompleted, fetchedAgent.EnrichmentStatus, "EnrichmentStatus should be updated")
+	assert.Equal(t, createdAgent.IPAddress, fetchedAgent.IPAddress, "IP address should not change")
+}
+
+func TestDeleteAndRestoreAgent(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create a new agent for testing
+	ipAddress := "192.168.1.103"
+	createdAgent, err := tdb.CreateNewAgent(ctx, &Agent{
+		IPAddress: ipAddress,
+		ASN:       "AS33333",
+	})
+	assert.NoError(t, err, "error creating new agent")
+
+	// Soft delete the agent
+	err = tdb.DeleteAgent(ctx, createdAgent.ID)
+	assert.NoError(t, err, "error deleting agent")
+	_, err = tdb.GetAgentByID(ctx, createdAgent.ID)
+	assert.Error(t, err, "deleted agent should not be found")
+
+	// Deleted agents are excluded from the list by default
+	result, err := tdb.GetAllAgents(ctx, &AgentFilter{IPAddress: &ipAddress}, 1, 10, nil)
+	assert.NoError(t, err, "error fetching agents")
+	assert.Zero(t, result.TotalAgents, "deleted agent should not be listed")
+	result, err = tdb.GetAllAgents(ctx, &AgentFilter{IPAddress: &ipAddress, IncludeDeleted: true}, 1, 10, nil)
+	assert.NoError(t, err, "error fetching agents")
+	assert.Equal(t, int64(1), result.TotalAgents, "deleted agent should be listed when included")
+	assert.True(t, result.Agents[0].DeletedAt.Valid, "deleted_at should be set")
+
+	// Deleting twice is not possible
+	err = tdb.DeleteAgent(ctx, createdAgent.ID)
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+
+	// Restore the agent
+	restoredAgent, err := tdb.RestoreAgent(ctx, createdAgent.ID)
+	assert.NoError(t, err, "error restoring agent")
+	assert.False(t, restoredAgent.DeletedAt.Valid, "deleted_at should be cleared")
+	fetchedAgent, err := tdb.GetAgentByID(ctx, createdAgent.ID)
+	assert.NoError(t, err, "restored agent should be found")
+	assert.Equal(t, createdAgent.ID, fetchedAgent.ID)
+}
+
+func TestPurgeAgent(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create and soft delete a new agent for testing
+	createdAgent, err := tdb.CreateNewAgent(ctx, &Agent{
+		IPAddress: "192.168.1.104",
+	})
+	assert.NoError(t, err, "error creating new agent")
+	err = tdb.DeleteAgent(ctx, createdAgent.ID)
+	assert.NoError(t, err, "error deleting agent")
+
+	// Purge the agent
+	err = tdb.PurgeAgent(ctx, createdAgent.ID)
+	assert.NoError(t, err, "error purging agent")
+
+	// Purged agents cannot be restored
+	_, err = tdb.RestoreAgent(ctx, createdAgent.ID)
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+	err = tdb.PurgeAgent(ctx, createdAgent.ID)
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+}
+
+func TestBulkDeleteAgents(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing
+	ipAddress := "192.168.1.105"
+	for i := 0; i < 5; i++ {
+		_, err := tdb.CreateNewAgent(ctx, &Agent{
+			IPAddress: ipAddress,
+		})
+		assert.NoError(t, err, "error creating new agent")
+	}
+
+	// Delete them in chunks smaller than the number of agents
+	filter := &AgentFilter{IPAddress: &ipAddress}
+	deleted, err := tdb.BulkDeleteAgents(ctx, filter, 2)
+	assert.NoError(t, err, "error deleting agents")
+	assert.Len(t, deleted, 5, "all matching agents should be deleted")
+
+	// Nothing is left to delete
+	result, err := tdb.GetAllAgents(ctx, filter, 1, 10, nil)
+	assert.NoError(t, err, "error fetching agents")
+	assert.Zero(t, result.TotalAgents, "deleted agents should not be listed")
+	deleted, err = tdb.BulkDeleteAgents(ctx, filter, 2)
+	assert.NoError(t, err, "error deleting agents")
+	assert.Empty(t, deleted, "no agent should be deleted again")
+}
+
+func TestGetAllAgents_Filter(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing
+	region := "Test Region"
+	agents := []*Agent{
+		{IPAddress: "192.168.2.1", Country: "DE", City: "Berlin", Region: region, ASN: "AS3320", ISP: "Deutsche Telekom AG"},
+		{IPAddress: "192.168.2.2", Country: "DE", City: "Munich", Region: region, ASN: "AS3209", ISP: "Vodafone GmbH"},
+		{IPAddress: "192.168.2.3", Country: "FR", City: "Paris", Region: region, ASN: "AS3215", ISP: "Orange S.A."},
+	}
+	for _, a := range agents {
+		_, err := tdb.CreateNewAgent(ctx, a)
+		assert.NoError(t, err, "error creating new agent")
+	}
+	yesterday := time.Now().Add(-24 * time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+	isp := "telekom"
+
+	tests := []struct {
+		name          string
+		filter        *AgentFilter
+		expectedTotal int64
+	}{
+		{
+			name:          "Multiple Countries",
+			filter:        &AgentFilter{Regions: []string{region}, Countries: []string{"DE", "FR"}},
+			expectedTotal: 3,
+		},
+		{
+			name:          "Country And ASN",
+			filter:        &AgentFilter{Regions: []string{region}, Countries: []string{"DE"}, ASNs: []string{"AS3320"}},
+			expectedTotal: 1,
+		},
+		{
+			name:          "City",
+			filter:        &AgentFilter{Regions: []string{region}, Cities: []string{"Paris", "Munich"}},
+			expectedTotal: 2,
+		},
+		{
+			name:          "ISP Substring",
+			filter:        &AgentFilter{Regions: []string{region}, ISP: &isp},
+			expectedTotal: 1,
+		},
+		{
+			name:          "Created Range",
+			filter:        &AgentFilter{Regions: []string{region}, CreatedAfter: &yesterday, CreatedBefore: &tomorrow},
+			expectedTotal: 3,
+		},
+		{
+			name:          "Created In Future",
+			filter:        &AgentFilter{Regions: []string{region}, CreatedAfter: &tomorrow},
+			expectedTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tdb.GetAllAgents(ctx, tt.filter, 1, 10, nil)
+			assert.NoError(t, err, "error fetching agents")
+			assert.Equal(t, tt.expectedTotal, result.TotalAgents)
+		})
+	}
+
+	// Sort by the allow-listed columns
+	sortBy, orderBy := "city", "asc"
+	result, err := tdb.GetAllAgents(ctx, &AgentFilter{Regions: []string{region}}, 1, 10, &AgentSort{SortBy: &sortBy, OrderBy: &orderBy})
+	assert.NoError(t, err, "error fetching agents")
+	assert.Equal(t, "Berlin", result.Agents[0].City)
+	assert.Equal(t, "Paris", result.Agents[2].City)
+
+	// Other columns cannot be used for sorting
+	sortBy = "isp; DROP TABLE agents"
+	_, err = tdb.GetAllAgents(ctx, nil, 1, 10, &AgentSort{SortBy: &sortBy})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestFindAgentsInBatches(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents for testing
+	region := "Export Region"
+	for i := 1; i <= 5; i++ {
+		_, err := tdb.CreateNewAgent(ctx, &Agent{IPAddress: fmt.Sprintf("192.168.5.%d", i), Region: region})
+		assert.NoError(t, err, "error creating new agent")
+	}
+	filter := &AgentFilter{Regions: []string{region}}
+
+	// Read all of them in batches
+	var batchSizes []int
+	var lastID uint
+	err := tdb.FindAgentsInBatches(ctx, filter, 2, func(agents []Agent) error {
+		batchSizes = append(batchSizes, len(agents))
+		for _, a := range agents {
+			assert.Greater(t, a.ID, lastID, "agents should be ordered by their ID")
+			lastID = a.ID
+		}
+		return nil
+	})
+	assert.NoError(t, err, "error finding agents in batches")
+	assert.Equal(t, []int{2, 2, 1}, batchSizes)
+
+	// Stop at the first error
+	stop := errors.New("stop")
+	batches := 0
+	err = tdb.FindAgentsInBatches(ctx, filter, 2, func(agents []Agent) error {
+		batches++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, batches)
+}
+
+func TestCreateAgents(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create agents in batches
+	agents := []*Agent{
+		{IPAddress: "192.168.6.1"},
+		{IPAddress: "192.168.6.2"},
+		{IPAddress: "192.168.6.3"},
+	}
+	err := tdb.CreateAgents(ctx, agents, 2)
+	assert.NoError(t, err, "error creating agents")
+	for _, a := range agents {
+		assert.NotZero(t, a.ID, "agent ID should be set")
+		assert.False(t, a.CreatedAt.IsZero(), "agent creation time should be set")
+	}
+
+	// Find the existing IP addresses, deleted agents are ignored
+	err = tdb.DeleteAgent(ctx, agents[2].ID)
+	assert.NoError(t, err, "error deleting agent")
+	existing, err := tdb.FindExistingIPAddresses(ctx, []string{"192.168.6.1", "192.168.6.3", "192.168.6.4"})
+	assert.NoError(t, err, "error finding existing IP addresses")
+	assert.Equal(t, []string{"192.168.6.1"}, existing)
+}
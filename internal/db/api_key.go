@@ -0,0 +1,235 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a key of a client of the API, only the hash of the secret is stored
+type APIKey struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"not null"`
+	// Prefix is the public part of the key which is used to look it up
+	Prefix     string `gorm:"uniqueIndex;not null"`
+	Hash       string `gorm:"not null"`
+	Name       string `gorm:"not null"`
+	Owner      string `gorm:"index"`
+	TenantID   string `gorm:"index;not null;default:'default'"`
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	Limits     APIKeyLimits `gorm:"embedded"`
+	// Scopes of the keys created before the scopes were added are every scope except admin
+	Scopes  Scopes        `gorm:"not null;default:'agents:read agents:write agents:delete export'"`
+	Signing APIKeySigning `gorm:"embedded"`
+}
+
+// APIKeySigning is the signing of the requests of an API key, the secret is empty if the key cannot sign requests
+type APIKeySigning struct {
+	// SigningSecret is kept as it is, as the signatures of the requests are verified with it
+	SigningSecret string `gorm:"not null;default:''"`
+	// RequireSignature rejects the requests of the key which are not signed
+	RequireSignature bool `gorm:"not null;default:false"`
+}
+
+// Scopes are the permissions granted to an API key, they are stored separated by spaces
+type Scopes []string
+
+// GormDataType stores the scopes as text
+func (Scopes) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+// Scan implements sql.Scanner
+func (s *Scopes) Scan(value any) error {
+	switch v := value.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into scopes", value)
+	}
+	return nil
+}
+
+// APIKeyLimits overrides the default limits of an API key, nil means the default and zero means unlimited
+type APIKeyLimits struct {
+	// RateLimit is the number of requests per second, Burst is the number of requests allowed at once
+	RateLimit    *float64
+	Burst        *int
+	DailyQuota   *int64
+	MonthlyQuota *int64
+}
+
+// IsActive reports whether the key is neither revoked nor expired at the given time
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// CreateAPIKey stores a new API key
+func (gdb *GormDB) CreateAPIKey(ctx context.Context, key *APIKey) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CreateAPIKey")
+	defer span.End()
+
+	key.CreatedAt = time.Now()
+	return key, gdb.db.WithContext(ctx).Create(key).Error
+}
+
+// GetAPIKeys returns the API keys, optionally of one owner, the revoked keys are only included if asked
+func (gdb *GormDB) GetAPIKeys(ctx context.Context, owner string, includeRevoked bool) ([]APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAPIKeys")
+	defer span.End()
+
+	query := gdb.db.WithContext(ctx).Order("id")
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	if !includeRevoked {
+		query = query.Where("revoked_at IS NULL")
+	}
+
+	var keys []APIKey
+	return keys, query.Find(&keys).Error
+}
+
+// GetAPIKeyByPrefix returns the API key having the prefix, whether it is active or not
+func (gdb *GormDB) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAPIKeyByPrefix")
+	defer span.End()
+
+	var key APIKey
+	err := gdb.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// RevokeAPIKey revokes the API key, revoking a key which is already revoked keeps its revocation time
+func (gdb *GormDB) RevokeAPIKey(ctx context.Context, keyID uint) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "RevokeAPIKey")
+	defer span.End()
+
+	var key APIKey
+	err := gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ?", keyID).First(&key).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAPIKeyNotFound
+			}
+			return err
+		}
+		if key.RevokedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		key.RevokedAt = &now
+		return tx.Model(&key).Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// TouchAPIKey sets the last time the API key was used
+func (gdb *GormDB) TouchAPIKey(ctx context.Context, keyID uint, usedAt time.Time) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "TouchAPIKey")
+	defer span.End()
+
+	return gdb.db.WithContext(ctx).Model(&APIKey{}).Where("id = ?", keyID).Update("last_used_at", usedAt).Error
+}
+
+// UpdateAPIKeyLimits replaces the limits of the API key
+func (gdb *GormDB) UpdateAPIKeyLimits(ctx context.Context, keyID uint, limits APIKeyLimits) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UpdateAPIKeyLimits")
+	defer span.End()
+
+	key := APIKey{ID: keyID}
+	result := gdb.db.WithContext(ctx).Model(&key).
+		Select("rate_limit", "burst", "daily_quota", "monthly_quota").
+		Updates(APIKey{Limits: limits})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return gdb.GetAPIKeyByID(ctx, keyID)
+}
+
+// UpdateAPIKeyScopes replaces the scopes of the API key
+func (gdb *GormDB) UpdateAPIKeyScopes(ctx context.Context, keyID uint, scopes Scopes) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UpdateAPIKeyScopes")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).Model(&APIKey{}).Where("id = ?", keyID).Update("scopes", scopes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return gdb.GetAPIKeyByID(ctx, keyID)
+}
+
+// UpdateAPIKeySigning replaces the signing of the API key
+func (gdb *GormDB) UpdateAPIKeySigning(ctx context.Context, keyID uint, signing APIKeySigning) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UpdateAPIKeySigning")
+	defer span.End()
+
+	key := APIKey{ID: keyID}
+	result := gdb.db.WithContext(ctx).Model(&key).
+		Select("signing_secret", "require_signature").
+		Updates(APIKey{Signing: signing})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return gdb.GetAPIKeyByID(ctx, keyID)
+}
+
+// GetAPIKeyByID returns the API key, whether it is active or not
+func (gdb *GormDB) GetAPIKeyByID(ctx context.Context, keyID uint) (*APIKey, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAPIKeyByID")
+	defer span.End()
+
+	var key APIKey
+	err := gdb.db.WithContext(ctx).Where("id = ?", keyID).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
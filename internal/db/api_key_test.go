@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	created, err := tdb.CreateAPIKey(ctx, &APIKey{Prefix: "0a1b2c3d", Hash: "hash", Name: "first", Owner: "team-db", ExpiresAt: &expiresAt})
+	assert.NoError(t, err)
+	assert.NotZero(t, created.ID)
+	assert.True(t, created.IsActive(time.Now()))
+	assert.False(t, created.IsActive(expiresAt))
+
+	_, err = tdb.CreateAPIKey(ctx, &APIKey{Prefix: "0a1b2c3d", Hash: "other", Name: "duplicate"})
+	assert.Error(t, err, "prefixes should be unique")
+
+	key, err := tdb.GetAPIKeyByPrefix(ctx, "0a1b2c3d")
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, key.ID)
+
+	_, err = tdb.GetAPIKeyByPrefix(ctx, "ffffffff")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	usedAt := time.Now().Truncate(time.Millisecond)
+	assert.NoError(t, tdb.TouchAPIKey(ctx, created.ID, usedAt))
+
+	// Revoking the key excludes it from the list by default
+	revoked, err := tdb.RevokeAPIKey(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+	assert.False(t, revoked.IsActive(time.Now()))
+
+	again, err := tdb.RevokeAPIKey(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, *revoked.RevokedAt, *again.RevokedAt, time.Millisecond, "the first revocation time should be kept")
+
+	_, err = tdb.RevokeAPIKey(ctx, 999999)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	keys, err := tdb.GetAPIKeys(ctx, "team-db", false)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	keys, err = tdb.GetAPIKeys(ctx, "team-db", true)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.True(t, usedAt.Equal(*keys[0].LastUsedAt))
+}
+
+func TestUpdateAPIKeyLimits(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	rate, burst := 5.0, 10
+	created, err := tdb.CreateAPIKey(ctx, &APIKey{Prefix: "1a2b3c4d", Hash: "hash", Name: "limited", Limits: APIKeyLimits{RateLimit: &rate, Burst: &burst}})
+	assert.NoError(t, err)
+
+	// The limits are replaced, the missing ones become the defaults
+	dailyQuota := int64(100)
+	updated, err := tdb.UpdateAPIKeyLimits(ctx, created.ID, APIKeyLimits{DailyQuota: &dailyQuota})
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Limits.RateLimit)
+	assert.Nil(t, updated.Limits.Burst)
+	assert.Equal(t, dailyQuota, *updated.Limits.DailyQuota)
+
+	key, err := tdb.GetAPIKeyByID(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Limits, key.Limits)
+
+	_, err = tdb.UpdateAPIKeyLimits(ctx, 999999, APIKeyLimits{})
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestUpdateAPIKeyScopes(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	created, err := tdb.CreateAPIKey(ctx, &APIKey{Prefix: "2a3b4c5d", Hash: "hash", Name: "scoped", Scopes: Scopes{"agents:read"}})
+	assert.NoError(t, err)
+
+	updated, err := tdb.UpdateAPIKeyScopes(ctx, created.ID, Scopes{"agents:read", "export"})
+	assert.NoError(t, err)
+	assert.Equal(t, Scopes{"agents:read", "export"}, updated.Scopes)
+
+	_, err = tdb.UpdateAPIKeyScopes(ctx, 999999, Scopes{"admin"})
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	// The keys without scopes get the scopes of the keys created before the scopes
+	legacy, err := tdb.CreateAPIKey(ctx, &APIKey{Prefix: "3a4b5c6d", Hash: "hash", Name: "legacy"})
+	assert.NoError(t, err)
+	assert.Equal(t, Scopes{"agents:read", "agents:write", "agents:delete", "export"}, legacy.Scopes)
+}
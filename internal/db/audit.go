@@ -0,0 +1,129 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Outcomes of the audited requests
+const (
+	AuditDenied    = "denied"
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// AuditEvent records a request of a client, e.g. a change of the agents or a request denied for missing a scope.
+// The events are append-only, they cannot be updated nor deleted.
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index;not null"`
+	// Subject identifies the client, e.g. api_key:1a2b3c4d or token:<subject of the token>
+	Subject string `gorm:"index;not null;default:''"`
+	// APIKeyID is zero for the bootstrap key and the clients without an API key
+	APIKeyID uint   `gorm:"index;not null"`
+	Method   string `gorm:"not null"`
+	// Route is the route of the request, e.g. /api/v1/agents/:agent_id
+	Route    string `gorm:"not null"`
+	Outcome  string `gorm:"not null"`
+	Reason   string
+	ClientIP string
+	// TenantID is the tenant of the client
+	TenantID  string `gorm:"index;not null;default:''"`
+	RequestID string `gorm:"index;not null;default:''"`
+	// Action is what the client did, e.g. agent.delete, it is empty for the denied requests
+	Action string `gorm:"index;not null;default:''"`
+	// Resource and ResourceID identify what the action is done on, e.g. agent and 42
+	Resource   string `gorm:"index;not null;default:''"`
+	ResourceID string `gorm:"index;not null;default:''"`
+	// Status is the HTTP status of the response
+	Status int `gorm:"not null;default:0"`
+	// Summary describes the request without the values of its body as a JSON object
+	Summary string `gorm:"not null;default:''"`
+}
+
+// AuditFilter filters the audit events, the zero values match every event
+type AuditFilter struct {
+	TenantID   *string
+	Subject    *string
+	APIKeyID   *uint
+	Action     *string
+	Resource   *string
+	ResourceID *string
+	Outcome    *string
+	RequestID  *string
+	// From and To are the time range [From, To) of the events
+	From time.Time
+	To   time.Time
+}
+
+// protectAuditEvents makes the audit events append-only, the updates and the deletes of the table are rejected
+func protectAuditEvents(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE OR REPLACE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`).Error
+	})
+}
+
+// CreateAuditEvent stores an audit event
+func (gdb *GormDB) CreateAuditEvent(ctx context.Context, event *AuditEvent) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CreateAuditEvent")
+	defer span.End()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return gdb.db.WithContext(ctx).Create(event).Error
+}
+
+// GetAuditEvents retrieves the latest audit events matching the filter, newest first. With a non-zero beforeID, the
+// events start right before the event of the ID, so the pages of the events do not change when new ones are added.
+func (gdb *GormDB) GetAuditEvents(ctx context.Context, filter AuditFilter, beforeID uint, limit int) ([]AuditEvent, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetAuditEvents")
+	defer span.End()
+
+	query := gdb.db.WithContext(ctx).Model(&AuditEvent{})
+	columns := []struct {
+		name  string
+		value *string
+	}{
+		{"tenant_id", filter.TenantID},
+		{"subject", filter.Subject},
+		{"action", filter.Action},
+		{"resource", filter.Resource},
+		{"resource_id", filter.ResourceID},
+		{"outcome", filter.Outcome},
+		{"request_id", filter.RequestID},
+	}
+	for _, column := range columns {
+		if column.value != nil {
+			query = query.Where(column.name+" = ?", *column.value)
+		}
+	}
+	if filter.APIKeyID != nil {
+		query = query.Where("api_key_id = ?", *filter.APIKeyID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var events []AuditEvent
+	err := query.Order("id desc").Limit(limit).Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCreateAuditEvent(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	event := &AuditEvent{Subject: "api_key:1a2b3c4d", APIKeyID: 1, Method: "DELETE", Route: "/api/v1/agents", Outcome: AuditDenied, Reason: "missing scope agents:delete"}
+	assert.NoError(t, tdb.CreateAuditEvent(ctx, event))
+	assert.NotZero(t, event.ID)
+	assert.False(t, event.CreatedAt.IsZero())
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	tenant := fmt.Sprintf("audit-%d", time.Now().UnixNano())
+	var ids []uint
+	for i, action := range []string{"agent.create", "agent.delete", "agent.delete"} {
+		event := &AuditEvent{
+			TenantID:   tenant,
+			Subject:    "api_key:1a2b3c4d",
+			Method:     "DELETE",
+			Route:      "/api/v1/agents/:agent_id",
+			Action:     action,
+			Resource:   "agent",
+			ResourceID: fmt.Sprint(i + 1),
+			Outcome:    AuditSucceeded,
+		}
+		assert.NoError(t, tdb.CreateAuditEvent(ctx, event))
+		ids = append(ids, event.ID)
+	}
+
+	// The events are listed newest first
+	events, err := tdb.GetAuditEvents(ctx, AuditFilter{TenantID: &tenant}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, ids[2], events[0].ID)
+
+	action := "agent.delete"
+	events, err = tdb.GetAuditEvents(ctx, AuditFilter{TenantID: &tenant, Action: &action}, 0, 1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, ids[2], events[0].ID)
+
+	// The next page starts before the last event
+	events, err = tdb.GetAuditEvents(ctx, AuditFilter{TenantID: &tenant, Action: &action}, events[0].ID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, ids[1], events[0].ID)
+
+	events, err = tdb.GetAuditEvents(ctx, AuditFilter{TenantID: &tenant, From: time.Now().Add(time.Minute)}, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	event := &AuditEvent{Subject: "api_key:1a2b3c4d", Method: "POST", Route: "/api/v1/agents", Outcome: AuditSucceeded}
+	assert.NoError(t, tdb.CreateAuditEvent(ctx, event))
+
+	gdb := tdb.(*GormDB).db
+	assert.ErrorContains(t, gdb.Model(event).Update("outcome", AuditFailed).Error, "append-only")
+	assert.ErrorContains(t, gdb.Delete(event).Error, "append-only")
+	assert.ErrorContains(t, gdb.Exec("TRUNCATE audit_events").Error, "append-only")
+
+	events, err := tdb.GetAuditEvents(ctx, AuditFilter{}, event.ID+1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, AuditSucceeded, events[0].Outcome)
+}
@@ -1,11 +1,60 @@
 package db
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type DB interface {
 	Ping(ctx context.Context) error
 
 	CreateNewAgent(ctx context.Context, agent *Agent) (*Agent, error)
+	CreateAgents(ctx context.Context, agents []*Agent, batchSize int) error
+	FindExistingIPAddresses(ctx context.Context, ipAddresses []string) ([]string, error)
 	GetAllAgents(ctx context.Context, filter *AgentFilter, page int, pageSize int, sort *AgentSort) (*AgentsResult, error)
+	GetAgentsPage(ctx context.Context, filter *AgentFilter, cursor *AgentCursor, limit int, sort *AgentSort) (*AgentsPage, error)
+	CountAgents(ctx context.Context, filter *AgentFilter) (int64, error)
+	EstimateAgentsCount(ctx context.Context, filter *AgentFilter) (int64, error)
+	GetAgentFacets(ctx context.Context, filter *AgentFilter, fields []string, limit int) (map[string][]FacetValue, error)
+	GetAgentStats(ctx context.Context, filter *AgentFilter, groupBy []string, interval string, limit int) ([]AgentStatsRow, error)
+	FindAgentsInBatches(ctx context.Context, filter *AgentFilter, batchSize int, fn func(agents []Agent) error) error
 	GetAgentByID(ctx context.Context, agentID uint) (*Agent, error)
+	UpdateAgent(ctx context.Context, agent *Agent) (*Agent, error)
+	DeleteAgent(ctx context.Context, agentID uint) error
+	RestoreAgent(ctx context.Context, agentID uint) (*Agent, error)
+	PurgeAgent(ctx context.Context, agentID uint) error
+	BulkDeleteAgents(ctx context.Context, filter *AgentFilter, chunkSize int) ([]uint, error)
+	PurgeDeletedAgents(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	CreateAgentWithEnrichmentJob(ctx context.Context, agent *Agent, maxAttempts int, apiKeyID uint) (*Agent, error)
+	ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error)
+	CompleteEnrichmentJob(ctx context.Context, job *EnrichmentJob, agent *Agent) error
+	FailEnrichmentJob(ctx context.Context, job *EnrichmentJob, reason string, retryAt time.Time) error
+	GetEnrichmentJobOfAgent(ctx context.Context, agentID uint) (*EnrichmentJob, error)
+
+	CreateAPIKey(ctx context.Context, key *APIKey) (*APIKey, error)
+	GetAPIKeys(ctx context.Context, owner string, includeRevoked bool) ([]APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, keyID uint) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID uint, usedAt time.Time) error
+	GetAPIKeyByID(ctx context.Context, keyID uint) (*APIKey, error)
+	UpdateAPIKeyLimits(ctx context.Context, keyID uint, limits APIKeyLimits) (*APIKey, error)
+	UpdateAPIKeyScopes(ctx context.Context, keyID uint, scopes Scopes) (*APIKey, error)
+	UpdateAPIKeySigning(ctx context.Context, keyID uint, signing APIKeySigning) (*APIKey, error)
+	UseNonce(ctx context.Context, apiKeyID uint, nonce string, expiresAt time.Time) (bool, error)
+	DeleteExpiredNonces(ctx context.Context, now time.Time) (int64, error)
+
+	AddUsage(ctx context.Context, rollups []UsageRollup) error
+	GetUsage(ctx context.Context, filter UsageFilter) ([]UsageRow, error)
+
+	TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+	ConsumeQuotas(ctx context.Context, apiKeyID uint, quotas []Quota) (bool, error)
+
+	CreateAuditEvent(ctx context.Context, event *AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter AuditFilter, beforeID uint, limit int) ([]AuditEvent, error)
+
+	CreateTenant(ctx context.Context, tenant *Tenant) (*Tenant, error)
+	GetTenants(ctx context.Context) ([]Tenant, error)
+	GetTenant(ctx context.Context, tenantID string) (*Tenant, error)
+	UpdateTenant(ctx context.Context, tenantID string, name string, settings TenantSettings) (*Tenant, error)
 }
@@ -0,0 +1,202 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Statuses of the enrichment jobs, dead jobs have failed too many times and are kept for inspection
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+var (
+	ErrEnrichmentJobNotFound = errors.New("enrichment job not found")
+	// ErrEnrichmentJobLost is returned when the lease of a claimed job has been lost, e.g. it has expired and the job
+	// has been claimed by another worker, the job is left to its new owner
+	ErrEnrichmentJobLost = errors.New("enrichment job lease lost")
+)
+
+// EnrichmentJob is a job of gathering the stats of an agent in the background
+type EnrichmentJob struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	AgentID   uint `gorm:"index;not null"`
+	// TenantID is the tenant of the agent, the job is processed with the settings of the tenant
+	TenantID string `gorm:"not null;default:'default'"`
+	// APIKeyID is the key which created the agent, its usage includes the lookups of the job
+	APIKeyID    uint   `gorm:"not null;default:0"`
+	Status      string `gorm:"index:idx_enrichment_jobs_status_run_at;not null"`
+	Attempts    int    `gorm:"not null"`
+	MaxAttempts int    `gorm:"not null"`
+	// RunAt is the time the job can be claimed at, it is delayed for retries
+	RunAt time.Time `gorm:"index:idx_enrichment_jobs_status_run_at;not null"`
+	// LockedUntil is the end of the lease of a running job, the job is claimed again after it
+	LockedUntil *time.Time
+	LastError   string
+}
+
+// CreateAgentWithEnrichmentJob creates a pending agent and queues the job of its enrichment in the same transaction
+func (gdb *GormDB) CreateAgentWithEnrichmentJob(ctx context.Context, a *Agent, maxAttempts int, apiKeyID uint) (*Agent, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CreateAgentWithEnrichmentJob")
+	defer span.End()
+
+	a.CreatedAt = time.Now()
+	a.TenantID = TenantFromContext(ctx)
+	a.EnrichmentStatus = EnrichmentPending
+
+	return a, gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(a).Error; err != nil {
+			return err
+		}
+		return tx.Create(&EnrichmentJob{
+			AgentID:     a.ID,
+			TenantID:    a.TenantID,
+			APIKeyID:    apiKeyID,
+			Status:      JobQueued,
+			MaxAttempts: maxAttempts,
+			RunAt:       a.CreatedAt,
+		}).Error
+	})
+}
+
+// ClaimEnrichmentJobs claims at most limit jobs which are due, or whose lease has expired, for the duration of the
+// lease. Jobs locked by other workers are skipped, so multiple workers can claim jobs at the same time.
+// The expired jobs without attempts left, e.g. crashing their workers, are dead-lettered instead of being claimed.
+// The jobs of all the tenants are claimed, they should be processed with the context of their tenant.
+func (gdb *GormDB) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]EnrichmentJob, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "ClaimEnrichmentJobs")
+	defer span.End()
+
+	var jobs []EnrichmentJob
+	err := gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			WITH dead AS (
+				UPDATE enrichment_jobs
+				SET status = ?, locked_until = NULL, last_error = ?, updated_at = now()
+				WHERE id IN (
+					SELECT id FROM enrichment_jobs
+					WHERE status = ? AND locked_until < now() AND attempts >= max_attempts
+					FOR UPDATE SKIP LOCKED
+				)
+				RETURNING agent_id, tenant_id
+			)
+			UPDATE agents SET enrichment_status = ?
+			FROM dead
+			WHERE agents.id = dead.agent_id AND agents.tenant_id = dead.tenant_id`,
+			JobDead, "the lease of the last attempt has expired", JobRunning, EnrichmentFailed,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Raw(`
+			UPDATE enrichment_jobs
+			SET status = ?, attempts = attempts + 1, locked_until = now() + make_interval(secs => ?), updated_at = now()
+			WHERE id IN (
+				SELECT id FROM enrichment_jobs
+				WHERE (status = ? AND run_at <= now()) OR (status = ? AND locked_until < now() AND attempts < max_attempts)
+				ORDER BY run_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *`,
+			JobRunning, lease.Seconds(), JobQueued, JobRunning, limit,
+		).Scan(&jobs).Error
+	})
+
+	return jobs, err
+}
+
+// updateClaimedJob updates the job if it is still running under the lease it has been claimed with, otherwise the
+// lease has been lost and ErrEnrichmentJobLost is returned
+func updateClaimedJob(tx *gorm.DB, job *EnrichmentJob, values map[string]any) error {
+	result := tx.Model(&EnrichmentJob{}).
+		Where("id = ? AND status = ? AND locked_until = ?", job.ID, JobRunning, job.LockedUntil).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEnrichmentJobLost
+	}
+	return nil
+}
+
+// CompleteEnrichmentJob stores the enrichment data of the agent and marks its job as succeeded, the agent is only
+// updated if it belongs to the tenant of the context. Nothing is stored if the lease of the job has been lost.
+func (gdb *GormDB) CompleteEnrichmentJob(ctx context.Context, job *EnrichmentJob, a *Agent) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CompleteEnrichmentJob")
+	defer span.End()
+
+	a.ID = job.AgentID
+	a.EnrichmentStatus = EnrichmentCompleted
+
+	return gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := updateClaimedJob(tx, job, map[string]any{"status": JobSucceeded, "locked_until": nil, "last_error": ""})
+		if err != nil {
+			return err
+		}
+		return tx.Model(a).
+			Scopes(scopeTenant(ctx, "agents")).
+			Select("asn", "isp", "city", "region", "country", "location", "enrichment_status").
+			Updates(a).Error
+	})
+}
+
+// FailEnrichmentJob records the failure of the job and retries it at retryAt. If the job has no attempts left,
+// it is dead-lettered and the enrichment of its agent is failed. Nothing is recorded if the lease of the job has
+// been lost.
+func (gdb *GormDB) FailEnrichmentJob(ctx context.Context, job *EnrichmentJob, reason string, retryAt time.Time) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "FailEnrichmentJob")
+	defer span.End()
+
+	if job.Attempts < job.MaxAttempts {
+		return updateClaimedJob(gdb.db.WithContext(ctx), job, map[string]any{
+			"status":       JobQueued,
+			"run_at":       retryAt,
+			"locked_until": nil,
+			"last_error":   reason,
+		})
+	}
+
+	return gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := updateClaimedJob(tx, job, map[string]any{"status": JobDead, "locked_until": nil, "last_error": reason})
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Agent{}).
+			Scopes(scopeTenant(ctx, "agents")).
+			Where("id = ?", job.AgentID).
+			Update("enrichment_status", EnrichmentFailed).Error
+	})
+}
+
+// GetEnrichmentJobOfAgent retrieves the latest enrichment job of the agent in the tenant of the context
+func (gdb *GormDB) GetEnrichmentJobOfAgent(ctx context.Context, agentID uint) (*EnrichmentJob, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetEnrichmentJobOfAgent")
+	defer span.End()
+
+	var job EnrichmentJob
+	err := gdb.db.WithContext(ctx).
+		Scopes(scopeTenant(ctx, "enrichment_jobs")).
+		Where("agent_id = ?", agentID).
+		Order("id DESC").
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEnrichmentJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEnrichmentJobs(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// Create a pending agent
+	agent, err := tdb.CreateAgentWithEnrichmentJob(ctx, &Agent{IPAddress: "203.0.113.10"}, 2, 0)
+	assert.NoError(t, err)
+	assert.NotZero(t, agent.ID)
+	assert.Equal(t, EnrichmentPending, agent.EnrichmentStatus)
+
+	// Claim its job, a claimed job cannot be claimed again during its lease
+	jobs, err := tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, agent.ID, jobs[0].AgentID)
+	assert.Equal(t, JobRunning, jobs[0].Status)
+	assert.Equal(t, 1, jobs[0].Attempts)
+
+	claimed, err := tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	// Retry the job
+	err = tdb.FailEnrichmentJob(ctx, &jobs[0], "first failure", time.Now().Add(-time.Second))
+	assert.NoError(t, err)
+
+	jobs, err = tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, 2, jobs[0].Attempts)
+	assert.Equal(t, "first failure", jobs[0].LastError)
+
+	// The job has no attempts left
+	err = tdb.FailEnrichmentJob(ctx, &jobs[0], "second failure", time.Now())
+	assert.NoError(t, err)
+
+	failedAgent, err := tdb.GetAgentByID(ctx, agent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, EnrichmentFailed, failedAgent.EnrichmentStatus)
+
+	claimed, err = tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed, "dead jobs should not be claimed")
+
+	deadJob, err := tdb.GetEnrichmentJobOfAgent(ctx, agent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, deadJob.Status)
+	assert.Equal(t, 2, deadJob.Attempts)
+	assert.Equal(t, "second failure", deadJob.LastError)
+
+	// The job is not visible to the other tenants
+	_, err = tdb.GetEnrichmentJobOfAgent(WithTenant(ctx, "other"), agent.ID)
+	assert.ErrorIs(t, err, ErrEnrichmentJobNotFound)
+
+	// Complete the job of another agent after the lease of its first claim is expired
+	agent, err = tdb.CreateAgentWithEnrichmentJob(ctx, &Agent{IPAddress: "203.0.113.11"}, 2, 0)
+	assert.NoError(t, err)
+
+	expired, err := tdb.ClaimEnrichmentJobs(ctx, 10, -time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+
+	jobs, err = tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, 2, jobs[0].Attempts)
+
+	// The first claim has lost the job, it can neither complete nor fail it
+	err = tdb.CompleteEnrichmentJob(ctx, &expired[0], &Agent{ASN: "AS64511"})
+	assert.ErrorIs(t, err, ErrEnrichmentJobLost)
+	err = tdb.FailEnrichmentJob(ctx, &expired[0], "lost", time.Now())
+	assert.ErrorIs(t, err, ErrEnrichmentJobLost)
+
+	err = tdb.CompleteEnrichmentJob(ctx, &jobs[0], &Agent{ASN: "AS64496", Country: "US"})
+	assert.NoError(t, err)
+
+	enrichedAgent, err := tdb.GetAgentByID(ctx, agent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, EnrichmentCompleted, enrichedAgent.EnrichmentStatus)
+	assert.Equal(t, "AS64496", enrichedAgent.ASN)
+	assert.Equal(t, "US", enrichedAgent.Country)
+	assert.Equal(t, "203.0.113.11", enrichedAgent.IPAddress)
+
+	// The job cannot be completed twice
+	err = tdb.CompleteEnrichmentJob(ctx, &jobs[0], &Agent{ASN: "AS64511"})
+	assert.ErrorIs(t, err, ErrEnrichmentJobLost)
+
+	// The job whose lease of its last attempt has expired is dead-lettered instead of being claimed again
+	agent, err = tdb.CreateAgentWithEnrichmentJob(ctx, &Agent{IPAddress: "203.0.113.12"}, 1, 0)
+	assert.NoError(t, err)
+
+	expired, err = tdb.ClaimEnrichmentJobs(ctx, 10, -time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+
+	claimed, err = tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	deadJob, err = tdb.GetEnrichmentJobOfAgent(ctx, agent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobDead, deadJob.Status)
+	assert.Equal(t, 1, deadJob.Attempts)
+	assert.Nil(t, deadJob.LockedUntil)
+
+	failedAgent, err = tdb.GetAgentByID(ctx, agent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, EnrichmentFailed, failedAgent.EnrichmentStatus)
+}
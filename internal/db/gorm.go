@@ -43,7 +43,25 @@ func NewGormDB(ctx context.Context, cfg config.Config, l logger.Logger) (DB, err
 	// Migration
 	err = db.AutoMigrate(
 		&Agent{},
+		&EnrichmentJob{},
+		&APIKey{},
+		&UsageRollup{},
+		&RateLimitBucket{},
+		&QuotaCounter{},
+		&AuditEvent{},
+		&UsedNonce{},
+		&Tenant{},
 	)
+	if err != nil {
+		return nil, err
+	}
+	// The existing data and the clients without a tenant belong to the default tenant
+	if err = createDefaultTenant(db); err != nil {
+		return nil, err
+	}
+	if err = protectAuditEvents(db); err != nil {
+		return nil, err
+	}
 
 	return &GormDB{
 		cfg: cfg,
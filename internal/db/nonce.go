@@ -0,0 +1,43 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// UsedNonce is a nonce of a signed request of an API key, it is kept until the request cannot be replayed anymore
+type UsedNonce struct {
+	APIKeyID  uint      `gorm:"primaryKey;autoIncrement:false"`
+	Nonce     string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// UseNonce stores the nonce of the API key, it returns false if the nonce is used before and is not expired
+func (gdb *GormDB) UseNonce(ctx context.Context, apiKeyID uint, nonce string, expiresAt time.Time) (bool, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UseNonce")
+	defer span.End()
+
+	// An expired nonce which is not deleted yet can be used again
+	result := gdb.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "api_key_id"}, {Name: "nonce"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "used_nonces.expires_at <= CURRENT_TIMESTAMP"}}},
+	}).Create(&UsedNonce{APIKeyID: apiKeyID, Nonce: nonce, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpiredNonces deletes the nonces expired before now
+func (gdb *GormDB) DeleteExpiredNonces(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "DeleteExpiredNonces")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&UsedNonce{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestUseNonce(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	expiresAt := time.Now().Add(time.Minute)
+	fresh, err := tdb.UseNonce(ctx, 1, "nonce", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = tdb.UseNonce(ctx, 1, "nonce", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, fresh, "the nonce should not be used twice")
+
+	fresh, err = tdb.UseNonce(ctx, 2, "nonce", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, fresh, "the nonces of the keys are independent")
+
+	// The expired nonces can be used again and are deleted
+	fresh, err = tdb.UseNonce(ctx, 3, "expired", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = tdb.UseNonce(ctx, 3, "expired", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+
+	_, err = tdb.UseNonce(ctx, 3, "stale", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	deleted, err := tdb.DeleteExpiredNonces(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Periods of the request quotas
+const (
+	QuotaDaily   = "day"
+	QuotaMonthly = "month"
+)
+
+// errQuotaExceeded rolls back the consumed quotas when one of them is exceeded
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// RateLimitBucket is a token bucket shared by the instances, Tokens is the number of tokens at UpdatedAt
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// QuotaCounter counts the requests of an API key in a period starting at PeriodStart
+type QuotaCounter struct {
+	APIKeyID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	Period      string    `gorm:"primaryKey"`
+	PeriodStart time.Time `gorm:"primaryKey"`
+	Count       int64     `gorm:"not null"`
+}
+
+// Quota is a request quota of a period, Count is set by ConsumeQuotas
+type Quota struct {
+	Period      string
+	PeriodStart time.Time
+	Limit       int64
+	Count       int64
+}
+
+// TakeRateLimitToken takes a token from the bucket of the key, which holds at most burst tokens and is refilled by
+// rate tokens per second. It returns the tokens left in the bucket, which are less than one if none is taken.
+func (gdb *GormDB) TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "TakeRateLimitToken")
+	defer span.End()
+
+	// The bucket is refilled and taken from in one statement, so the concurrent requests of the instances are counted
+	const refilled = "LEAST(CAST(@burst AS double precision), rate_limit_buckets.tokens + " +
+		"CAST(EXTRACT(EPOCH FROM clock_timestamp() - rate_limit_buckets.updated_at) AS double precision) * " +
+		"CAST(@rate AS double precision))"
+	args := map[string]any{"key": key, "rate": rate, "burst": float64(burst)}
+
+	var tokens []float64
+	err := gdb.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES (@key, CAST(@burst AS double precision) - 1, clock_timestamp())
+		ON CONFLICT (key) DO UPDATE SET tokens = `+refilled+` - 1, updated_at = clock_timestamp()
+		WHERE `+refilled+` >= 1
+		RETURNING tokens`, args).Scan(&tokens).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if len(tokens) == 1 {
+		return true, tokens[0], nil
+	}
+
+	// No token is left, the refilled tokens tell when the next one is available
+	var left float64
+	err = gdb.db.WithContext(ctx).Raw(`SELECT `+refilled+` FROM rate_limit_buckets WHERE key = @key`, args).
+		Scan(&left).Error
+
+	return false, left, err
+}
+
+// ConsumeQuotas counts a request in all the quotas of the API key if none of them is exceeded, the Count of the
+// quotas is set to their count after the request. Otherwise, it returns false without counting the request, the
+// Count of the first exceeded quota is its Limit and the quotas after it are not checked.
+func (gdb *GormDB) ConsumeQuotas(ctx context.Context, apiKeyID uint, quotas []Quota) (bool, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "ConsumeQuotas")
+	defer span.End()
+
+	err := gdb.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range quotas {
+			q := &quotas[i]
+
+			var counts []int64
+			err := tx.Raw(`
+				INSERT INTO quota_counters (api_key_id, period, period_start, count) VALUES (?, ?, ?, 1)
+				ON CONFLICT (api_key_id, period, period_start) DO UPDATE SET count = quota_counters.count + 1
+				WHERE quota_counters.count < ?
+				RETURNING count`, apiKeyID, q.Period, q.PeriodStart, q.Limit).Scan(&counts).Error
+			if err != nil {
+				return err
+			}
+			if len(counts) == 1 {
+				q.Count = counts[0]
+				continue
+			}
+
+			// The quotas counted before are rolled back
+			for j := 0; j < i; j++ {
+				quotas[j].Count--
+			}
+			q.Count = q.Limit
+			return errQuotaExceeded
+		}
+		return nil
+	})
+	if errors.Is(err, errQuotaExceeded) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
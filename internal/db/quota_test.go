@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// The bucket starts full and is not refilled in practice
+	for i := 0; i < 3; i++ {
+		ok, tokens, err := tdb.TakeRateLimitToken(ctx, "test:bucket", 0.001, 3)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.InDelta(t, float64(2-i), tokens, 0.01)
+	}
+
+	ok, tokens, err := tdb.TakeRateLimitToken(ctx, "test:bucket", 0.001, 3)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Less(t, tokens, 1.0)
+
+	// The other buckets are independent
+	ok, _, err = tdb.TakeRateLimitToken(ctx, "test:other", 0.001, 3)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestConsumeQuotas(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	month := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	quotas := func() []Quota {
+		return []Quota{
+			{Period: QuotaMonthly, PeriodStart: month, Limit: 3},
+			{Period: QuotaDaily, PeriodStart: day, Limit: 2},
+		}
+	}
+
+	for i := 1; i <= 2; i++ {
+		q := quotas()
+		ok, err := tdb.ConsumeQuotas(ctx, 1, q)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, int64(i), q[0].Count)
+		assert.Equal(t, int64(i), q[1].Count)
+	}
+
+	// The daily quota is exceeded, the request is not counted in the monthly quota
+	q := quotas()
+	ok, err := tdb.ConsumeQuotas(ctx, 1, q)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), q[0].Count)
+	assert.Equal(t, int64(2), q[1].Count)
+
+	// The next day has its own quota
+	q = quotas()
+	q[1].PeriodStart = day.AddDate(0, 0, 1)
+	ok, err = tdb.ConsumeQuotas(ctx, 1, q)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), q[0].Count)
+	assert.Equal(t, int64(1), q[1].Count)
+
+	// Other keys are counted separately
+	ok, err = tdb.ConsumeQuotas(ctx, 2, quotas())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
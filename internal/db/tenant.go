@@ -0,0 +1,127 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+)
+
+// DefaultTenant owns the data of the clients which are not bound to a tenant, and the data created before the
+// tenants were added
+const DefaultTenant = "default"
+
+// Tenant is a team sharing the deployment, its agents are not visible to the other tenants
+type Tenant struct {
+	ID        string `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string         `gorm:"not null"`
+	Settings  TenantSettings `gorm:"embedded"`
+}
+
+// TenantSettings overrides the configuration for the agents of a tenant, nil means the default
+type TenantSettings struct {
+	// EnrichmentProvider gathers the stats of the IP addresses when no provider is asked for
+	EnrichmentProvider *string
+	// RetentionDays is the number of days the deleted agents are kept before being purged, zero keeps them forever
+	RetentionDays *int
+}
+
+// tenantContextKey is the key of the tenant in the context
+type tenantContextKey struct{}
+
+// WithTenant returns a context whose queries are restricted to the data of the tenant
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant of the queries made with the context, DefaultTenant if it has none
+func TenantFromContext(ctx context.Context) string {
+	if tenantID, _ := ctx.Value(tenantContextKey{}).(string); tenantID != "" {
+		return tenantID
+	}
+	return DefaultTenant
+}
+
+// scopeTenant restricts the queries of the table to the rows of the tenant of the context
+func scopeTenant(ctx context.Context, table string) func(*gorm.DB) *gorm.DB {
+	tenantID := TenantFromContext(ctx)
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where(table+".tenant_id = ?", tenantID)
+	}
+}
+
+// createDefaultTenant creates DefaultTenant if it does not exist
+func createDefaultTenant(db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Tenant{ID: DefaultTenant, Name: "Default"}).Error
+}
+
+// CreateTenant stores a new tenant, ErrTenantExists is returned if its id is taken
+func (gdb *GormDB) CreateTenant(ctx context.Context, tenant *Tenant) (*Tenant, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "CreateTenant")
+	defer span.End()
+
+	result := gdb.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(tenant)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTenantExists
+	}
+
+	return tenant, nil
+}
+
+// GetTenants returns all the tenants ordered by their id
+func (gdb *GormDB) GetTenants(ctx context.Context) ([]Tenant, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetTenants")
+	defer span.End()
+
+	var tenants []Tenant
+	return tenants, gdb.db.WithContext(ctx).Order("id").Find(&tenants).Error
+}
+
+// GetTenant returns the tenant having the id
+func (gdb *GormDB) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetTenant")
+	defer span.End()
+
+	var tenant Tenant
+	err := gdb.db.WithContext(ctx).Where("id = ?", tenantID).First(&tenant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, err
+	}
+
+	return &tenant, nil
+}
+
+// UpdateTenant replaces the name and the settings of the tenant
+func (gdb *GormDB) UpdateTenant(ctx context.Context, tenantID string, name string, settings TenantSettings) (*Tenant, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "UpdateTenant")
+	defer span.End()
+
+	tenant := Tenant{ID: tenantID}
+	result := gdb.db.WithContext(ctx).Model(&tenant).
+		Select("name", "enrichment_provider", "retention_days").
+		Updates(Tenant{Name: name, Settings: settings})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTenantNotFound
+	}
+
+	return gdb.GetTenant(ctx, tenantID)
+}
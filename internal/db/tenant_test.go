@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	// The default tenant is created by the migration
+	tenant, err := tdb.GetTenant(ctx, DefaultTenant)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTenant, tenant.ID)
+
+	id := fmt.Sprintf("tenant-%d", time.Now().UnixNano())
+	created, err := tdb.CreateTenant(ctx, &Tenant{ID: id, Name: "Acme"})
+	assert.NoError(t, err)
+	assert.Nil(t, created.Settings.RetentionDays)
+
+	_, err = tdb.CreateTenant(ctx, &Tenant{ID: id, Name: "Other"})
+	assert.ErrorIs(t, err, ErrTenantExists)
+
+	provider, days := "ipinfo", 7
+	updated, err := tdb.UpdateTenant(ctx, id, "Acme Inc", TenantSettings{EnrichmentProvider: &provider, RetentionDays: &days})
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme Inc", updated.Name)
+	assert.Equal(t, &provider, updated.Settings.EnrichmentProvider)
+	assert.Equal(t, &days, updated.Settings.RetentionDays)
+
+	// The settings are reset to the defaults with nil
+	updated, err = tdb.UpdateTenant(ctx, id, "Acme Inc", TenantSettings{})
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Settings.EnrichmentProvider)
+
+	tenants, err := tdb.GetTenants(ctx)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(tenants), 2)
+
+	_, err = tdb.GetTenant(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+	_, err = tdb.UpdateTenant(ctx, "unknown", "Unknown", TenantSettings{})
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tdb := getTestDatabase(context.Background(), t)
+
+	suffix := time.Now().UnixNano()
+	acme := WithTenant(context.Background(), fmt.Sprintf("acme-%d", suffix))
+	globex := WithTenant(context.Background(), fmt.Sprintf("globex-%d", suffix))
+
+	// Both tenants have an agent of the same IP address
+	ip := fmt.Sprintf("10.%d.%d.%d", suffix%250, suffix/250%250, suffix/62500%250)
+	acmeAgent, err := tdb.CreateNewAgent(acme, &Agent{IPAddress: ip, Country: "US"})
+	assert.NoError(t, err)
+	globexAgent, err := tdb.CreateNewAgent(globex, &Agent{IPAddress: ip, Country: "US"})
+	assert.NoError(t, err)
+	_, err = tdb.CreateAgentWithEnrichmentJob(globex, &Agent{IPAddress: ip}, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, TenantFromContext(acme), acmeAgent.TenantID)
+
+	filter := &AgentFilter{IPAddress: &ip}
+
+	// The agents of the other tenant are not found
+	_, err = tdb.GetAgentByID(acme, globexAgent.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	assert.ErrorIs(t, tdb.DeleteAgent(acme, globexAgent.ID), ErrAgentNotFound)
+	assert.ErrorIs(t, tdb.PurgeAgent(acme, globexAgent.ID), ErrAgentNotFound)
+	_, err = tdb.RestoreAgent(acme, globexAgent.ID)
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+	_, err = tdb.UpdateAgent(acme, &Agent{ID: globexAgent.ID, IPAddress: ip, ASN: "AS1"})
+	assert.NoError(t, err)
+
+	// The listings, counts and aggregates only include the agents of the tenant
+	result, err := tdb.GetAllAgents(acme, filter, 1, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.TotalAgents)
+	assert.Equal(t, acmeAgent.ID, result.Agents[0].ID)
+
+	page, err := tdb.GetAgentsPage(globex, filter, nil, 10, nil)
+	assert.NoError(t, err)
+	assert.Len(t, page.Agents, 2)
+	for _, a := range page.Agents {
+		assert.Equal(t, TenantFromContext(globex), a.TenantID)
+	}
+
+	count, err := tdb.CountAgents(acme, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	facets, err := tdb.GetAgentFacets(acme, filter, []string{"country"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []FacetValue{{Value: "US", Count: 1}}, facets["country"])
+
+	stats, err := tdb.GetAgentStats(globex, filter, nil, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats[0].Count)
+
+	var batched []uint
+	err = tdb.FindAgentsInBatches(acme, filter, 10, func(agents []Agent) error {
+		for _, a := range agents {
+			batched = append(batched, a.ID)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{acmeAgent.ID}, batched)
+
+	existing, err := tdb.FindExistingIPAddresses(WithTenant(context.Background(), "unknown"), []string{ip})
+	assert.NoError(t, err)
+	assert.Empty(t, existing)
+
+	// The agents are not changed by the updates of another tenant
+	agent, err := tdb.GetAgentByID(globex, globexAgent.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, agent.ASN)
+
+	// Deleting all the agents of a tenant keeps the agents of the other tenant
+	deleted, err := tdb.BulkDeleteAgents(globex, filter, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	_, err = tdb.GetAgentByID(acme, acmeAgent.ID)
+	assert.NoError(t, err)
+
+	// Purging the deleted agents only purges the agents of the tenant
+	purged, err := tdb.PurgeDeletedAgents(acme, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = tdb.PurgeDeletedAgents(globex, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	tracing "argus/pkg/otel"
+	"context"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// UsageRollup is the usage of an API key on an endpoint with a response status in an hour.
+// APIKeyID is zero for the bootstrap key, Status is zero for the work done by the background workers.
+type UsageRollup struct {
+	APIKeyID uint      `gorm:"primaryKey;autoIncrement:false"`
+	Bucket   time.Time `gorm:"primaryKey;index"`
+	Endpoint string    `gorm:"primaryKey"`
+	Status   int       `gorm:"primaryKey;autoIncrement:false"`
+	Requests int64     `gorm:"not null"`
+	// UpstreamLookups is the number of IP addresses looked up from the upstream providers
+	UpstreamLookups int64 `gorm:"not null"`
+}
+
+// UsageFilter filters the usage by the key and the time range [From, To)
+type UsageFilter struct {
+	APIKeyID *uint
+	From     time.Time
+	To       time.Time
+}
+
+// UsageRow is the usage of an API key on an endpoint with a response status, the key is empty for the bootstrap key
+type UsageRow struct {
+	APIKeyID        uint
+	Prefix          string
+	Name            string
+	Owner           string
+	Endpoint        string
+	Status          int
+	Requests        int64
+	UpstreamLookups int64
+}
+
+// AddUsage adds the usage to the rollups
+func (gdb *GormDB) AddUsage(ctx context.Context, rollups []UsageRollup) error {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "AddUsage")
+	defer span.End()
+
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	return gdb.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "api_key_id"}, {Name: "bucket"}, {Name: "endpoint"}, {Name: "status"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"requests":         gorm.Expr("usage_rollups.requests + excluded.requests"),
+			"upstream_lookups": gorm.Expr("usage_rollups.upstream_lookups + excluded.upstream_lookups"),
+		}),
+	}).Create(&rollups).Error
+}
+
+// GetUsage sums the usage in the time range by the key, endpoint and status
+func (gdb *GormDB) GetUsage(ctx context.Context, filter UsageFilter) ([]UsageRow, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetUsage")
+	defer span.End()
+
+	query := gdb.db.WithContext(ctx).
+		Table("usage_rollups").
+		Select("usage_rollups.api_key_id, api_keys.prefix, api_keys.name, api_keys.owner, usage_rollups.endpoint, "+
+			"usage_rollups.status, SUM(usage_rollups.requests) AS requests, "+
+			"SUM(usage_rollups.upstream_lookups) AS upstream_lookups").
+		Joins("LEFT JOIN api_keys ON api_keys.id = usage_rollups.api_key_id").
+		Where("usage_rollups.bucket >= ? AND usage_rollups.bucket < ?", filter.From, filter.To).
+		Group("usage_rollups.api_key_id, api_keys.prefix, api_keys.name, api_keys.owner, usage_rollups.endpoint, usage_rollups.status").
+		Order("usage_rollups.api_key_id, usage_rollups.endpoint, usage_rollups.status")
+	if filter.APIKeyID != nil {
+		query = query.Where("usage_rollups.api_key_id = ?", *filter.APIKeyID)
+	}
+
+	var rows []struct {
+		APIKeyID        uint
+		Prefix          *string
+		Name            *string
+		Owner           *string
+		Endpoint        string
+		Status          int
+		Requests        int64
+		UpstreamLookups int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	usage := make([]UsageRow, len(rows))
+	for i, r := range rows {
+		usage[i] = UsageRow{
+			APIKeyID:        r.APIKeyID,
+			Endpoint:        r.Endpoint,
+			Status:          r.Status,
+			Requests:        r.Requests,
+			UpstreamLookups: r.UpstreamLookups,
+		}
+		if r.Prefix != nil {
+			usage[i].Prefix, usage[i].Name, usage[i].Owner = *r.Prefix, *r.Name, *r.Owner
+		}
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAddUsage(t *testing.T) {
+	ctx := context.Background()
+	tdb := getTestDatabase(ctx, t)
+
+	hour := time.Date(2030, 1, 2, 3, 0, 0, 0, time.UTC)
+	keyID := uint(900001)
+
+	// The usage of the same key, bucket, endpoint and status is summed
+	assert.NoError(t, tdb.AddUsage(ctx, []UsageRollup{
+		{APIKeyID: keyID, Bucket: hour, Endpoint: "POST /api/v1/agents", Status: 201, Requests: 1, UpstreamLookups: 1},
+		{APIKeyID: keyID, Bucket: hour, Endpoint: "POST /api/v1/agents", Status: 400, Requests: 1},
+	}))
+	assert.NoError(t, tdb.AddUsage(ctx, []UsageRollup{
+		{APIKeyID: keyID, Bucket: hour, Endpoint: "POST /api/v1/agents", Status: 201, Requests: 2, UpstreamLookups: 3},
+		{APIKeyID: keyID, Bucket: hour.Add(time.Hour), Endpoint: "POST /api/v1/agents", Status: 201, Requests: 1},
+	}))
+	assert.NoError(t, tdb.AddUsage(ctx, nil), "adding nothing should not fail")
+
+	usage, err := tdb.GetUsage(ctx, UsageFilter{APIKeyID: &keyID, From: hour, To: hour.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, []UsageRow{
+		{APIKeyID: keyID, Endpoint: "POST /api/v1/agents", Status: 201, Requests: 4, UpstreamLookups: 4},
+		{APIKeyID: keyID, Endpoint: "POST /api/v1/agents", Status: 400, Requests: 1},
+	}, usage)
+
+	// The time range excludes its end
+	usage, err = tdb.GetUsage(ctx, UsageFilter{APIKeyID: &keyID, From: hour.Add(time.Hour), To: hour.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, []UsageRow{{APIKeyID: keyID, Endpoint: "POST /api/v1/agents", Status: 201, Requests: 1}}, usage)
+}
@@ -0,0 +1,219 @@
+package enrichment
+
+import (
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/internal/usage"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// UsageEndpoint is the endpoint the upstream lookups of the jobs are counted on in the usage
+const UsageEndpoint = "enrichment"
+
+// Default values of the worker options
+const (
+	DefaultConcurrency  = 4
+	DefaultPollInterval = time.Second
+	DefaultLease        = time.Minute
+	DefaultTimeout      = 10 * time.Second
+	DefaultMinBackoff   = 5 * time.Second
+	DefaultMaxBackoff   = 10 * time.Minute
+)
+
+// Options of the worker, zero values are replaced by the defaults
+type Options struct {
+	// Concurrency is the number of jobs processed at the same time
+	Concurrency int
+	// PollInterval is the time between checking the queue when it is empty
+	PollInterval time.Duration
+	// Lease is the time a claimed job is locked for, it is claimed again if the worker dies before finishing it
+	Lease time.Duration
+	// Timeout of gathering the stats of each IP address
+	Timeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay of retrying a failed job
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Meter counts the upstream lookups for the keys which created the agents, it is optional
+	Meter *usage.Meter
+}
+
+// Worker enriches the pending agents by processing the enrichment jobs in the database
+type Worker struct {
+	db       db.DB
+	gatherer iputil.IPStatsGatherer
+	opts     Options
+}
+
+func New(database db.DB, gatherer iputil.IPStatsGatherer, opts Options) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLease
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.MinBackoff)
+	}
+
+	return &Worker{db: database, gatherer: gatherer, opts: opts}
+}
+
+// Run processes the jobs until the context is canceled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep claiming while the queue has more jobs than the worker can take at once
+		for ctx.Err() == nil {
+			if w.RunOnce(ctx) < w.opts.Concurrency {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims the due jobs and processes them, it returns the number of claimed jobs
+func (w *Worker) RunOnce(ctx context.Context) int {
+	jobs, err := w.db.ClaimEnrichmentJobs(ctx, w.opts.Concurrency, w.opts.Lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Warn("cannot claim enrichment jobs")
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(job *db.EnrichmentJob) {
+			defer wg.Done()
+			w.process(ctx, job)
+		}(&jobs[i])
+	}
+	wg.Wait()
+
+	return len(jobs)
+}
+
+// process enriches the agent of the job and stores the result of the job
+func (w *Worker) process(ctx context.Context, job *db.EnrichmentJob) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "ProcessEnrichmentJob")
+	defer span.End()
+
+	log := logger.WithFields(logrus.Fields{"job_id": job.ID, "agent_id": job.AgentID, "tenant": job.TenantID, "attempt": job.Attempts})
+
+	// The agent is only reachable with the context of its tenant
+	ctx = db.WithTenant(ctx, job.TenantID)
+	agent, err := w.db.GetAgentByID(ctx, job.AgentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The agent is deleted, retrying the job is useless
+			job.Attempts = job.MaxAttempts
+		}
+		w.fail(ctx, log, job, err)
+		return
+	}
+
+	if w.opts.Meter != nil {
+		ctx = iputil.WithUpstreamObserver(ctx, w.opts.Meter.Background(job.APIKeyID, UsageEndpoint))
+	}
+	gatherer, err := w.gathererOf(ctx, job)
+	if err != nil {
+		w.fail(ctx, log, job, err)
+		return
+	}
+	gatherCtx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	stats, err := gatherer.GetInfo(gatherCtx, agent.IPAddress)
+	cancel()
+	if err != nil {
+		w.fail(ctx, log, job, err)
+		return
+	}
+
+	err = w.db.CompleteEnrichmentJob(ctx, job, &db.Agent{
+		ASN:      stats.ASN,
+		ISP:      stats.ISP,
+		City:     stats.City,
+		Region:   stats.Region,
+		Country:  stats.Country,
+		Location: stats.Location,
+	})
+	if errors.Is(err, db.ErrEnrichmentJobLost) {
+		// The lease has expired and the job belongs to another worker, its result is left to it
+		log.Debug("enrichment job has been claimed by another worker")
+		return
+	}
+	if err != nil {
+		// The job is claimed again after its lease is expired
+		log.WithError(err).Warn("cannot complete enrichment job")
+		return
+	}
+	log.Debug("agent has been enriched")
+}
+
+// gathererOf returns the gatherer of the enrichment provider of the tenant of the job, or the default gatherer if the
+// tenant has no provider
+func (w *Worker) gathererOf(ctx context.Context, job *db.EnrichmentJob) (iputil.IPStatsGatherer, error) {
+	tenant, err := w.db.GetTenant(ctx, job.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Settings.EnrichmentProvider == nil {
+		return w.gatherer, nil
+	}
+
+	selector, ok := w.gatherer.(iputil.ProviderSelector)
+	if !ok {
+		return nil, iputil.ErrUnknownProvider
+	}
+	return selector.Provider(*tenant.Settings.EnrichmentProvider)
+}
+
+// fail retries the job later or dead-letters it if it has no attempts left
+func (w *Worker) fail(ctx context.Context, log *logrus.Entry, job *db.EnrichmentJob, cause error) {
+	log = log.WithError(cause)
+	err := w.db.FailEnrichmentJob(ctx, job, cause.Error(), time.Now().Add(w.backoff(job.Attempts)))
+	switch {
+	case errors.Is(err, db.ErrEnrichmentJobLost):
+		log.Debug("enrichment job has failed after being claimed by another worker")
+	case err != nil:
+		log.WithField("fail_error", err.Error()).Warn("cannot fail enrichment job")
+	case job.Attempts >= job.MaxAttempts:
+		log.Warn("enrichment job is dead")
+	default:
+		log.Debug("enrichment job has failed, it will be retried")
+	}
+}
+
+// backoff returns the delay of retrying a job after the given number of attempts
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.opts.MinBackoff
+	for i := 1; i < attempts && d < w.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, w.opts.MaxBackoff)
+}
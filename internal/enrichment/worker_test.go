@@ -0,0 +1,288 @@
+package enrichment
+
+import (
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/pkg/logger"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Setup the logger
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+	logger.SetupLogger(log)
+
+	m.Run()
+}
+
+// fakeDB keeps the agents, the enrichment jobs and the tenants in memory, the other methods of db.DB are not
+// implemented
+type fakeDB struct {
+	db.DB
+	mu      sync.Mutex
+	agents  map[uint]*db.Agent
+	jobs    []*db.EnrichmentJob
+	tenants map[string]*db.Tenant
+}
+
+func newFakeDB(agents ...*db.Agent) *fakeDB {
+	f := &fakeDB{agents: map[uint]*db.Agent{}, tenants: map[string]*db.Tenant{db.DefaultTenant: {ID: db.DefaultTenant}}}
+	for _, a := range agents {
+		a.EnrichmentStatus = db.EnrichmentPending
+		if a.TenantID == "" {
+			a.TenantID = db.DefaultTenant
+		}
+		f.agents[a.ID] = a
+		f.jobs = append(f.jobs, &db.EnrichmentJob{
+			ID:          uint(len(f.jobs) + 1),
+			AgentID:     a.ID,
+			TenantID:    a.TenantID,
+			Status:      db.JobQueued,
+			MaxAttempts: 2,
+		})
+	}
+	return f
+}
+
+func (f *fakeDB) job(agentID uint) db.EnrichmentJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, j := range f.jobs {
+		if j.AgentID == agentID {
+			return *j
+		}
+	}
+	return db.EnrichmentJob{}
+}
+
+func (f *fakeDB) GetAgentByID(ctx context.Context, agentID uint) (*db.Agent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.agents[agentID]
+	if !ok || a.TenantID != db.TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	agent := *a
+	return &agent, nil
+}
+
+func (f *fakeDB) GetTenant(ctx context.Context, tenantID string) (*db.Tenant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tenants[tenantID]
+	if !ok {
+		return nil, db.ErrTenantNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeDB) ClaimEnrichmentJobs(ctx context.Context, limit int, lease time.Duration) ([]db.EnrichmentJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []db.EnrichmentJob
+	for _, j := range f.jobs {
+		if len(claimed) < limit && j.Status == db.JobQueued && !j.RunAt.After(time.Now()) {
+			lockedUntil := time.Now().Add(lease)
+			j.Status, j.LockedUntil = db.JobRunning, &lockedUntil
+			j.Attempts++
+			claimed = append(claimed, *j)
+		}
+	}
+	return claimed, nil
+}
+
+// lost reports whether the job is no longer running under the lease it has been claimed with
+func (f *fakeDB) lost(job *db.EnrichmentJob) bool {
+	j := f.jobs[job.ID-1]
+	return j.Status != db.JobRunning || j.LockedUntil == nil || job.LockedUntil == nil || !j.LockedUntil.Equal(*job.LockedUntil)
+}
+
+func (f *fakeDB) CompleteEnrichmentJob(ctx context.Context, job *db.EnrichmentJob, agent *db.Agent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lost(job) {
+		return db.ErrEnrichmentJobLost
+	}
+	a := f.agents[job.AgentID]
+	if a.TenantID != db.TenantFromContext(ctx) {
+		return errors.New("the agent belongs to another tenant")
+	}
+	a.ASN, a.ISP, a.Country = agent.ASN, agent.ISP, agent.Country
+	a.EnrichmentStatus = db.EnrichmentCompleted
+	f.jobs[job.ID-1].Status, f.jobs[job.ID-1].LockedUntil = db.JobSucceeded, nil
+	return nil
+}
+
+func (f *fakeDB) FailEnrichmentJob(ctx context.Context, job *db.EnrichmentJob, reason string, retryAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lost(job) {
+		return db.ErrEnrichmentJobLost
+	}
+	j := f.jobs[job.ID-1]
+	j.LastError, j.LockedUntil = reason, nil
+	if job.Attempts < job.MaxAttempts {
+		j.Status, j.RunAt = db.JobQueued, retryAt
+		return nil
+	}
+	j.Status = db.JobDead
+	if a, ok := f.agents[job.AgentID]; ok {
+		a.EnrichmentStatus = db.EnrichmentFailed
+	}
+	return nil
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+
+	gatherer, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClientWithPartialFailure{FailedIPs: []string{"1.1.1.1"}})
+	assert.NoError(t, err)
+
+	fdb := newFakeDB(
+		&db.Agent{ID: 1, IPAddress: "8.8.8.8"},
+		&db.Agent{ID: 2, IPAddress: "1.1.1.1"},
+		&db.Agent{ID: 3, IPAddress: "8.8.4.4"},
+	)
+	// The third agent is purged before its enrichment
+	delete(fdb.agents, 3)
+
+	w := New(fdb, gatherer, Options{Concurrency: 10, MinBackoff: time.Minute})
+
+	// First attempt
+	assert.Equal(t, 3, w.RunOnce(ctx))
+
+	assert.Equal(t, db.EnrichmentCompleted, fdb.agents[1].EnrichmentStatus)
+	assert.Equal(t, "US", fdb.agents[1].Country)
+	assert.Equal(t, "AS15169", fdb.agents[1].ASN)
+	assert.Equal(t, db.JobSucceeded, fdb.job(1).Status)
+
+	retried := fdb.job(2)
+	assert.Equal(t, db.JobQueued, retried.Status)
+	assert.Equal(t, "cannot get ip info", retried.LastError)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), retried.RunAt, 5*time.Second)
+	assert.Equal(t, db.EnrichmentPending, fdb.agents[2].EnrichmentStatus)
+
+	assert.Equal(t, db.JobDead, fdb.job(3).Status)
+
+	// The retry is not due yet
+	assert.Equal(t, 0, w.RunOnce(ctx))
+
+	// Last attempt
+	fdb.jobs[1].RunAt = time.Now()
+	assert.Equal(t, 1, w.RunOnce(ctx))
+	assert.Equal(t, db.JobDead, fdb.job(2).Status)
+	assert.Equal(t, db.EnrichmentFailed, fdb.agents[2].EnrichmentStatus)
+}
+
+func TestWorker_TenantProvider(t *testing.T) {
+	ctx := context.Background()
+
+	defaultGatherer, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClientWithError{})
+	assert.NoError(t, err)
+	otherGatherer, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	providers := iputil.NewProviders(iputil.ProviderIPInfo, defaultGatherer)
+	providers.Register("other", otherGatherer)
+
+	fdb := newFakeDB(
+		&db.Agent{ID: 1, IPAddress: "8.8.8.8", TenantID: "acme"},
+		&db.Agent{ID: 2, IPAddress: "8.8.4.4"},
+		&db.Agent{ID: 3, IPAddress: "1.1.1.1", TenantID: "unknown"},
+	)
+	other := "other"
+	fdb.tenants["acme"] = &db.Tenant{ID: "acme", Settings: db.TenantSettings{EnrichmentProvider: &other}}
+
+	w := New(fdb, providers, Options{Concurrency: 10, MinBackoff: time.Minute})
+	assert.Equal(t, 3, w.RunOnce(ctx))
+
+	// The agent of the tenant is enriched by the provider of the tenant, the others by the default provider
+	assert.Equal(t, db.JobSucceeded, fdb.job(1).Status)
+	assert.Equal(t, "AS15169", fdb.agents[1].ASN)
+	assert.Equal(t, db.JobQueued, fdb.job(2).Status)
+	assert.Equal(t, db.EnrichmentPending, fdb.agents[2].EnrichmentStatus)
+	assert.Equal(t, db.ErrTenantNotFound.Error(), fdb.job(3).LastError)
+}
+
+func TestWorker_LostLease(t *testing.T) {
+	ctx := context.Background()
+
+	gatherer, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClientWithPartialFailure{FailedIPs: []string{"1.1.1.1"}})
+	assert.NoError(t, err)
+
+	fdb := newFakeDB(&db.Agent{ID: 1, IPAddress: "8.8.8.8"}, &db.Agent{ID: 2, IPAddress: "1.1.1.1"})
+	w := New(fdb, gatherer, Options{MinBackoff: time.Minute})
+
+	// Both jobs are claimed again by another worker after their lease has expired
+	stale, err := fdb.ClaimEnrichmentJobs(ctx, 10, -time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, stale, 2)
+	for _, j := range fdb.jobs {
+		lockedUntil := time.Now().Add(time.Minute)
+		j.LockedUntil = &lockedUntil
+		j.Attempts++
+	}
+
+	// The results of the stale claims are dropped, the jobs are left to their new owner
+	for i := range stale {
+		w.process(ctx, &stale[i])
+	}
+	assert.Equal(t, db.EnrichmentPending, fdb.agents[1].EnrichmentStatus)
+	assert.Empty(t, fdb.agents[1].ASN)
+	assert.Equal(t, db.JobRunning, fdb.job(1).Status)
+	assert.Equal(t, db.JobRunning, fdb.job(2).Status)
+	assert.Empty(t, fdb.job(2).LastError)
+}
+
+func TestWorkerRun(t *testing.T) {
+	gatherer, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	fdb := newFakeDB(&db.Agent{ID: 1, IPAddress: "8.8.8.8"}, &db.Agent{ID: 2, IPAddress: "8.8.4.4"})
+	w := New(fdb, gatherer, Options{Concurrency: 1, PollInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	// Both jobs are processed without waiting for the poll interval
+	assert.Eventually(t, func() bool {
+		return fdb.job(1).Status == db.JobSucceeded && fdb.job(2).Status == db.JobSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not stop after the context was canceled")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	w := New(nil, nil, Options{MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+		{attempts: 100, expected: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, w.backoff(tt.attempts), "attempts: %d", tt.attempts)
+	}
+}
@@ -2,16 +2,26 @@ package handlers
 
 import (
 	"argus/internal/db"
+	"argus/internal/importer"
+	"argus/internal/iputil"
+	"argus/pkg/filterql"
 	"argus/pkg/logger"
 	tracing "argus/pkg/otel"
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel"
+	"io"
 	"math"
+	"net"
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,6 +29,49 @@ import (
 const (
 	AgentsDefaultPage     = 1
 	AgentsDefaultPageSize = 10
+	AgentsMaxPageSize     = 100
+)
+
+// IPStatsTimeout is the maximum duration of gathering stats about an IP address
+const IPStatsTimeout = 2 * time.Second
+
+const (
+	BulkDeleteChunkSize  = 1000
+	BulkDeleteSampleSize = 10
+)
+
+// ExportBatchSize is the number of agents read from the database at once while exporting
+const ExportBatchSize = 1000
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+)
+
+const (
+	// BatchCreateMaxAgents is the maximum number of agents created in a batch
+	BatchCreateMaxAgents = 100
+	// BatchCreateConcurrency is the maximum number of IP addresses enriched at the same time in a batch,
+	// when the provider cannot gather the stats of multiple IP addresses at once
+	BatchCreateConcurrency = 8
+)
+
+const (
+	// ImportConcurrency is the maximum number of IP addresses enriched at the same time in an import
+	ImportConcurrency = 8
+	// ImportBatchSize is the number of lines processed and inserted together in an import
+	ImportBatchSize = 500
+	// ImportMaxBodySize is the maximum size of an imported file in bytes
+	ImportMaxBodySize = 32 << 20
+	// ImportJobRetention is the duration the finished import jobs are kept
+	ImportJobRetention = 24 * time.Hour
+)
+
+// Counting methods of the agents in keyset pagination
+const (
+	TotalExact    = "exact"
+	TotalEstimate = "estimate"
+	TotalNone     = "none"
 )
 
 const (
@@ -26,19 +79,118 @@ const (
 	Desc = "desc"
 )
 
+const (
+	AgentsDefaultFacetsLimit = 10
+	AgentsMaxFacetsLimit     = 100
+)
+
 var (
-	ValidAgentSorts  = []string{"id"}      // ValidAgentSorts defines valid fields for sorting agents.
-	ValidAgentOrders = []string{Asc, Desc} // ValidAgentOrders defines valid sorting orders.
+	ValidAgentFacets = []string{"country", "asn", "isp", "city", "region"}    // ValidAgentFacets defines valid fields for faceted counts.
+	ValidAgentSorts  = []string{"id", "created_at", "country", "asn", "city"} // ValidAgentSorts defines valid fields for sorting agents.
+	ValidAgentOrders = []string{Asc, Desc}                                    // ValidAgentOrders defines valid sorting orders.
 )
 
+// selectIPStatsGatherer selects the gatherer of the given provider (empty for the provider of the tenant, or the
+// default one). In case of an unknown provider, it writes the error response and returns false.
+func (gh *GinHandler) selectIPStatsGatherer(c *gin.Context, provider string) (iputil.IPStatsGatherer, bool) {
+	if provider == "" {
+		if t := tenantFromContext(c); t != nil && t.Settings.EnrichmentProvider != nil {
+			provider = *t.Settings.EnrichmentProvider
+		}
+	}
+
+	selector, ok := gh.ipStatsGatherer.(iputil.ProviderSelector)
+	if !ok {
+		if provider != "" {
+			logger.WithField("provider", provider).Debug("the ip stats gatherer does not support providers")
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown provider"})
+			return nil, false
+		}
+		return gh.ipStatsGatherer, true
+	}
+
+	gatherer, err := selector.Provider(provider)
+	if err != nil {
+		logger.WithField("provider", provider).WithError(err).Debug("cannot select the provider")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown provider"})
+		return nil, false
+	}
+
+	return gatherer, true
+}
+
+// ipStatsErrorMessage returns the message of the error of gathering the stats of an IP address
+func ipStatsErrorMessage(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout exceeded"
+	}
+	return "cannot gather statistics for this IP address"
+}
+
+// gatherIPStats gathers the stats of the IP address using the given provider (empty for the default one).
+// In case of failure, it writes the error response and returns false.
+func (gh *GinHandler) gatherIPStats(ctx context.Context, c *gin.Context, provider string, ip string) (*iputil.Stats, bool) {
+	gatherer, ok := gh.selectIPStatsGatherer(c, provider)
+	if !ok {
+		return nil, false
+	}
+
+	// Create a context timeout to circuit break in case of long API call
+	getIPInfoCtx, cancel := context.WithTimeout(ctx, IPStatsTimeout)
+	defer cancel()
+	stats, err := gatherer.GetInfo(getIPInfoCtx, ip)
+	if err != nil {
+		logger.WithField("ip", ip).WithError(err).Warn("cannot gather statistics for this IP address")
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ipStatsErrorMessage(err)})
+		return nil, false
+	}
+
+	return stats, true
+}
+
+// parseAgentID parses the agent_id path parameter, it writes the error response in case of an invalid id.
+func parseAgentID(c *gin.Context) (uint, bool) {
+	agentIDParam, err := strconv.ParseUint(c.Param("agent_id"), 10, 0)
+	if err != nil {
+		logger.WithError(err).Warn("cannot parse agent id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "agent_id is not provided or is not valid",
+		})
+		return 0, false
+	}
+
+	return uint(agentIDParam), true
+}
+
+// respondFilterError writes the error response of invalid filter query params,
+// errors of the filter query also point to the position of the error.
+func respondFilterError(c *gin.Context, err error) {
+	logger.WithError(err).Debug("cannot parse the filter query params")
+
+	var queryErr *filterql.Error
+	if errors.As(err, &queryErr) {
+		c.JSON(http.StatusBadRequest, QueryErrorResponse{
+			Error:    err.Error(),
+			Position: queryErr.Pos,
+		})
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+}
+
 // HandleCreateAgent handles requests to create a new agent
 // @Summary Create a new agent
-// @Description Create a new agent with the provided IP address and retrieve its details
+// @Description Create a new agent with the provided IP address and retrieve its details.
+// @Description With async, the agent is created as pending and the Location header points to the status of its
+// @Description enrichment job.
 // @Tags agents
 // @Accept json
 // @Produce json
 // @Param request body CreateAgentRequest true "Request body for creating a new agent"
+// @Param async query bool false "Create the agent as pending and gather its details in the background"
 // @Success 201 {object} CreateAgentResponse "Successfully created agent"
+// @Success 202 {object} CreateAgentResponse "The agent has been created and its details will be gathered"
 // @Failure 400 {object} ErrorResponse "Bad request"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /agents [post]
@@ -46,6 +198,14 @@ func (gh *GinHandler) HandleCreateAgent(c *gin.Context) {
 	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleCreateAgent")
 	defer span.End()
 
+	// Handle query params
+	var queryParams CreateAgentQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+
 	var createRequest CreateAgentRequest
 	if err := c.ShouldBindJSON(&createRequest); err != nil {
 		logger.WithError(err).Debug("cannot parse create new agent request")
@@ -61,20 +221,41 @@ func (gh *GinHandler) HandleCreateAgent(c *gin.Context) {
 		return
 	}
 
-	// Create a context timeout to circuit break in case of long API call
-	getIPInfoCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
-	// Make a call to IPInfo to get the stats about IP
-	stats, err := gh.ipStatsGatherer.GetInfo(getIPInfoCtx, createRequest.IPAddress)
+	if queryParams.Async {
+		gh.createAgentAsync(ctx, c, createRequest.IPAddress)
+		return
+	}
+	gh.createAgent(ctx, c, createRequest.IPAddress)
+}
+
+// createAgentAsync creates a pending agent and queues the job of gathering its stats, then writes the response
+func (gh *GinHandler) createAgentAsync(ctx context.Context, c *gin.Context, ip string) {
+	// The lookups of the job are counted for the key creating the agent
+	var apiKeyID uint
+	if apiKey := apiKeyFromContext(c); apiKey != nil {
+		apiKeyID = apiKey.ID
+	}
+
+	agent, err := gh.db.CreateAgentWithEnrichmentJob(ctx, &db.Agent{IPAddress: ip}, max(gh.cfg.Enrichment.MaxAttempts, 1), apiKeyID)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			logger.WithField("ip", createRequest.IPAddress).WithError(err).Warn("timeout exceeded for IPInfo API")
-			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "timeout exceeded"})
-			return
-		}
+		logger.WithError(err).Warn("cannot create pending agent")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create agent"})
+		return
+	}
+
+	setAuditResourceID(c, agent.ID)
+	c.Header("Location", fmt.Sprintf("%s/%d/enrichment", c.Request.URL.Path, agent.ID))
+	c.JSON(http.StatusAccepted, CreateAgentResponse{
+		Message: "agent has been created, its details will be gathered in the background",
+		Agent:   newAgent(agent),
+	})
+}
 
-		logger.WithField("ip", createRequest.IPAddress).WithError(err).Warn("cannot gather statistics for this IP address")
-		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "cannot gather statistics for this IP address"})
+// createAgent gathers the stats of the IP address and creates its agent, then writes the response
+func (gh *GinHandler) createAgent(ctx context.Context, c *gin.Context, ip string) {
+	// Make a call to IPInfo to get the stats about IP
+	stats, ok := gh.gatherIPStats(ctx, c, "", ip)
+	if !ok {
 		return
 	}
 
@@ -84,6 +265,7 @@ func (gh *GinHandler) HandleCreateAgent(c *gin.Context) {
 		ASN:       stats.ASN,
 		ISP:       stats.ISP,
 		City:      stats.City,
+		Region:    stats.Region,
 		Country:   stats.Country,
 		Location:  stats.Location,
 	})
@@ -93,21 +275,170 @@ func (gh *GinHandler) HandleCreateAgent(c *gin.Context) {
 		return
 	}
 
+	setAuditResourceID(c, agent.ID)
 	c.JSON(http.StatusCreated, CreateAgentResponse{
 		Message: "agent has been created successfully",
-		Agent: Agent{
-			ID:        agent.ID,
-			CreatedAt: agent.CreatedAt,
-			IPAddress: agent.IPAddress,
-			ASN:       agent.ASN,
-			ISP:       agent.ISP,
-			City:      agent.City,
-			Country:   agent.Country,
-			Location:  agent.Location,
-		},
+		Agent:   newAgent(agent),
 	})
 }
 
+// RequireAgentsMethod rejects the requests of the custom methods of the agents collection other than the given one,
+// e.g. ":batch" for /agents:batch. Gin routes the colon as a param, so the method should be checked before the other
+// handlers, e.g. before the request is audited.
+func (gh *GinHandler) RequireAgentsMethod(method string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("method") != method {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "unknown method"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HandleBatchCreateAgents handles requests to create multiple agents
+// @Summary Create multiple agents
+// @Description Create agents for the IP addresses, each of them succeeds or fails separately.
+// @Description The status of each result is the HTTP status code of creating it on its own, the repeated IP addresses are 409.
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param request body BatchCreateAgentsRequest true "Request body for creating multiple agents"
+// @Param provider query string false "Name of the IP stats provider to use, default is the configured one"
+// @Success 207 {object} BatchCreateAgentsResponse "The result of creating each agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Router /agents:batch [post]
+func (gh *GinHandler) HandleBatchCreateAgents(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleBatchCreateAgents")
+	defer span.End()
+
+	var queryParams BatchCreateAgentsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	var batchRequest BatchCreateAgentsRequest
+	if err := c.ShouldBindJSON(&batchRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse batch create agents request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := batchRequest.validate(); err != nil {
+		logger.WithError(err).Debug("cannot validate batch create agents request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	gatherer, ok := gh.selectIPStatsGatherer(c, queryParams.Provider)
+	if !ok {
+		return
+	}
+
+	// Validate and normalize each of the IP addresses, the repeated ones are only created once
+	results := make([]BatchCreateAgentResult, len(batchRequest.IPAddresses))
+	var valid []int
+	var ips []string
+	seen := map[string]bool{}
+	for i, ip := range batchRequest.IPAddresses {
+		results[i].IPAddress = ip
+		if err := (CreateAgentRequest{IPAddress: ip}).validate(); err != nil {
+			results[i].Status, results[i].Error = http.StatusBadRequest, err.Error()
+			continue
+		}
+		ip = net.ParseIP(ip).String()
+		if seen[ip] {
+			results[i].Status, results[i].Error = http.StatusConflict, "IP address is repeated in the request"
+			continue
+		}
+		seen[ip] = true
+		valid = append(valid, i)
+		ips = append(ips, ip)
+	}
+
+	// Gather the stats of the valid IP addresses
+	var agents []*db.Agent
+	var created []int
+	for j, result := range gh.gatherIPStatsBatch(ctx, gatherer, ips) {
+		i := valid[j]
+		if result.Err != nil {
+			logger.WithField("ip", ips[j]).WithError(result.Err).Warn("cannot gather statistics for this IP address")
+			results[i].Status, results[i].Error = http.StatusServiceUnavailable, ipStatsErrorMessage(result.Err)
+			continue
+		}
+		agents = append(agents, &db.Agent{
+			IPAddress: ips[j],
+			ASN:       result.Stats.ASN,
+			ISP:       result.Stats.ISP,
+			City:      result.Stats.City,
+			Region:    result.Stats.Region,
+			Country:   result.Stats.Country,
+			Location:  result.Stats.Location,
+		})
+		created = append(created, i)
+	}
+
+	// Create the rows in database, one by one if the batch fails so that only the failing agents fail
+	failed := make([]bool, len(agents))
+	if len(agents) > 0 {
+		if err := gh.db.CreateAgents(ctx, agents, len(agents)); err != nil {
+			logger.WithError(err).Warn("cannot create the batch of agents, creating them one by one")
+			for j, agent := range agents {
+				agent.ID = 0
+				if _, err = gh.db.CreateNewAgent(ctx, agent); err != nil {
+					logger.WithField("ip", agent.IPAddress).WithError(err).Warn("cannot create agent")
+					failed[j] = true
+				}
+			}
+		}
+	}
+	for j, i := range created {
+		if failed[j] {
+			results[i].Status, results[i].Error = http.StatusInternalServerError, "cannot create agent"
+			continue
+		}
+		agent := newAgent(agents[j])
+		results[i].Status, results[i].Agent = http.StatusCreated, &agent
+	}
+
+	response := BatchCreateAgentsResponse{
+		Message: "agents have been processed",
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Status == http.StatusCreated {
+			response.Created++
+		} else {
+			response.Failed++
+		}
+	}
+	var createdIDs []uint
+	for _, result := range results {
+		if result.Agent != nil {
+			createdIDs = append(createdIDs, result.Agent.ID)
+		}
+	}
+	setAuditDetail(c, "created", response.Created)
+	setAuditDetail(c, "failed", response.Failed)
+	setAuditIDs(c, "created_ids", createdIDs)
+	c.JSON(http.StatusMultiStatus, response)
+}
+
+// gatherIPStatsBatch gathers the stats of the IP addresses, in batches if the gatherer supports them,
+// otherwise in parallel with a limited concurrency.
+func (gh *GinHandler) gatherIPStatsBatch(ctx context.Context, gatherer iputil.IPStatsGatherer, ips []string) []iputil.BatchResult {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	// Create a context timeout to circuit break in case of long API calls, the lookups run in rounds of a batch
+	// request or of at most BatchCreateConcurrency requests, so the timeout of a lookup is given to each round
+	rounds := iputil.BatchRounds(gatherer, len(ips), BatchCreateConcurrency)
+	getIPInfoCtx, cancel := context.WithTimeout(ctx, time.Duration(rounds)*IPStatsTimeout)
+	defer cancel()
+
+	return iputil.GetInfoBatch(getIPInfoCtx, gatherer, ips, BatchCreateConcurrency)
+}
+
 // HandleGetAgents handles retrieving agents
 // @Summary Get a list of agents
 // @Description Retrieve a list of agents based on optional query parameters
@@ -115,12 +446,25 @@ func (gh *GinHandler) HandleCreateAgent(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number for pagination (default is 1)"
-// @Param page_size query int false "Number of agents per page (default is 10)"
+// @Param page_size query int false "Number of agents per page (default is 10, at most 100)"
 // @Param ip_address query string false "Filter agents by IP address"
-// @Param sort_by query string false "Field to sort agents by (e.g., 'id')"
+// @Param country query []string false "Filter agents by country codes" collectionFormat(csv)
+// @Param city query []string false "Filter agents by cities" collectionFormat(csv)
+// @Param region query []string false "Filter agents by regions" collectionFormat(csv)
+// @Param asn query []string false "Filter agents by ASNs (e.g., 'AS3320')" collectionFormat(csv)
+// @Param isp query string false "Filter agents by ISP containing this value"
+// @Param created_after query string false "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param q query string false "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'"
+// @Param sort_by query string false "Field to sort agents by ('id', 'created_at', 'country', 'asn' or 'city')"
 // @Param order query string false "Sorting order ('asc' or 'desc')"
+// @Param include_deleted query bool false "Include the soft deleted agents"
+// @Param cursor query string false "Cursor of keyset pagination, an empty cursor starts from the first page and page is ignored"
+// @Param total query string false "Counting method in keyset pagination ('exact', 'estimate' or 'none', default is 'estimate')"
+// @Param facets query []string false "Fields to count the matching agents by ('country', 'asn', 'isp', 'city' or 'region')" collectionFormat(csv)
+// @Param facets_limit query int false "Number of the most frequent values of each facet (default is 10)"
 // @Success 200 {object} GetAgentsResponse "Successfully retrieved agents"
-// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 400 {object} QueryErrorResponse "Bad request"
 // @Failure 404 {object} GetAgentsResponse "No agents found"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /agents [get]
@@ -141,16 +485,27 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 	if queryParams.PageSize == 0 {
 		queryParams.PageSize = AgentsDefaultPageSize
 	}
-	agentsFilter := &db.AgentFilter{}
-	if queryParams.IPAddress != "" {
-		agentsFilter.IPAddress = &queryParams.IPAddress
+	if queryParams.Page < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "page should be at least 1"})
+		return
+	}
+	if queryParams.PageSize < 1 || queryParams.PageSize > AgentsMaxPageSize {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: fmt.Sprintf("page_size should be between 1 and %d", AgentsMaxPageSize),
+		})
+		return
+	}
+	agentsFilter, err := queryParams.toFilter()
+	if err != nil {
+		respondFilterError(c, err)
+		return
 	}
 	agentSort := &db.AgentSort{}
 	if queryParams.SortBy != "" {
 		if !slices.Contains(ValidAgentSorts, queryParams.SortBy) {
 			logger.WithField("sort_by", queryParams.SortBy).Debug("cannot parse the sort by parameter")
 			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Error: "the valid fields are: id",
+				Error: "the valid fields are: " + strings.Join(ValidAgentSorts, ", "),
 			})
 			return
 		}
@@ -167,6 +522,17 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 		agentSort.OrderBy = &queryParams.Order
 	}
 
+	facetFields, ok := parseAgentFacets(c, &queryParams)
+	if !ok {
+		return
+	}
+
+	// Use keyset pagination when a cursor is given
+	if _, ok := c.GetQuery("cursor"); ok {
+		gh.handleGetAgentsPage(ctx, c, queryParams, agentsFilter, agentSort, facetFields)
+		return
+	}
+
 	// Retrieve agents from database
 	agentsResult, err := gh.db.GetAllAgents(ctx, agentsFilter, queryParams.Page, queryParams.PageSize, agentSort)
 	if err != nil {
@@ -180,6 +546,10 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 		CurrentPage: queryParams.Page,
 		PerPage:     queryParams.PageSize,
 	}
+	facets, ok := gh.getAgentFacets(ctx, c, agentsFilter, facetFields, queryParams.FacetsLimit)
+	if !ok {
+		return
+	}
 
 	// Handle no agent found
 	if len(agentsResult.Agents) == 0 {
@@ -188,6 +558,7 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 			Data: AgentsData{
 				Agents:     []Agent{},
 				Pagination: agentStats,
+				Facets:     facets,
 			},
 		})
 		return
@@ -195,13 +566,105 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 
 	// Converting the agents to response model
 	var agents []Agent
-	for _, a := range agentsResult.Agents {
-		agents = append(agents, Agent{
-			ID:        a.ID,
-			IPAddress: a.IPAddress,
-			CreatedAt: a.CreatedAt,
-			ASN:       a.ASN,
+	for i := range agentsResult.Agents {
+		agents = append(agents, newAgentSummary(&agentsResult.Agents[i]))
+	}
+
+	c.JSON(http.StatusOK, GetAgentsResponse{
+		Message: "retrieved agents successfully",
+		Data: AgentsData{
+			Agents:     agents,
+			Pagination: agentStats,
+			Facets:     facets,
+		},
+	})
+}
+
+// handleGetAgentsPage responds to HandleGetAgents using keyset pagination.
+// The cursors of the next and previous pages are returned both in the response and in the Link header.
+func (gh *GinHandler) handleGetAgentsPage(ctx context.Context, c *gin.Context, queryParams GetAgentsQueryParams, agentsFilter *db.AgentFilter, agentSort *db.AgentSort, facetFields []string) {
+	var cursor *db.AgentCursor
+	if queryParams.Cursor != "" {
+		var err error
+		cursor, err = db.DecodeAgentCursor(queryParams.Cursor)
+		if err != nil {
+			logger.WithError(err).Debug("cannot decode the cursor")
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid cursor"})
+			return
+		}
+	}
+	if queryParams.Total == "" {
+		queryParams.Total = TotalEstimate
+	}
+	if !slices.Contains([]string{TotalExact, TotalEstimate, TotalNone}, queryParams.Total) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "the valid totals are: exact, estimate, none",
 		})
+		return
+	}
+
+	// Retrieve agents from database
+	agentsPage, err := gh.db.GetAgentsPage(ctx, agentsFilter, cursor, queryParams.PageSize, agentSort)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid cursor"})
+			return
+		}
+		logger.WithError(err).Warn("cannot retrieve the agents from the database")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the agents from the database"})
+		return
+	}
+	agentStats := AgentPagination{
+		PerPage: queryParams.PageSize,
+	}
+	switch queryParams.Total {
+	case TotalExact:
+		agentStats.TotalAgents, err = gh.db.CountAgents(ctx, agentsFilter)
+	case TotalEstimate:
+		agentStats.TotalAgents, err = gh.db.EstimateAgentsCount(ctx, agentsFilter)
+		agentStats.TotalIsEstimate = true
+	}
+	if err != nil {
+		logger.WithError(err).Warn("cannot count the agents in the database")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot count the agents in the database"})
+		return
+	}
+
+	// Link the next and previous pages
+	var links []string
+	if agentsPage.NextCursor != nil {
+		agentStats.NextCursor = agentsPage.NextCursor.Encode()
+		links = append(links, cursorLink(c, agentStats.NextCursor, "next"))
+	}
+	if agentsPage.PrevCursor != nil {
+		agentStats.PrevCursor = agentsPage.PrevCursor.Encode()
+		links = append(links, cursorLink(c, agentStats.PrevCursor, "prev"))
+	}
+	facets, ok := gh.getAgentFacets(ctx, c, agentsFilter, facetFields, queryParams.FacetsLimit)
+	if !ok {
+		return
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+
+	// Handle no agent found
+	if len(agentsPage.Agents) == 0 {
+		c.JSON(http.StatusNotFound, GetAgentsResponse{
+			Message: "there is no agents for this page",
+			Data: AgentsData{
+				Agents:     []Agent{},
+				Pagination: agentStats,
+				Facets:     facets,
+			},
+		})
+		return
+	}
+
+	// Converting the agents to response model
+	var agents []Agent
+	for i := range agentsPage.Agents {
+		agents = append(agents, newAgentSummary(&agentsPage.Agents[i]))
 	}
 
 	c.JSON(http.StatusOK, GetAgentsResponse{
@@ -209,10 +672,71 @@ func (gh *GinHandler) HandleGetAgents(c *gin.Context) {
 		Data: AgentsData{
 			Agents:     agents,
 			Pagination: agentStats,
+			Facets:     facets,
 		},
 	})
 }
 
+// parseAgentFacets validates the requested facets, it writes the error response in case of invalid facets.
+func parseAgentFacets(c *gin.Context, queryParams *GetAgentsQueryParams) ([]string, bool) {
+	facetFields := splitQueryValues(queryParams.Facets, strings.ToLower)
+	for _, field := range facetFields {
+		if !slices.Contains(ValidAgentFacets, field) {
+			logger.WithField("facets", queryParams.Facets).Debug("cannot parse the facets parameter")
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "the valid facets are: " + strings.Join(ValidAgentFacets, ", "),
+			})
+			return nil, false
+		}
+	}
+	if queryParams.FacetsLimit == 0 {
+		queryParams.FacetsLimit = AgentsDefaultFacetsLimit
+	}
+	if queryParams.FacetsLimit < 0 || queryParams.FacetsLimit > AgentsMaxFacetsLimit {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: fmt.Sprintf("facets_limit should be between 1 and %d", AgentsMaxFacetsLimit),
+		})
+		return nil, false
+	}
+
+	return facetFields, true
+}
+
+// getAgentFacets counts the agents matching the filter by the values of the facet fields.
+// It writes the error response in case of failure.
+func (gh *GinHandler) getAgentFacets(ctx context.Context, c *gin.Context, agentsFilter *db.AgentFilter, facetFields []string, limit int) (map[string][]AgentFacetValue, bool) {
+	if len(facetFields) == 0 {
+		return nil, true
+	}
+
+	dbFacets, err := gh.db.GetAgentFacets(ctx, agentsFilter, facetFields, limit)
+	if err != nil {
+		logger.WithError(err).Warn("cannot count the facets of the agents")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot count the facets of the agents"})
+		return nil, false
+	}
+
+	facets := make(map[string][]AgentFacetValue, len(dbFacets))
+	for field, values := range dbFacets {
+		facets[field] = make([]AgentFacetValue, 0, len(values))
+		for _, v := range values {
+			facets[field] = append(facets[field], AgentFacetValue{Value: v.Value, Count: v.Count})
+		}
+	}
+
+	return facets, true
+}
+
+// cursorLink creates a Link header value pointing to the current request with another cursor
+func cursorLink(c *gin.Context, cursor string, rel string) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("cursor", cursor)
+	u.RawQuery = query.Encode()
+
+	return fmt.Sprintf("<%s>; rel=\"%s\"", u.RequestURI(), rel)
+}
+
 // HandleGetAgentDetail handles getting details about each agent
 // @Summary Get details of a specific agent
 // @Description Retrieve detailed information of a specific agent by ID
@@ -229,15 +753,10 @@ func (gh *GinHandler) HandleGetAgentDetail(c *gin.Context) {
 	defer span.End()
 
 	// Parsing the agent_id
-	agentIDParam, err := strconv.Atoi(c.Param("agent_id"))
-	if err != nil {
-		logger.WithError(err).Warn("cannot parse agent id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error: "agent_id is not provided or is not valid",
-		})
+	agentID, ok := parseAgentID(c)
+	if !ok {
 		return
 	}
-	agentID := uint(agentIDParam)
 
 	// Retrieve the agent from the database
 	agent, err := gh.db.GetAgentByID(ctx, agentID)
@@ -249,15 +768,622 @@ func (gh *GinHandler) HandleGetAgentDetail(c *gin.Context) {
 
 	c.JSON(http.StatusOK, AgentDetailedResponse{
 		Message: "agent has been retrieved successfully",
-		Agent: Agent{
-			ID:        agent.ID,
-			CreatedAt: agent.CreatedAt,
-			IPAddress: agent.IPAddress,
-			ASN:       agent.ASN,
-			ISP:       agent.ISP,
-			City:      agent.City,
-			Country:   agent.Country,
-			Location:  agent.Location,
-		},
+		Agent:   newAgent(agent),
+	})
+}
+
+// HandleGetEnrichmentJob handles getting the status of the enrichment job of an agent
+// @Summary Get the enrichment job of an agent
+// @Description Get the status, the attempts and the last error of the background enrichment of an agent created with
+// @Description async. Dead jobs have no attempts left and are kept for inspection.
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param agent_id path int true "ID of the agent"
+// @Success 200 {object} EnrichmentJobResponse
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Enrichment job not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents/{agent_id}/enrichment [get]
+func (gh *GinHandler) HandleGetEnrichmentJob(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetEnrichmentJob")
+	defer span.End()
+
+	agentID, ok := parseAgentID(c)
+	if !ok {
+		return
+	}
+
+	job, err := gh.db.GetEnrichmentJobOfAgent(ctx, agentID)
+	if err != nil {
+		if errors.Is(err, db.ErrEnrichmentJobNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "the agent has no enrichment job"})
+			return
+		}
+		logger.WithError(err).Warn("cannot retrieve the enrichment job")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the enrichment job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrichmentJobResponse{
+		Message: "enrichment job has been retrieved successfully",
+		Job:     newEnrichmentJob(job),
+	})
+}
+
+// HandleRefreshAgent handles re-running the enrichment of an agent
+// @Summary Refresh the details of an agent
+// @Description Gather fresh statistics about the IP address of an agent, store them and return both old and new values
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param agent_id path int true "ID of the agent to refresh"
+// @Param provider query string false "Name of the provider to gather statistics from (e.g., 'ipinfo')"
+// @Success 200 {object} RefreshAgentResponse "Successfully refreshed agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Agent not found"
+// @Failure 409 {object} ErrorResponse "The agent is still being enriched"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "Cannot gather statistics"
+// @Router /agents/{agent_id}/refresh [post]
+func (gh *GinHandler) HandleRefreshAgent(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleRefreshAgent")
+	defer span.End()
+
+	// Parsing the agent_id
+	agentID, ok := parseAgentID(c)
+	if !ok {
+		return
+	}
+
+	var queryParams RefreshAgentQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+
+	// Retrieve the agent from the database
+	agent, err := gh.db.GetAgentByID(ctx, agentID)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve agent by id")
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such agent by id"})
+		return
+	}
+	// The pending enrichment would overwrite the refreshed stats
+	if agent.EnrichmentStatus == db.EnrichmentPending {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "the agent is still being enriched, it can be refreshed once it is finished"})
+		return
+	}
+	before := newAgent(agent)
+
+	// Gather fresh stats about the IP
+	stats, ok := gh.gatherIPStats(ctx, c, queryParams.Provider, agent.IPAddress)
+	if !ok {
+		return
+	}
+
+	// Update the row in database, the failed enrichments are completed by the refresh
+	agent.EnrichmentStatus = db.EnrichmentCompleted
+	agent.ASN = stats.ASN
+	agent.ISP = stats.ISP
+	agent.City = stats.City
+	agent.Region = stats.Region
+	agent.Country = stats.Country
+	agent.Location = stats.Location
+	agent, err = gh.db.UpdateAgent(ctx, agent)
+	if err != nil {
+		logger.WithError(err).Warn("cannot update agent")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RefreshAgentResponse{
+		Message: "agent has been refreshed successfully",
+		Before:  before,
+		After:   newAgent(agent),
+	})
+}
+
+// HandleDeleteAgent handles soft deleting an agent
+// @Summary Delete an agent
+// @Description Soft delete an agent, it is excluded from the lists and can be restored later
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param agent_id path int true "ID of the agent to delete"
+// @Success 200 {object} DeleteAgentResponse "Successfully deleted agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Agent not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents/{agent_id} [delete]
+func (gh *GinHandler) HandleDeleteAgent(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleDeleteAgent")
+	defer span.End()
+
+	// Parsing the agent_id
+	agentID, ok := parseAgentID(c)
+	if !ok {
+		return
+	}
+
+	// Soft delete the agent
+	err := gh.db.DeleteAgent(ctx, agentID)
+	if err != nil {
+		if errors.Is(err, db.ErrAgentNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such agent by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot delete agent")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot delete agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteAgentResponse{
+		Message: "agent has been deleted successfully",
+	})
+}
+
+// HandleRestoreAgent handles restoring a soft deleted agent
+// @Summary Restore an agent
+// @Description Restore a soft deleted agent
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param agent_id path int true "ID of the agent to restore"
+// @Success 200 {object} AgentDetailedResponse "Successfully restored agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Agent not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents/{agent_id}/restore [post]
+func (gh *GinHandler) HandleRestoreAgent(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleRestoreAgent")
+	defer span.End()
+
+	// Parsing the agent_id
+	agentID, ok := parseAgentID(c)
+	if !ok {
+		return
+	}
+
+	// Restore the agent
+	agent, err := gh.db.RestoreAgent(ctx, agentID)
+	if err != nil {
+		if errors.Is(err, db.ErrAgentNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such agent by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot restore agent")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot restore agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AgentDetailedResponse{
+		Message: "agent has been restored successfully",
+		Agent:   newAgent(agent),
+	})
+}
+
+// HandlePurgeAgent handles permanently deleting an agent
+// @Summary Purge an agent
+// @Description Permanently delete an agent, whether it is soft deleted or not
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param agent_id path int true "ID of the agent to purge"
+// @Success 200 {object} DeleteAgentResponse "Successfully purged agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Agent not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/agents/{agent_id} [delete]
+func (gh *GinHandler) HandlePurgeAgent(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandlePurgeAgent")
+	defer span.End()
+
+	// Parsing the agent_id
+	agentID, ok := parseAgentID(c)
+	if !ok {
+		return
+	}
+
+	// Permanently delete the agent
+	err := gh.db.PurgeAgent(ctx, agentID)
+	if err != nil {
+		if errors.Is(err, db.ErrAgentNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such agent by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot purge agent")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot purge agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteAgentResponse{
+		Message: "agent has been purged successfully",
+	})
+}
+
+// HandleBulkDeleteAgents handles soft deleting all the agents matching a filter
+// @Summary Delete agents by filter
+// @Description Soft delete all the agents matching the filters, use dry_run to preview the affected agents
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param ip_address query string false "Filter agents by IP address"
+// @Param country query []string false "Filter agents by country codes" collectionFormat(csv)
+// @Param city query []string false "Filter agents by cities" collectionFormat(csv)
+// @Param region query []string false "Filter agents by regions" collectionFormat(csv)
+// @Param asn query []string false "Filter agents by ASNs (e.g., 'AS3320')" collectionFormat(csv)
+// @Param isp query string false "Filter agents by ISP containing this value"
+// @Param created_after query string false "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param q query string false "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'"
+// @Param dry_run query bool false "Only return the number and a sample of the matching agents"
+// @Param force query bool false "Allow deleting with an empty filter"
+// @Success 200 {object} BulkDeleteAgentsResponse "Successfully deleted agents"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents [delete]
+func (gh *GinHandler) HandleBulkDeleteAgents(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleBulkDeleteAgents")
+	defer span.End()
+
+	// Handle query params
+	var queryParams BulkDeleteAgentsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	agentsFilter, err := queryParams.toFilter()
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	agentsFilter.IncludeDeleted = false
+	if agentsFilter.IsEmpty() && !queryParams.Force {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "refusing to delete all agents with an empty filter, use force=true to do so",
+		})
+		return
+	}
+
+	// Preview the affected agents
+	if queryParams.DryRun {
+		agentsResult, err := gh.db.GetAllAgents(ctx, agentsFilter, 1, BulkDeleteSampleSize, nil)
+		if err != nil {
+			logger.WithError(err).Warn("cannot retrieve the agents from the database")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the agents from the database"})
+			return
+		}
+
+		setAuditDetail(c, "dry_run", true)
+		setAuditDetail(c, "matched", agentsResult.TotalAgents)
+		sample := make([]Agent, 0, len(agentsResult.Agents))
+		for i := range agentsResult.Agents {
+			sample = append(sample, newAgent(&agentsResult.Agents[i]))
+		}
+
+		c.JSON(http.StatusOK, BulkDeleteAgentsResponse{
+			Message:       "agents matching the filter have been previewed",
+			DryRun:        true,
+			MatchedAgents: agentsResult.TotalAgents,
+			Sample:        sample,
+		})
+		return
+	}
+
+	// Delete the agents
+	deletedIDs, err := gh.db.BulkDeleteAgents(ctx, agentsFilter, BulkDeleteChunkSize)
+	deleted := int64(len(deletedIDs))
+	setAuditDetail(c, "deleted", deleted)
+	setAuditIDs(c, "deleted_ids", deletedIDs)
+	if err != nil {
+		logger.WithError(err).WithField("deleted", deleted).Warn("cannot delete the agents")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot delete the agents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BulkDeleteAgentsResponse{
+		Message:       "agents have been deleted successfully",
+		MatchedAgents: deleted,
+		DeletedAgents: deleted,
+	})
+}
+
+// agentsCSVHeader is the header row of the exported CSV files
+var agentsCSVHeader = []string{
+	"id", "created_at", "ip_address", "asn", "isp", "city", "region", "country", "location", "deleted_at",
+}
+
+// newAgentsExportWriter creates the function writing a batch of agents in the format.
+// The header of the file, if there is any, is written before the first batch.
+func newAgentsExportWriter(w io.Writer, format string) func(agents []db.Agent) error {
+	if format == ExportFormatNDJSON {
+		encoder := json.NewEncoder(w)
+		return func(agents []db.Agent) error {
+			for i := range agents {
+				if err := encoder.Encode(newAgent(&agents[i])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	headerWritten := false
+	return func(agents []db.Agent) error {
+		if !headerWritten {
+			headerWritten = true
+			if err := writer.Write(agentsCSVHeader); err != nil {
+				return err
+			}
+		}
+		for _, a := range agents {
+			deletedAt := ""
+			if a.DeletedAt.Valid {
+				deletedAt = a.DeletedAt.Time.Format(time.RFC3339)
+			}
+			err := writer.Write([]string{
+				strconv.FormatUint(uint64(a.ID), 10),
+				a.CreatedAt.Format(time.RFC3339),
+				a.IPAddress,
+				a.ASN,
+				a.ISP,
+				a.City,
+				a.Region,
+				a.Country,
+				a.Location,
+				deletedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+}
+
+// HandleExportAgents handles streaming all the agents matching a filter as a file
+// @Summary Export agents
+// @Description Stream all the agents matching the filters as a CSV or NDJSON file
+// @Tags agents
+// @Accept json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "Format of the file (csv, ndjson), default is csv"
+// @Param ip_address query string false "Filter agents by IP address"
+// @Param country query []string false "Filter agents by country codes" collectionFormat(csv)
+// @Param city query []string false "Filter agents by cities" collectionFormat(csv)
+// @Param region query []string false "Filter agents by regions" collectionFormat(csv)
+// @Param asn query []string false "Filter agents by ASNs (e.g., 'AS3320')" collectionFormat(csv)
+// @Param isp query string false "Filter agents by ISP containing this value"
+// @Param created_after query string false "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param q query string false "Filter agents by a query (see README), e.g. 'country:US AND (asn:AS15169 OR isp:Cloudflare*)'"
+// @Param include_deleted query bool false "Include the deleted agents"
+// @Success 200 {file} file "The exported agents"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents/export [get]
+func (gh *GinHandler) HandleExportAgents(c *gin.Context) {
+	// The context of the request is done when the client disconnects, so the export stops
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c.Request.Context(), "HandleExportAgents")
+	defer span.End()
+
+	// Handle query params
+	var queryParams ExportAgentsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	agentsFilter, err := queryParams.toFilter()
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	switch queryParams.Format {
+	case "", ExportFormatCSV:
+		queryParams.Format = ExportFormatCSV
+	case ExportFormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the valid formats are: csv, ndjson"})
+		return
+	}
+
+	// Stream the agents batch by batch, the headers are sent with the first batch
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="agents-%s.%s"`,
+		time.Now().UTC().Format("20060102T150405Z"), queryParams.Format))
+	writeAgents := newAgentsExportWriter(c.Writer, queryParams.Format)
+	exported := 0
+	err = gh.db.FindAgentsInBatches(ctx, agentsFilter, ExportBatchSize, func(agents []db.Agent) error {
+		if err := writeAgents(agents); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		exported += len(agents)
+		return nil
+	})
+	if err == nil && exported == 0 {
+		err = writeAgents(nil)
+	}
+	setAuditDetail(c, "exported", exported)
+	if err != nil {
+		logger.WithError(err).WithField("exported", exported).Warn("cannot export the agents")
+		// The response cannot be changed after the first batch is sent
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot export the agents"})
+		}
+	}
+}
+
+// HandleImportAgents handles creating agents in bulk from a CSV or NDJSON file
+// @Summary Import agents
+// @Description Create agents from the IP addresses in a CSV (ip_address column or the first one) or NDJSON ({"ip_address": ...} per line) body.
+// @Description Existing and repeated IP addresses are skipped. Use async to run big imports as a background job.
+// @Description The jobs are kept in memory by the instance running them, so they can only be polled on it.
+// @Tags agents
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "Format of the body (csv, ndjson), defaults to the content type"
+// @Param async query bool false "Run the import as a background job"
+// @Success 200 {object} ImportAgentsResponse "The per-line report of the import"
+// @Success 202 {object} ImportJobResponse "The import job has been started"
+// @Failure 400 {object} ErrorResponse "Bad request, or the body cannot be read from a line"
+// @Failure 413 {object} ErrorResponse "The body is too large"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /agents/import [post]
+func (gh *GinHandler) HandleImportAgents(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c.Request.Context(), "HandleImportAgents")
+	defer span.End()
+
+	// Handle query params
+	var queryParams ImportAgentsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	if queryParams.Format == "" {
+		queryParams.Format = importer.FormatCSV
+		if c.ContentType() == "application/x-ndjson" {
+			queryParams.Format = importer.FormatNDJSON
+		}
+	}
+	if queryParams.Format != importer.FormatCSV && queryParams.Format != importer.FormatNDJSON {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the valid formats are: csv, ndjson"})
+		return
+	}
+
+	gatherer, ok := gh.selectIPStatsGatherer(c, "")
+	if !ok {
+		return
+	}
+	im := importer.New(gh.db, gatherer, importer.Options{
+		Concurrency: ImportConcurrency,
+		BatchSize:   ImportBatchSize,
+		Timeout:     IPStatsTimeout,
+	})
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, ImportMaxBodySize)
+
+	// Run big imports in the background, the body is read beforehand as it is closed after the response
+	if queryParams.Async {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			respondImportBodyError(c, &importer.ReadError{Line: bytes.Count(content, []byte("\n")) + 1, Err: err})
+			return
+		}
+		// The agents are created after the response, so the job is audited again when it finishes
+		finished := newRequestAuditEvent(c)
+		job := gh.importJobs.Start(ctx, func(ctx context.Context, progress func(processed int)) (*importer.Report, error) {
+			report, err := im.Import(ctx, bytes.NewReader(content), queryParams.Format, progress)
+			if err != nil {
+				logger.WithError(err).Warn("cannot import the agents")
+			}
+			gh.auditImportFinished(ctx, finished, report, err)
+			return report, err
+		})
+
+		setAuditResourceID(c, job.ID)
+		c.Header("Location", c.Request.URL.Path+"/"+job.ID)
+		c.JSON(http.StatusAccepted, ImportJobResponse{
+			Message: "import job has been started",
+			Job:     newImportJob(job),
+		})
+		return
+	}
+
+	report, err := im.Import(ctx, body, queryParams.Format, nil)
+	if err != nil {
+		logger.WithError(err).WithField("processed", len(report.Lines)).Warn("cannot import the agents")
+		respondImportBodyError(c, err)
+		return
+	}
+
+	setAuditDetail(c, "created", report.Created)
+	setAuditDetail(c, "skipped", report.Skipped)
+	setAuditDetail(c, "failed", report.Failed)
+	setAuditIDs(c, "created_ids", report.CreatedIDs())
+	c.JSON(http.StatusOK, ImportAgentsResponse{
+		Message: "agents have been imported",
+		Report:  *newImportReport(report),
+	})
+}
+
+// auditImportFinished records the result of an import job, its event has the client and the request ID of the
+// request starting the job
+func (gh *GinHandler) auditImportFinished(ctx context.Context, event *db.AuditEvent, report *importer.Report, err error) {
+	event.Action = "agent.import_finished"
+	event.Resource = "agent"
+	event.ResourceID = importer.JobIDFromContext(ctx)
+	event.Outcome = db.AuditSucceeded
+	if err != nil {
+		event.Outcome = db.AuditFailed
+		event.Reason = err.Error()
+	}
+	if report != nil {
+		result := map[string]any{"created": report.Created, "skipped": report.Skipped, "failed": report.Failed}
+		createdIDs, truncated := auditIDs(report.CreatedIDs())
+		result["created_ids"] = createdIDs
+		if truncated {
+			result["created_ids_truncated"] = true
+		}
+		if b, err := json.Marshal(map[string]any{"result": result}); err == nil {
+			event.Summary = string(b)
+		}
+	}
+
+	gh.recordAuditEvent(ctx, event)
+}
+
+// respondImportBodyError writes the error response of an import which failed, the bodies which cannot be read are
+// bad requests
+func respondImportBodyError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var readErr *importer.ReadError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Error: fmt.Sprintf("the body should not be larger than %d bytes", maxBytesErr.Limit),
+		})
+	case errors.As(err, &readErr):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("cannot read the body from line %d", readErr.Line)})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot import the agents"})
+	}
+}
+
+// HandleGetImportJob handles getting the status of an import job
+// @Summary Get an import job
+// @Description Get the status and, when it is finished, the report of an import job of the tenant of the client
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param job_id path string true "Import Job ID"
+// @Success 200 {object} ImportJobResponse
+// @Failure 404 {object} ErrorResponse "Import job not found"
+// @Router /agents/import/{job_id} [get]
+func (gh *GinHandler) HandleGetImportJob(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetImportJob")
+	defer span.End()
+
+	// The jobs of the other tenants are not found, as their agents are not
+	job, ok := gh.importJobs.Get(c.Param("job_id"))
+	if !ok || job.TenantID != db.TenantFromContext(ctx) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "import job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ImportJobResponse{
+		Message: "import job has been retrieved successfully",
+		Job:     newImportJob(job),
 	})
 }
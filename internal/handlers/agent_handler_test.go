@@ -6,14 +6,20 @@ import (
 	"argus/internal/iputil"
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestHandleCreateAgent_Success(t *testing.T) {
@@ -72,6 +78,90 @@ func TestHandleCreateAgent_Success(t *testing.T) {
 	assert.Equal(t, testData.expectedResponse.Agent.City, createAgentResponse.Agent.City)
 }
 
+func TestHandleCreateAgent_Async(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	testData := struct {
+		requestBody      CreateAgentRequest
+		expectedCode     int
+		expectedResponse CreateAgentResponse
+	}{
+		requestBody: CreateAgentRequest{
+			IPAddress: "8.8.4.4",
+		},
+		expectedCode: http.StatusAccepted,
+		expectedResponse: CreateAgentResponse{
+			Message: "agent has been created, its details will be gathered in the background",
+			Agent: Agent{
+				IPAddress:        "8.8.4.4",
+				EnrichmentStatus: db.EnrichmentPending,
+			},
+		},
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	tdb := getTestDatabase(ctx, t)
+	gh := NewGinHandler(config.Config{}, tdb, argusIpClient)
+
+	router := gin.Default()
+	router.POST("/agents", gh.HandleCreateAgent)
+	router.GET("/agents/:agent_id/enrichment", gh.HandleGetEnrichmentJob)
+
+	body, _ := json.Marshal(testData.requestBody)
+	req, _ := http.NewRequest(http.MethodPost, "/agents?async=true", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, testData.expectedCode, w.Code)
+
+	var createAgentResponse CreateAgentResponse
+	err = json.Unmarshal(w.Body.Bytes(), &createAgentResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.expectedResponse.Message, createAgentResponse.Message)
+	assert.Equal(t, testData.expectedResponse.Agent.IPAddress, createAgentResponse.Agent.IPAddress)
+	assert.Equal(t, testData.expectedResponse.Agent.EnrichmentStatus, createAgentResponse.Agent.EnrichmentStatus)
+	assert.Empty(t, createAgentResponse.Agent.ASN)
+	location := fmt.Sprintf("/agents/%d/enrichment", createAgentResponse.Agent.ID)
+	assert.Equal(t, location, w.Header().Get("Location"))
+
+	// The job of the agent is queued
+	getJob := func() EnrichmentJob {
+		req, _ := http.NewRequest(http.MethodGet, location, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response EnrichmentJobResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Job
+	}
+	job := getJob()
+	assert.Equal(t, createAgentResponse.Agent.ID, job.AgentID)
+	assert.Equal(t, db.JobQueued, job.Status)
+	assert.Zero(t, job.Attempts)
+
+	jobs, err := tdb.ClaimEnrichmentJobs(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, createAgentResponse.Agent.ID, jobs[0].AgentID)
+
+	// The failures of the job are exposed
+	assert.NoError(t, tdb.FailEnrichmentJob(ctx, &jobs[0], "cannot get ip info", time.Now()))
+	job = getJob()
+	assert.Equal(t, db.JobQueued, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "cannot get ip info", job.LastError)
+
+	// The agents created synchronously have no job
+	req, _ = http.NewRequest(http.MethodGet, "/agents/999999999/enrichment", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestHandleCreateAgent_EmptyRequestBody(t *testing.T) {
 	ctx := context.Background()
 	gin.SetMode(gin.TestMode)
@@ -463,3 +553,868 @@ func TestHandleGetAgentDetails_NotFound(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, testData.expectedResponse.Error, errorResposne.Error)
 }
+
+func TestHandleRefreshAgent_Success(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	createdAgent, err := testDB.CreateNewAgent(ctx, &db.Agent{
+		IPAddress:        "8.8.8.8",
+		ASN:              "AS00000",
+		City:             "Old City",
+		Country:          "DE",
+		ISP:              "Old ISP",
+		EnrichmentStatus: db.EnrichmentFailed,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, createdAgent)
+
+	testData := struct {
+		id               uint
+		expectedCode     int
+		expectedResponse RefreshAgentResponse
+	}{
+		id:           createdAgent.ID,
+		expectedCode: http.StatusOK,
+		expectedResponse: RefreshAgentResponse{
+			Message: "agent has been refreshed successfully",
+			Before: Agent{
+				ID:      createdAgent.ID,
+				ASN:     "AS00000",
+				City:    "Old City",
+				Country: "DE",
+				ISP:     "Old ISP",
+			},
+			After: Agent{
+				ID:       createdAgent.ID,
+				ASN:      "AS15169",
+				City:     "Mountain View",
+				Country:  "US",
+				Location: "37.386,-122.0838",
+				ISP:      "Google LLC",
+			},
+		},
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, iputil.NewProviders(iputil.ProviderIPInfo, argusIpClient))
+
+	router := gin.Default()
+	router.POST("/agents/:agent_id/refresh", gh.HandleRefreshAgent)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/agents/%d/refresh?provider=%s", testData.id, iputil.ProviderIPInfo), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, testData.expectedCode, w.Code)
+
+	response, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	var refreshAgentResponse RefreshAgentResponse
+	err = json.Unmarshal(response, &refreshAgentResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.expectedResponse.Message, refreshAgentResponse.Message)
+	assert.Equal(t, testData.expectedResponse.Before.ASN, refreshAgentResponse.Before.ASN)
+	assert.Equal(t, testData.expectedResponse.Before.City, refreshAgentResponse.Before.City)
+	assert.Equal(t, testData.expectedResponse.Before.ISP, refreshAgentResponse.Before.ISP)
+	assert.Equal(t, testData.expectedResponse.After.ID, refreshAgentResponse.After.ID)
+	assert.Equal(t, testData.expectedResponse.After.ASN, refreshAgentResponse.After.ASN)
+	assert.Equal(t, testData.expectedResponse.After.City, refreshAgentResponse.After.City)
+	assert.Equal(t, testData.expectedResponse.After.Country, refreshAgentResponse.After.Country)
+	assert.Equal(t, testData.expectedResponse.After.Location, refreshAgentResponse.After.Location)
+	assert.Equal(t, testData.expectedResponse.After.ISP, refreshAgentResponse.After.ISP)
+	assert.Equal(t, db.EnrichmentCompleted, refreshAgentResponse.After.EnrichmentStatus)
+}
+
+func TestHandleRefreshAgent_Pending(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create an agent which is still being enriched
+	testDB := getTestDatabase(ctx, t)
+	createdAgent, err := testDB.CreateNewAgent(ctx, &db.Agent{IPAddress: "8.8.4.5", EnrichmentStatus: db.EnrichmentPending})
+	assert.NoError(t, err)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.POST("/agents/:agent_id/refresh", gh.HandleRefreshAgent)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/agents/%d/refresh", createdAgent.ID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The stats are not changed
+	agent, err := testDB.GetAgentByID(ctx, createdAgent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, db.EnrichmentPending, agent.EnrichmentStatus)
+	assert.Empty(t, agent.ASN)
+}
+
+func TestHandleRefreshAgent_UnknownProvider(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	createdAgent, err := testDB.CreateNewAgent(ctx, &db.Agent{
+		IPAddress: "8.8.4.4",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, createdAgent)
+
+	testData := struct {
+		id               uint
+		expectedCode     int
+		expectedResponse ErrorResponse
+	}{
+		id:           createdAgent.ID,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: ErrorResponse{
+			Error: "unknown provider",
+		},
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, iputil.NewProviders(iputil.ProviderIPInfo, argusIpClient))
+
+	router := gin.Default()
+	router.POST("/agents/:agent_id/refresh", gh.HandleRefreshAgent)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/agents/%d/refresh?provider=unknown", testData.id), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, testData.expectedCode, w.Code)
+
+	response, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	var errorResponse ErrorResponse
+	err = json.Unmarshal(response, &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, testData.expectedResponse.Error, errorResponse.Error)
+}
+
+func TestHandleDeleteAndRestoreAgent_Success(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	createdAgent, err := testDB.CreateNewAgent(ctx, &db.Agent{
+		IPAddress: "9.9.9.9",
+		ASN:       "AS19281",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, createdAgent)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents/:agent_id", gh.HandleGetAgentDetail)
+	router.DELETE("/agents/:agent_id", gh.HandleDeleteAgent)
+	router.POST("/agents/:agent_id/restore", gh.HandleRestoreAgent)
+
+	// Delete the agent
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/agents/%d", createdAgent.ID), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The deleted agent cannot be found
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/agents/%d", createdAgent.ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Deleting twice is not found
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/agents/%d", createdAgent.ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Restore the agent
+	req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/agents/%d/restore", createdAgent.ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	var agentDetailedResponse AgentDetailedResponse
+	err = json.Unmarshal(response, &agentDetailedResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent has been restored successfully", agentDetailedResponse.Message)
+	assert.Equal(t, createdAgent.ID, agentDetailedResponse.Agent.ID)
+	assert.Nil(t, agentDetailedResponse.Agent.DeletedAt)
+
+	// The restored agent can be found
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/agents/%d", createdAgent.ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHandleBulkDeleteAgents(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for i := 0; i < 3; i++ {
+		_, err := testDB.CreateNewAgent(ctx, &db.Agent{
+			IPAddress: "4.4.4.4",
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name             string
+		queryParams      string
+		expectedCode     int
+		expectedResponse BulkDeleteAgentsResponse
+	}{
+		{
+			name:         "Empty Filter",
+			queryParams:  "",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Dry Run",
+			queryParams:  "?ip_address=4.4.4.4&dry_run=true",
+			expectedCode: http.StatusOK,
+			expectedResponse: BulkDeleteAgentsResponse{
+				Message:       "agents matching the filter have been previewed",
+				DryRun:        true,
+				MatchedAgents: 3,
+			},
+		},
+		{
+			name:         "Delete",
+			queryParams:  "?ip_address=4.4.4.4",
+			expectedCode: http.StatusOK,
+			expectedResponse: BulkDeleteAgentsResponse{
+				Message:       "agents have been deleted successfully",
+				MatchedAgents: 3,
+				DeletedAgents: 3,
+			},
+		},
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.DELETE("/agents", gh.HandleBulkDeleteAgents)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodDelete, "/agents"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var bulkDeleteResponse BulkDeleteAgentsResponse
+			err := json.Unmarshal(w.Body.Bytes(), &bulkDeleteResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedResponse.Message, bulkDeleteResponse.Message)
+			assert.Equal(t, tt.expectedResponse.DryRun, bulkDeleteResponse.DryRun)
+			assert.Equal(t, tt.expectedResponse.MatchedAgents, bulkDeleteResponse.MatchedAgents)
+			assert.Equal(t, tt.expectedResponse.DeletedAgents, bulkDeleteResponse.DeletedAgents)
+			if tt.expectedResponse.DryRun {
+				assert.Len(t, bulkDeleteResponse.Sample, 3)
+			}
+		})
+	}
+}
+
+func TestHandleGetAgents_Cursor(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for i := 0; i < 3; i++ {
+		_, err := testDB.CreateNewAgent(ctx, &db.Agent{
+			IPAddress: "5.5.5.5",
+		})
+		assert.NoError(t, err)
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents", gh.HandleGetAgents)
+
+	// Request the first page
+	req, _ := http.NewRequest(http.MethodGet, "/agents?ip_address=5.5.5.5&page_size=2&cursor=&total=exact", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+
+	var getAgentsResponse GetAgentsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &getAgentsResponse)
+	assert.NoError(t, err)
+	assert.Len(t, getAgentsResponse.Data.Agents, 2)
+	assert.Equal(t, int64(3), getAgentsResponse.Data.Pagination.TotalAgents)
+	assert.NotEmpty(t, getAgentsResponse.Data.Pagination.NextCursor)
+	assert.Empty(t, getAgentsResponse.Data.Pagination.PrevCursor)
+
+	// Request the next page
+	req, _ = http.NewRequest(http.MethodGet, "/agents?ip_address=5.5.5.5&page_size=2&cursor="+getAgentsResponse.Data.Pagination.NextCursor, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Link"), `rel="prev"`)
+
+	var nextPageResponse GetAgentsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &nextPageResponse)
+	assert.NoError(t, err)
+	assert.Len(t, nextPageResponse.Data.Agents, 1)
+	assert.True(t, nextPageResponse.Data.Pagination.TotalIsEstimate)
+	assert.Empty(t, nextPageResponse.Data.Pagination.NextCursor)
+	assert.NotEmpty(t, nextPageResponse.Data.Pagination.PrevCursor)
+
+	// Request with an invalid cursor
+	req, _ = http.NewRequest(http.MethodGet, "/agents?cursor=invalid", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Request with invalid page sizes, in both the cursor and the offset pagination
+	for _, query := range []string{"cursor=&page_size=-1", "cursor=&page_size=-5", "cursor=&page_size=101", "page_size=-1", "page_size=101", "page=-1"} {
+		req, _ = http.NewRequest(http.MethodGet, "/agents?"+query, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestHandleGetAgents_Filter(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for _, a := range []*db.Agent{
+		{IPAddress: "6.6.6.1", Region: "Filter Region", Country: "DE", ASN: "AS3320", ISP: "Deutsche Telekom AG"},
+		{IPAddress: "6.6.6.2", Region: "Filter Region", Country: "DE", ASN: "AS3209", ISP: "Vodafone GmbH"},
+		{IPAddress: "6.6.6.3", Region: "Filter Region", Country: "US", ASN: "AS15169", ISP: "Google LLC"},
+	} {
+		_, err := testDB.CreateNewAgent(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedCode   int
+		expectedAgents int
+	}{
+		{
+			name:           "Comma Separated Countries",
+			queryParams:    "?region=Filter+Region&country=de,us",
+			expectedCode:   http.StatusOK,
+			expectedAgents: 3,
+		},
+		{
+			name:           "Repeated ASNs",
+			queryParams:    "?region=Filter+Region&asn=3320&asn=AS15169",
+			expectedCode:   http.StatusOK,
+			expectedAgents: 2,
+		},
+		{
+			name:           "ISP Substring",
+			queryParams:    "?region=Filter+Region&country=DE&isp=vodafone",
+			expectedCode:   http.StatusOK,
+			expectedAgents: 1,
+		},
+		{
+			name:           "Created Before",
+			queryParams:    "?region=Filter+Region&created_before=2000-01-01",
+			expectedCode:   http.StatusNotFound,
+			expectedAgents: 0,
+		},
+		{
+			name:         "Invalid Time",
+			queryParams:  "?created_after=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid Sort",
+			queryParams:  "?sort_by=isp",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents", gh.HandleGetAgents)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/agents"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusBadRequest {
+				return
+			}
+
+			var getAgentsResponse GetAgentsResponse
+			err := json.Unmarshal(w.Body.Bytes(), &getAgentsResponse)
+			assert.NoError(t, err)
+			assert.Len(t, getAgentsResponse.Data.Agents, tt.expectedAgents)
+		})
+	}
+}
+
+func TestHandleGetAgents_Query(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for _, a := range []*db.Agent{
+		{IPAddress: "7.7.7.1", Region: "Query Region", Country: "US", ASN: "AS15169", ISP: "Google LLC"},
+		{IPAddress: "7.7.7.2", Region: "Query Region", Country: "US", ASN: "AS13335", ISP: "Cloudflare, Inc."},
+		{IPAddress: "7.7.7.3", Region: "Query Region", Country: "DE", ASN: "AS13335", ISP: "Cloudflare, Inc."},
+	} {
+		_, err := testDB.CreateNewAgent(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents", gh.HandleGetAgents)
+
+	// Query the agents
+	query := url.QueryEscape(`region:"Query Region" AND country:us AND (asn:AS15169 OR isp:"cloudflare*")`)
+	req, _ := http.NewRequest(http.MethodGet, "/agents?q="+query, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var getAgentsResponse GetAgentsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &getAgentsResponse)
+	assert.NoError(t, err)
+	assert.Len(t, getAgentsResponse.Data.Agents, 2)
+
+	// Invalid queries point to the position of the error
+	query = url.QueryEscape(`country:US AND (asn:AS15169`)
+	req, _ = http.NewRequest(http.MethodGet, "/agents?q="+query, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var queryErrorResponse QueryErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &queryErrorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, 28, queryErrorResponse.Position)
+}
+
+func TestHandleGetAgents_Facets(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for _, a := range []*db.Agent{
+		{IPAddress: "8.8.8.1", Region: "Facet Region", Country: "US", ASN: "AS15169"},
+		{IPAddress: "8.8.8.2", Region: "Facet Region", Country: "US", ASN: "AS13335"},
+		{IPAddress: "8.8.8.3", Region: "Facet Region", Country: "DE", ASN: "AS13335"},
+	} {
+		_, err := testDB.CreateNewAgent(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents", gh.HandleGetAgents)
+
+	// Request the facets
+	req, _ := http.NewRequest(http.MethodGet, "/agents?region=Facet+Region&page_size=1&facets=country,asn", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var getAgentsResponse GetAgentsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &getAgentsResponse)
+	assert.NoError(t, err)
+	assert.Len(t, getAgentsResponse.Data.Agents, 1)
+	assert.Equal(t, []AgentFacetValue{{Value: "US", Count: 2}, {Value: "DE", Count: 1}}, getAgentsResponse.Data.Facets["country"])
+	assert.Equal(t, []AgentFacetValue{{Value: "AS13335", Count: 2}, {Value: "AS15169", Count: 1}}, getAgentsResponse.Data.Facets["asn"])
+
+	// The facets can be repeated too
+	req, _ = http.NewRequest(http.MethodGet, "/agents?region=Facet+Region&facets=country&facets=asn", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	getAgentsResponse = GetAgentsResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &getAgentsResponse))
+	assert.Len(t, getAgentsResponse.Data.Facets, 2)
+
+	// Request an invalid facet
+	req, _ = http.NewRequest(http.MethodGet, "/agents?facets=ip_address", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleExportAgents(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for _, a := range []*db.Agent{
+		{IPAddress: "8.8.5.1", Region: "Export Region", Country: "US", ISP: "Google, LLC"},
+		{IPAddress: "8.8.5.2", Region: "Export Region", Country: "DE"},
+	} {
+		_, err := testDB.CreateNewAgent(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/agents/export", gh.HandleExportAgents)
+
+	// Export as CSV
+	req, _ := http.NewRequest(http.MethodGet, "/agents/export?region=Export+Region", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, agentsCSVHeader, records[0])
+		assert.Equal(t, "8.8.5.1", records[1][2])
+		assert.Equal(t, "Google, LLC", records[1][4])
+	}
+
+	// Export as NDJSON
+	req, _ = http.NewRequest(http.MethodGet, "/agents/export?region=Export+Region&format=ndjson&country=DE", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var agents []Agent
+	decoder := json.NewDecoder(w.Body)
+	for decoder.More() {
+		var agent Agent
+		assert.NoError(t, decoder.Decode(&agent))
+		agents = append(agents, agent)
+	}
+	if assert.Len(t, agents, 1) {
+		assert.Equal(t, "8.8.5.2", agents[0].IPAddress)
+	}
+
+	// Export an empty CSV
+	req, _ = http.NewRequest(http.MethodGet, "/agents/export?region=Nowhere", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strings.Join(agentsCSVHeader, ",")+"\n", w.Body.String())
+
+	// Request an invalid format
+	req, _ = http.NewRequest(http.MethodGet, "/agents/export?format=xml", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleImportAgents(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	_, err := testDB.CreateNewAgent(ctx, &db.Agent{IPAddress: "9.9.9.1"})
+	assert.NoError(t, err)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.POST("/agents/import", gh.HandleImportAgents)
+	router.GET("/agents/import/:job_id", gh.HandleGetImportJob)
+	router.GET("/other/agents/import/:job_id", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(db.WithTenant(c.Request.Context(), "other"))
+	}, gh.HandleGetImportJob)
+
+	// Import a CSV file
+	body := "ip_address\n9.9.9.1\n9.9.9.2\n9.9.9.2\n9.9.9\n"
+	req, _ := http.NewRequest(http.MethodPost, "/agents/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var importResponse ImportAgentsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &importResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, importResponse.Report.Created)
+	assert.Equal(t, 2, importResponse.Report.Skipped)
+	assert.Equal(t, 1, importResponse.Report.Failed)
+	if assert.Len(t, importResponse.Report.Lines, 4) {
+		assert.Equal(t, "created", importResponse.Report.Lines[1].Status)
+		assert.NotZero(t, importResponse.Report.Lines[1].AgentID)
+	}
+
+	// The body cannot be read from its second line
+	for _, path := range []string{"/agents/import", "/agents/import?async=true"} {
+		req, _ = http.NewRequest(http.MethodPost, path, io.MultiReader(strings.NewReader("9.9.9.4\n"), iotest.ErrReader(errors.New("read failed"))))
+		req.Header.Set("Content-Type", "text/csv")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "cannot read the body from line 2", path)
+	}
+
+	// Import an NDJSON file in the background
+	req, _ = http.NewRequest(http.MethodPost, "/agents/import?async=true", strings.NewReader(`{"ip_address": "9.9.9.3"}`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var jobResponse ImportJobResponse
+	err = json.Unmarshal(w.Body.Bytes(), &jobResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "/agents/import/"+jobResponse.Job.ID, w.Header().Get("Location"))
+
+	// Wait for the job to finish
+	assert.Eventually(t, func() bool {
+		req, _ = http.NewRequest(http.MethodGet, "/agents/import/"+jobResponse.Job.ID, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var jobResponse ImportJobResponse
+		err = json.Unmarshal(w.Body.Bytes(), &jobResponse)
+		return err == nil && jobResponse.Job.Status == "succeeded" && jobResponse.Job.Report.Created == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// The job is not found by the clients of another tenant
+	req, _ = http.NewRequest(http.MethodGet, "/other/agents/import/"+jobResponse.Job.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Request an unknown job
+	req, _ = http.NewRequest(http.MethodGet, "/agents/import/unknown", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleBatchCreateAgents(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	testDB := getTestDatabase(ctx, t)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.POST("/agents:method", gh.RequireAgentsMethod(":batch"), gh.HandleBatchCreateAgents)
+
+	tests := []struct {
+		name            string
+		requestBody     BatchCreateAgentsRequest
+		expectedCode    int
+		expectedCreated int
+		expectedStatus  []int
+	}{
+		{
+			name:            "Partial Success",
+			requestBody:     BatchCreateAgentsRequest{IPAddresses: []string{"9.9.8.1", "invalid", "9.9.8.2"}},
+			expectedCode:    http.StatusMultiStatus,
+			expectedCreated: 2,
+			expectedStatus:  []int{http.StatusCreated, http.StatusBadRequest, http.StatusCreated},
+		},
+		{
+			name:            "Repeated IP Addresses",
+			requestBody:     BatchCreateAgentsRequest{IPAddresses: []string{"9.9.8.3", "::ffff:9.9.8.3", "9.9.8.3"}},
+			expectedCode:    http.StatusMultiStatus,
+			expectedCreated: 1,
+			expectedStatus:  []int{http.StatusCreated, http.StatusConflict, http.StatusConflict},
+		},
+		{
+			name:         "Empty Batch",
+			requestBody:  BatchCreateAgentsRequest{},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Too Many IP Addresses",
+			requestBody:  BatchCreateAgentsRequest{IPAddresses: make([]string, BatchCreateMaxAgents+1)},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestBody, _ := json.Marshal(tt.requestBody)
+			req, _ := http.NewRequest(http.MethodPost, "/agents:batch", bytes.NewBuffer(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusMultiStatus {
+				return
+			}
+
+			var batchResponse BatchCreateAgentsResponse
+			err := json.Unmarshal(w.Body.Bytes(), &batchResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCreated, batchResponse.Created)
+			for i, result := range batchResponse.Results {
+				assert.Equal(t, tt.expectedStatus[i], result.Status)
+				assert.Equal(t, tt.requestBody.IPAddresses[i], result.IPAddress)
+				if result.Status == http.StatusCreated {
+					assert.NotZero(t, result.Agent.ID)
+					assert.Equal(t, "AS15169", result.Agent.ASN)
+				}
+			}
+		})
+	}
+
+	// Request an unknown method
+	req, _ := http.NewRequest(http.MethodPost, "/agents:unknown", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// failingBatchDB fails the multi-row inserts of the agents, and the inserts of the agent of failingIP
+type failingBatchDB struct {
+	db.DB
+	failingIP string
+	lastID    uint
+}
+
+func (f *failingBatchDB) CreateAgents(ctx context.Context, agents []*db.Agent, batchSize int) error {
+	return errors.New("cannot insert the batch")
+}
+
+func (f *failingBatchDB) CreateNewAgent(ctx context.Context, a *db.Agent) (*db.Agent, error) {
+	if a.IPAddress == f.failingIP {
+		return nil, errors.New("cannot insert the agent")
+	}
+	f.lastID++
+	a.ID = f.lastID
+	return a, nil
+}
+
+func TestHandleBatchCreateAgents_CreateFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	gh := NewGinHandler(config.Config{}, &failingBatchDB{failingIP: "9.9.7.2"}, argusIpClient)
+	router := gin.New()
+	router.POST("/agents:method", gh.RequireAgentsMethod(":batch"), gh.HandleBatchCreateAgents)
+
+	// Only the agent which cannot be inserted fails
+	body := `{"ip_addresses":["9.9.7.1","9.9.7.2","9.9.7.3"]}`
+	req, _ := http.NewRequest(http.MethodPost, "/agents:batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	var batchResponse BatchCreateAgentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batchResponse))
+	assert.Equal(t, 2, batchResponse.Created)
+	if assert.Len(t, batchResponse.Results, 3) {
+		assert.Equal(t, http.StatusCreated, batchResponse.Results[0].Status)
+		assert.Equal(t, http.StatusInternalServerError, batchResponse.Results[1].Status)
+		assert.Equal(t, "cannot create agent", batchResponse.Results[1].Error)
+		assert.Equal(t, http.StatusCreated, batchResponse.Results[2].Status)
+		assert.Equal(t, uint(2), batchResponse.Results[2].Agent.ID)
+	}
+}
@@ -1,21 +1,69 @@
 package handlers
 
 import (
+	"argus/internal/db"
+	"argus/internal/importer"
+	"errors"
+	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"strings"
 	"time"
 )
 
 // Agent represents information about an agent.
 type Agent struct {
-	ID        uint      `json:"id,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	IPAddress string    `json:"ip_address,omitempty"`
-	ASN       string    `json:"asn,omitempty"`
-	ISP       string    `json:"isp,omitempty"`
-	City      string    `json:"city,omitempty"`
-	Country   string    `json:"country,omitempty"`
-	Location  string    `json:"location,omitempty"`
+	ID        uint       `json:"id,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+	IPAddress string     `json:"ip_address,omitempty"`
+	ASN       string     `json:"asn,omitempty"`
+	ISP       string     `json:"isp,omitempty"`
+	City      string     `json:"city,omitempty"`
+	Region    string     `json:"region,omitempty"`
+	Country   string     `json:"country,omitempty"`
+	Location  string     `json:"location,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// EnrichmentStatus is pending, completed or failed
+	EnrichmentStatus string `json:"enrichment_status,omitempty"`
+}
+
+// newAgent converts the database model of an agent to its response model
+func newAgent(a *db.Agent) Agent {
+	agent := Agent{
+		ID:        a.ID,
+		CreatedAt: a.CreatedAt,
+		IPAddress: a.IPAddress,
+		ASN:       a.ASN,
+		ISP:       a.ISP,
+		City:      a.City,
+		Region:    a.Region,
+		Country:   a.Country,
+		Location:  a.Location,
+
+		EnrichmentStatus: a.EnrichmentStatus,
+	}
+	if a.DeletedAt.Valid {
+		agent.DeletedAt = &a.DeletedAt.Time
+	}
+
+	return agent
+}
+
+// newAgentSummary converts the database model of an agent to the response model used in lists
+func newAgentSummary(a *db.Agent) Agent {
+	agent := Agent{
+		ID:        a.ID,
+		IPAddress: a.IPAddress,
+		CreatedAt: a.CreatedAt,
+		ASN:       a.ASN,
+
+		EnrichmentStatus: a.EnrichmentStatus,
+	}
+	if a.DeletedAt.Valid {
+		agent.DeletedAt = &a.DeletedAt.Time
+	}
+
+	return agent
 }
 
 // CreateAgentRequest represents the request format for creating a new agent.
@@ -33,19 +81,171 @@ func (req CreateAgentRequest) validate() error {
 	)
 }
 
+// CreateAgentQueryParams represents the query parameters for creating a new agent.
+type CreateAgentQueryParams struct {
+	// Async creates the agent as pending and gathers its stats in the background
+	Async bool `form:"async"`
+}
+
 // CreateAgentResponse represents the response format for creating a new agent.
 type CreateAgentResponse struct {
 	Message string `json:"message"`
 	Agent   Agent  `json:"agent"`
 }
 
+// BatchCreateAgentsRequest represents the request format for creating multiple agents.
+type BatchCreateAgentsRequest struct {
+	IPAddresses []string `json:"ip_addresses"`
+}
+
+func (req BatchCreateAgentsRequest) validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.IPAddresses,
+			validation.Required.Error("IP addresses cannot be empty"),
+			validation.Length(0, BatchCreateMaxAgents).Error(
+				fmt.Sprintf("at most %d IP addresses can be created at once", BatchCreateMaxAgents),
+			),
+		),
+	)
+}
+
+// BatchCreateAgentsQueryParams represents the query parameters for creating multiple agents.
+type BatchCreateAgentsQueryParams struct {
+	Provider string `form:"provider"`
+}
+
+// BatchCreateAgentResult represents the result of creating an agent in a batch, Status is an HTTP status code.
+type BatchCreateAgentResult struct {
+	IPAddress string `json:"ip_address"`
+	Status    int    `json:"status"`
+	Agent     *Agent `json:"agent,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchCreateAgentsResponse represents the response format for creating multiple agents.
+type BatchCreateAgentsResponse struct {
+	Message string                   `json:"message"`
+	Created int                      `json:"created"`
+	Failed  int                      `json:"failed"`
+	Results []BatchCreateAgentResult `json:"results"`
+}
+
+// AgentsFilterQueryParams represents the query parameters for filtering agents.
+// Multi-value parameters can be repeated or comma-separated, and match any of their values.
+type AgentsFilterQueryParams struct {
+	IPAddress     string   `form:"ip_address"`
+	Countries     []string `form:"country"`
+	Cities        []string `form:"city"`
+	Regions       []string `form:"region"`
+	ASNs          []string `form:"asn"`
+	ISP           string   `form:"isp"`
+	CreatedAfter  string   `form:"created_after"`
+	CreatedBefore string   `form:"created_before"`
+	// Query is a filterql query, e.g. country:US AND (asn:AS15169 OR isp:"Cloudflare*")
+	Query string `form:"q"`
+
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+// toFilter converts the query parameters to the database filter
+func (params AgentsFilterQueryParams) toFilter() (*db.AgentFilter, error) {
+	filter := &db.AgentFilter{
+		Countries:      splitQueryValues(params.Countries, strings.ToUpper),
+		Cities:         splitQueryValues(params.Cities, nil),
+		Regions:        splitQueryValues(params.Regions, nil),
+		ASNs:           splitQueryValues(params.ASNs, normalizeASN),
+		IncludeDeleted: params.IncludeDeleted,
+	}
+	if params.IPAddress != "" {
+		filter.IPAddress = &params.IPAddress
+	}
+	if params.ISP != "" {
+		filter.ISP = &params.ISP
+	}
+	if params.CreatedAfter != "" {
+		createdAfter, err := parseQueryTime(params.CreatedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("created_after: %w", err)
+		}
+		filter.CreatedAfter = &createdAfter
+	}
+	if params.CreatedBefore != "" {
+		createdBefore, err := parseQueryTime(params.CreatedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("created_before: %w", err)
+		}
+		filter.CreatedBefore = &createdBefore
+	}
+	if params.Query != "" {
+		query, err := db.ParseAgentQuery(params.Query)
+		if err != nil {
+			return nil, fmt.Errorf("q: %w", err)
+		}
+		filter.Query = query
+	}
+
+	return filter, nil
+}
+
+// splitQueryValues splits the comma-separated values, trims and normalizes them
+func splitQueryValues(values []string, normalize func(string) string) []string {
+	var result []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if normalize != nil {
+				v = normalize(v)
+			}
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// normalizeASN converts the ASN to the stored format, e.g. 3320 and as3320 to AS3320
+func normalizeASN(asn string) string {
+	asn = strings.ToUpper(asn)
+	if !strings.HasPrefix(asn, "AS") {
+		asn = "AS" + asn
+	}
+
+	return asn
+}
+
+// parseQueryTime parses a time in RFC 3339 or a date in YYYY-MM-DD format
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("time should be in format of RFC 3339 or YYYY-MM-DD")
+	}
+
+	return t, nil
+}
+
 // GetAgentsQueryParams represents the query parameters for fetching agents.
 type GetAgentsQueryParams struct {
-	Page      int    `form:"page"`
-	PageSize  int    `form:"page_size"`
-	IPAddress string `form:"ip_address"`
-	SortBy    string `form:"sort_by"`
-	Order     string `form:"order"`
+	AgentsFilterQueryParams
+
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	SortBy   string `form:"sort_by"`
+	Order    string `form:"order"`
+
+	// Cursor is used for keyset pagination instead of Page, an empty cursor means the first page
+	Cursor string `form:"cursor"`
+	// Total is the way of counting the agents in keyset pagination (exact, estimate or none)
+	Total string `form:"total"`
+
+	// Facets are the fields to count the matching agents by their values, repeated or comma-separated
+	Facets      []string `form:"facets"`
+	FacetsLimit int      `form:"facets_limit"`
 }
 
 // AgentPagination represents pagination details for a list of agents.
@@ -54,12 +254,23 @@ type AgentPagination struct {
 	TotalPages  int   `json:"total_pages"`
 	CurrentPage int   `json:"current_page"`
 	PerPage     int   `json:"per_page"`
+
+	TotalIsEstimate bool   `json:"total_is_estimate,omitempty"`
+	NextCursor      string `json:"next_cursor,omitempty"`
+	PrevCursor      string `json:"prev_cursor,omitempty"`
+}
+
+// AgentFacetValue represents the number of matching agents having a value.
+type AgentFacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
 
 // AgentsData represents data containing a list of agents and pagination details.
 type AgentsData struct {
-	Agents     []Agent         `json:"agents"`
-	Pagination AgentPagination `json:"pagination"`
+	Agents     []Agent                      `json:"agents"`
+	Pagination AgentPagination              `json:"pagination"`
+	Facets     map[string][]AgentFacetValue `json:"facets,omitempty"`
 }
 
 // GetAgentsResponse represents the response format for fetching agents.
@@ -73,3 +284,166 @@ type AgentDetailedResponse struct {
 	Message string `json:"message,omitempty"`
 	Agent   Agent  `json:"agent,omitempty"`
 }
+
+// RefreshAgentQueryParams represents the query parameters for refreshing an agent.
+type RefreshAgentQueryParams struct {
+	Provider string `form:"provider"`
+}
+
+// RefreshAgentResponse represents the response format for refreshing an agent.
+type RefreshAgentResponse struct {
+	Message string `json:"message"`
+	Before  Agent  `json:"before"`
+	After   Agent  `json:"after"`
+}
+
+// DeleteAgentResponse represents the response format for deleting or purging an agent.
+type DeleteAgentResponse struct {
+	Message string `json:"message"`
+}
+
+// BulkDeleteAgentsQueryParams represents the query parameters for deleting agents by filter.
+type BulkDeleteAgentsQueryParams struct {
+	AgentsFilterQueryParams
+
+	DryRun bool `form:"dry_run"`
+	Force  bool `form:"force"`
+}
+
+// BulkDeleteAgentsResponse represents the response format for deleting agents by filter.
+type BulkDeleteAgentsResponse struct {
+	Message       string  `json:"message"`
+	DryRun        bool    `json:"dry_run"`
+	MatchedAgents int64   `json:"matched_agents"`
+	DeletedAgents int64   `json:"deleted_agents"`
+	Sample        []Agent `json:"sample,omitempty"`
+}
+
+// ExportAgentsQueryParams represents the query parameters for exporting agents.
+type ExportAgentsQueryParams struct {
+	AgentsFilterQueryParams
+
+	// Format is the format of the exported file (csv or ndjson)
+	Format string `form:"format"`
+}
+
+// ImportAgentsQueryParams represents the query parameters for importing agents.
+type ImportAgentsQueryParams struct {
+	// Format is the format of the body (csv or ndjson), it defaults to the content type of the request
+	Format string `form:"format"`
+	// Async runs the import as a background job
+	Async bool `form:"async"`
+}
+
+// ImportLineResult represents the result of importing a line.
+type ImportLineResult struct {
+	Line      int    `json:"line"`
+	IPAddress string `json:"ip_address,omitempty"`
+	Status    string `json:"status"`
+	AgentID   uint   `json:"agent_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ImportReport represents the per-line report of an import.
+type ImportReport struct {
+	Created int                `json:"created"`
+	Skipped int                `json:"skipped"`
+	Failed  int                `json:"failed"`
+	Lines   []ImportLineResult `json:"lines"`
+}
+
+// newImportReport converts the report of the importer to its response model
+func newImportReport(r *importer.Report) *ImportReport {
+	if r == nil {
+		return nil
+	}
+
+	report := &ImportReport{
+		Created: r.Created,
+		Skipped: r.Skipped,
+		Failed:  r.Failed,
+		Lines:   make([]ImportLineResult, 0, len(r.Lines)),
+	}
+	for _, line := range r.Lines {
+		report.Lines = append(report.Lines, ImportLineResult{
+			Line:      line.Line,
+			IPAddress: line.IPAddress,
+			Status:    line.Status,
+			AgentID:   line.AgentID,
+			Reason:    line.Reason,
+		})
+	}
+
+	return report
+}
+
+// ImportAgentsResponse represents the response format for importing agents.
+type ImportAgentsResponse struct {
+	Message string       `json:"message"`
+	Report  ImportReport `json:"report"`
+}
+
+// ImportJob represents an import running in the background.
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Processed  int           `json:"processed"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+}
+
+// newImportJob converts the import job to its response model
+func newImportJob(j importer.Job) ImportJob {
+	return ImportJob{
+		ID:         j.ID,
+		Status:     j.Status,
+		Processed:  j.Processed,
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt,
+		Error:      j.Error,
+		Report:     newImportReport(j.Report),
+	}
+}
+
+// ImportJobResponse represents the response format for an import job.
+type ImportJobResponse struct {
+	Message string    `json:"message"`
+	Job     ImportJob `json:"job"`
+}
+
+// EnrichmentJob represents the background enrichment of an agent created with async. The status is queued, running,
+// succeeded or dead, dead jobs have no attempts left and their agent is failed.
+type EnrichmentJob struct {
+	ID          uint      `json:"id"`
+	AgentID     uint      `json:"agent_id"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	RunAt       time.Time `json:"run_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// newEnrichmentJob converts the enrichment job to its response model
+func newEnrichmentJob(j *db.EnrichmentJob) EnrichmentJob {
+	return EnrichmentJob{
+		ID:          j.ID,
+		AgentID:     j.AgentID,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		LastError:   j.LastError,
+		RunAt:       j.RunAt,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+	}
+}
+
+// EnrichmentJobResponse represents the response format for the enrichment job of an agent.
+type EnrichmentJobResponse struct {
+	Message string        `json:"message"`
+	Job     EnrichmentJob `json:"job"`
+}
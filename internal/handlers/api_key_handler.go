@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"argus/internal/auth"
+	"argus/internal/db"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// parseAPIKeyID parses the key_id path parameter, it writes the error response in case of an invalid id.
+func parseAPIKeyID(c *gin.Context) (uint, bool) {
+	keyID, err := strconv.ParseUint(c.Param("key_id"), 10, 0)
+	if err != nil {
+		logger.WithError(err).Debug("cannot parse api key id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "key_id is not provided or is not valid"})
+		return 0, false
+	}
+
+	return uint(keyID), true
+}
+
+// normalizeScopes sorts the scopes and removes the repeated ones
+func normalizeScopes(scopes []string) db.Scopes {
+	normalized := slices.Clone(scopes)
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// HandleCreateAPIKey handles requests to create a new API key
+// @Summary Create an API key
+// @Description Create a new API key, the secret and the signing secret are only returned in this response.
+// @Description The admin scope can only be granted to the keys of the default tenant.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Request body for creating an API key"
+// @Success 201 {object} CreateAPIKeyResponse "Successfully created API key"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys [post]
+func (gh *GinHandler) HandleCreateAPIKey(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleCreateAPIKey")
+	defer span.End()
+
+	var createRequest CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&createRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse create api key request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := createRequest.validate(); err != nil {
+		logger.WithError(err).Debug("cannot validate create api key request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	scopes := normalizeScopes(createRequest.Scopes)
+	if len(scopes) == 0 {
+		scopes = auth.DefaultScopes
+	}
+
+	tenantID := createRequest.TenantID
+	if tenantID == "" {
+		tenantID = db.TenantFromContext(ctx)
+	}
+	if _, err := gh.tenants.Get(ctx, tenantID); err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown tenant"})
+			return
+		}
+		logger.WithError(err).Warn("cannot retrieve the tenant of the api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create api key"})
+		return
+	}
+	if slices.Contains(scopes, auth.ScopeAdmin) && !auth.CanGrantAdmin(tenantID) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the admin scope can only be granted to the keys of the default tenant"})
+		return
+	}
+
+	secret, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		logger.WithError(err).Warn("cannot generate api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create api key"})
+		return
+	}
+	signingSecret, err := auth.GenerateSigningSecret()
+	if err != nil {
+		logger.WithError(err).Warn("cannot generate signing secret")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create api key"})
+		return
+	}
+
+	apiKey, err := gh.db.CreateAPIKey(ctx, &db.APIKey{
+		Prefix:    prefix,
+		Hash:      auth.HashAPIKey(secret),
+		Name:      createRequest.Name,
+		Owner:     createRequest.Owner,
+		TenantID:  tenantID,
+		ExpiresAt: createRequest.ExpiresAt,
+		Limits:    createRequest.Limits.toDB(),
+		Scopes:    scopes,
+		Signing: db.APIKeySigning{
+			SigningSecret:    signingSecret,
+			RequireSignature: createRequest.RequireSignature,
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Warn("cannot create api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create api key"})
+		return
+	}
+
+	setAuditResourceID(c, apiKey.ID)
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{
+		Message:       "api key has been created, the secrets cannot be retrieved again",
+		Secret:        secret,
+		SigningSecret: signingSecret,
+		APIKey:        newAPIKey(apiKey),
+	})
+}
+
+// HandleGetAPIKeys handles requests to list the API keys
+// @Summary List API keys
+// @Description List the API keys without their secrets, the revoked keys are excluded by default
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param owner query string false "Owner of the keys"
+// @Param include_revoked query bool false "Include the revoked keys"
+// @Success 200 {object} GetAPIKeysResponse "Successfully retrieved API keys"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys [get]
+func (gh *GinHandler) HandleGetAPIKeys(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetAPIKeys")
+	defer span.End()
+
+	var queryParams GetAPIKeysQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+
+	keys, err := gh.db.GetAPIKeys(ctx, queryParams.Owner, queryParams.IncludeRevoked)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve api keys")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve api keys"})
+		return
+	}
+
+	apiKeys := make([]APIKey, len(keys))
+	for i := range keys {
+		apiKeys[i] = newAPIKey(&keys[i])
+	}
+
+	c.JSON(http.StatusOK, GetAPIKeysResponse{
+		Message: "api keys have been retrieved successfully",
+		APIKeys: apiKeys,
+	})
+}
+
+// HandleRevokeAPIKey handles requests to revoke an API key
+// @Summary Revoke an API key
+// @Description Revoke an API key, other instances may accept it until their cache of the key expires
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key_id path int true "ID of the API key to revoke"
+// @Success 200 {object} APIKeyResponse "Successfully revoked API key"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys/{key_id} [delete]
+func (gh *GinHandler) HandleRevokeAPIKey(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleRevokeAPIKey")
+	defer span.End()
+
+	keyID, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	apiKey, err := gh.db.RevokeAPIKey(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot revoke api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot revoke api key"})
+		return
+	}
+	gh.apiKeys.Invalidate(apiKey.Prefix)
+
+	c.JSON(http.StatusOK, APIKeyResponse{
+		Message: "api key has been revoked successfully",
+		APIKey:  newAPIKey(apiKey),
+	})
+}
+
+// HandleUpdateAPIKeyLimits handles requests to change the limits of an API key
+// @Summary Update the limits of an API key
+// @Description Replace the rate limit and the quotas of an API key, null limits are the defaults and zero means unlimited
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key_id path int true "ID of the API key"
+// @Param request body APIKeyLimits true "Limits of the API key"
+// @Success 200 {object} APIKeyResponse "Successfully updated API key"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys/{key_id}/limits [put]
+func (gh *GinHandler) HandleUpdateAPIKeyLimits(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleUpdateAPIKeyLimits")
+	defer span.End()
+
+	keyID, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	var limits APIKeyLimits
+	if err := c.ShouldBindJSON(&limits); err != nil {
+		logger.WithError(err).Debug("cannot parse api key limits")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := limits.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	apiKey, err := gh.db.UpdateAPIKeyLimits(ctx, keyID, limits.toDB())
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot update api key limits")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key limits"})
+		return
+	}
+	// The limits are cached with the key
+	gh.apiKeys.Invalidate(apiKey.Prefix)
+
+	c.JSON(http.StatusOK, APIKeyResponse{
+		Message: "api key limits have been updated successfully",
+		APIKey:  newAPIKey(apiKey),
+	})
+}
+
+// HandleUpdateAPIKeyScopes handles requests to change the scopes of an API key
+// @Summary Update the scopes of an API key
+// @Description Replace the scopes of an API key, the scopes are agents:read, agents:write, agents:delete, export and admin.
+// @Description The admin scope can only be granted to the keys of the default tenant.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key_id path int true "ID of the API key"
+// @Param request body UpdateAPIKeyScopesRequest true "Scopes of the API key"
+// @Success 200 {object} APIKeyResponse "Successfully updated API key"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys/{key_id}/scopes [put]
+func (gh *GinHandler) HandleUpdateAPIKeyScopes(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleUpdateAPIKeyScopes")
+	defer span.End()
+
+	keyID, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	var updateRequest UpdateAPIKeyScopesRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse api key scopes")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := updateRequest.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	scopes := normalizeScopes(updateRequest.Scopes)
+	if slices.Contains(scopes, auth.ScopeAdmin) {
+		apiKey, err := gh.db.GetAPIKeyByID(ctx, keyID)
+		if err != nil {
+			if errors.Is(err, db.ErrAPIKeyNotFound) {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+				return
+			}
+			logger.WithError(err).Warn("cannot retrieve api key")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key scopes"})
+			return
+		}
+		if !auth.CanGrantAdmin(apiKey.TenantID) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the admin scope can only be granted to the keys of the default tenant"})
+			return
+		}
+	}
+
+	apiKey, err := gh.db.UpdateAPIKeyScopes(ctx, keyID, scopes)
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot update api key scopes")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key scopes"})
+		return
+	}
+	// The scopes are cached with the key
+	gh.apiKeys.Invalidate(apiKey.Prefix)
+
+	c.JSON(http.StatusOK, APIKeyResponse{
+		Message: "api key scopes have been updated successfully",
+		APIKey:  newAPIKey(apiKey),
+	})
+}
+
+// HandleUpdateAPIKeySigning handles requests to change the signing of the requests of an API key
+// @Summary Update the signing of an API key
+// @Description Require the requests of an API key to be signed or rotate its signing secret, the new secret is only returned in this response
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key_id path int true "ID of the API key"
+// @Param request body UpdateAPIKeySigningRequest true "Signing of the API key"
+// @Success 200 {object} UpdateAPIKeySigningResponse "Successfully updated API key"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/api-keys/{key_id}/signing [put]
+func (gh *GinHandler) HandleUpdateAPIKeySigning(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleUpdateAPIKeySigning")
+	defer span.End()
+
+	keyID, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	var updateRequest UpdateAPIKeySigningRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse api key signing")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+
+	apiKey, err := gh.db.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot retrieve api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key signing"})
+		return
+	}
+
+	signing := db.APIKeySigning{
+		SigningSecret:    apiKey.Signing.SigningSecret,
+		RequireSignature: updateRequest.RequireSignature,
+	}
+	var newSecret string
+	if updateRequest.RotateSecret || signing.SigningSecret == "" {
+		if newSecret, err = auth.GenerateSigningSecret(); err != nil {
+			logger.WithError(err).Warn("cannot generate signing secret")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key signing"})
+			return
+		}
+		signing.SigningSecret = newSecret
+	}
+
+	apiKey, err = gh.db.UpdateAPIKeySigning(ctx, keyID, signing)
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot update api key signing")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update api key signing"})
+		return
+	}
+	// The signing is cached with the key
+	gh.apiKeys.Invalidate(apiKey.Prefix)
+
+	c.JSON(http.StatusOK, UpdateAPIKeySigningResponse{
+		Message:       "api key signing has been updated successfully",
+		SigningSecret: newSecret,
+		APIKey:        newAPIKey(apiKey),
+	})
+}
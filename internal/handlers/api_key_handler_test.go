@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/iputil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.Default()
+	router.POST("/admin/api-keys", gh.HandleCreateAPIKey)
+	router.GET("/admin/api-keys", gh.HandleGetAPIKeys)
+	router.DELETE("/admin/api-keys/:key_id", gh.HandleRevokeAPIKey)
+	router.GET("/protected", gh.AuthMiddleware(gh.apiKeys), gh.BillingMiddleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	callProtected := func(key string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Invalid requests
+	for _, body := range []string{`{"owner":"team"}`, `{"name":"old","expires_at":"2000-01-01T00:00:00Z"}`} {
+		req, _ := http.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// Create a key, its secret is only in the create response
+	req, _ := http.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewBufferString(`{"name":"ci","owner":"team-a"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createResponse CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	assert.Contains(t, createResponse.Secret, createResponse.APIKey.Prefix)
+	assert.Equal(t, "ci", createResponse.APIKey.Name)
+
+	assert.Equal(t, http.StatusNoContent, callProtected(createResponse.Secret))
+	assert.Equal(t, http.StatusNoContent, callProtected("bootstrap_key"))
+	assert.Equal(t, http.StatusUnauthorized, callProtected(createResponse.Secret+"0"))
+	assert.Equal(t, http.StatusUnauthorized, callProtected(""))
+
+	// List the keys of the owner
+	req, _ = http.NewRequest(http.MethodGet, "/admin/api-keys?owner=team-a", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), createResponse.Secret)
+
+	var listResponse GetAPIKeysResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResponse))
+	assert.Len(t, listResponse.APIKeys, 1)
+	assert.Equal(t, createResponse.APIKey.ID, listResponse.APIKeys[0].ID)
+
+	// Revoke the key
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/admin/api-keys/%d", createResponse.APIKey.ID), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var revokeResponse APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &revokeResponse))
+	assert.NotNil(t, revokeResponse.APIKey.RevokedAt)
+	assert.Equal(t, http.StatusUnauthorized, callProtected(createResponse.Secret))
+
+	req, _ = http.NewRequest(http.MethodDelete, "/admin/api-keys/999999", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"argus/internal/auth"
+	"argus/internal/db"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"time"
+)
+
+// APIKey represents information about an API key, the secret is never included.
+type APIKey struct {
+	ID         uint       `json:"id"`
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner,omitempty"`
+	TenantID   string     `json:"tenant_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// Limits overrides the default limits, the limits missing here are the defaults
+	Limits APIKeyLimits `json:"limits"`
+	Scopes []string     `json:"scopes"`
+	// CanSign is true if the key has a signing secret, RequireSignature rejects the unsigned requests of the key
+	CanSign          bool `json:"can_sign"`
+	RequireSignature bool `json:"require_signature"`
+}
+
+// APIKeyLimits represents the limits of an API key, null means the default and zero means unlimited.
+type APIKeyLimits struct {
+	// RateLimit is the number of requests per second, Burst is the number of requests allowed at once
+	RateLimit    *float64 `json:"rate_limit"`
+	Burst        *int     `json:"burst"`
+	DailyQuota   *int64   `json:"daily_quota"`
+	MonthlyQuota *int64   `json:"monthly_quota"`
+}
+
+func (l APIKeyLimits) validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.RateLimit, validation.Min(0.0)),
+		validation.Field(&l.Burst, validation.Min(0)),
+		validation.Field(&l.DailyQuota, validation.Min(int64(0))),
+		validation.Field(&l.MonthlyQuota, validation.Min(int64(0))),
+	)
+}
+
+// toDB converts the limits to their database model
+func (l APIKeyLimits) toDB() db.APIKeyLimits {
+	return db.APIKeyLimits{
+		RateLimit:    l.RateLimit,
+		Burst:        l.Burst,
+		DailyQuota:   l.DailyQuota,
+		MonthlyQuota: l.MonthlyQuota,
+	}
+}
+
+// newAPIKey converts the database model of an API key to its response model
+func newAPIKey(k *db.APIKey) APIKey {
+	return APIKey{
+		ID:               k.ID,
+		Prefix:           k.Prefix,
+		Name:             k.Name,
+		Owner:            k.Owner,
+		TenantID:         k.TenantID,
+		CreatedAt:        k.CreatedAt,
+		ExpiresAt:        k.ExpiresAt,
+		RevokedAt:        k.RevokedAt,
+		LastUsedAt:       k.LastUsedAt,
+		Scopes:           k.Scopes,
+		CanSign:          k.Signing.SigningSecret != "",
+		RequireSignature: k.Signing.RequireSignature,
+		Limits: APIKeyLimits{
+			RateLimit:    k.Limits.RateLimit,
+			Burst:        k.Limits.Burst,
+			DailyQuota:   k.Limits.DailyQuota,
+			MonthlyQuota: k.Limits.MonthlyQuota,
+		},
+	}
+}
+
+// CreateAPIKeyRequest represents the request format for creating an API key.
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// TenantID is the tenant of the clients of the key, the tenant of the creator by default
+	TenantID string `json:"tenant_id"`
+	// ExpiresAt is optional, the key does not expire without it
+	ExpiresAt *time.Time   `json:"expires_at"`
+	Limits    APIKeyLimits `json:"limits"`
+	// Scopes are the permissions of the key, agents:read by default
+	Scopes []string `json:"scopes"`
+	// RequireSignature rejects the requests of the key which are not signed by its signing secret
+	RequireSignature bool `json:"require_signature"`
+}
+
+func (req CreateAPIKeyRequest) validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name,
+			validation.Required.Error("name cannot be empty"),
+			validation.Length(1, 100),
+		),
+		validation.Field(&req.Owner,
+			validation.Length(0, 100),
+		),
+		validation.Field(&req.ExpiresAt,
+			validation.By(func(value any) error {
+				if expiresAt, _ := value.(*time.Time); expiresAt != nil && !expiresAt.After(time.Now()) {
+					return validation.NewError("validation_expires_at_past", "expiration time should be in the future")
+				}
+				return nil
+			}),
+		),
+		validation.Field(&req.Limits, validation.By(func(any) error {
+			return req.Limits.validate()
+		})),
+		validation.Field(&req.Scopes, validation.By(validateScopes)),
+	)
+}
+
+// validateScopes checks the scopes are known
+func validateScopes(value any) error {
+	scopes, _ := value.([]string)
+	for _, scope := range scopes {
+		if !auth.IsValidScope(scope) {
+			return validation.NewError("validation_scope_unknown", fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+	return nil
+}
+
+// UpdateAPIKeyScopesRequest represents the request format for replacing the scopes of an API key.
+type UpdateAPIKeyScopesRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+func (req UpdateAPIKeyScopesRequest) validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Scopes,
+			validation.Required.Error("scopes cannot be empty"),
+			validation.By(validateScopes),
+		),
+	)
+}
+
+// CreateAPIKeyResponse represents the response format for creating an API key, the secrets are only returned once.
+type CreateAPIKeyResponse struct {
+	Message string `json:"message"`
+	Secret  string `json:"secret"`
+	// SigningSecret signs the requests of the key
+	SigningSecret string `json:"signing_secret"`
+	APIKey        APIKey `json:"api_key"`
+}
+
+// GetAPIKeysQueryParams represents the query parameters for listing the API keys.
+type GetAPIKeysQueryParams struct {
+	Owner          string `form:"owner"`
+	IncludeRevoked bool   `form:"include_revoked"`
+}
+
+// GetAPIKeysResponse represents the response format for listing the API keys.
+type GetAPIKeysResponse struct {
+	Message string   `json:"message"`
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+// APIKeyResponse represents the response format for an API key.
+type APIKeyResponse struct {
+	Message string `json:"message"`
+	APIKey  APIKey `json:"api_key"`
+}
+
+// UpdateAPIKeySigningRequest represents the request format for changing the signing of an API key.
+type UpdateAPIKeySigningRequest struct {
+	// RequireSignature rejects the requests of the key which are not signed
+	RequireSignature bool `json:"require_signature"`
+	// RotateSecret replaces the signing secret, a secret is always created if the key has none
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// UpdateAPIKeySigningResponse represents the response format for changing the signing of an API key, the signing
+// secret is only returned if it is created.
+type UpdateAPIKeySigningResponse struct {
+	Message       string `json:"message"`
+	SigningSecret string `json:"signing_secret,omitempty"`
+	APIKey        APIKey `json:"api_key"`
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	AuditEventsDefaultLimit = 100
+	AuditEventsMaxLimit     = 1000
+	// AuditSummaryMaxBodySize is the maximum size of the JSON bodies whose fields are listed in the audit summaries
+	AuditSummaryMaxBodySize = 64 << 10
+	// AuditSummaryMaxIDs is the maximum number of IDs of the affected resources listed in the audit summaries
+	AuditSummaryMaxIDs = 1000
+)
+
+// Keys of the audited details of the request in the gin context, they are set by the handlers
+const (
+	contextKeyAuditResourceID = "audit_resource_id"
+	contextKeyAuditDetails    = "audit_details"
+)
+
+// setAuditResourceID sets the ID of the resource of the audited action, e.g. the ID of a created agent
+func setAuditResourceID(c *gin.Context, id any) {
+	c.Set(contextKeyAuditResourceID, fmt.Sprint(id))
+}
+
+// setAuditDetail adds a detail of the result to the summary of the audited action, e.g. the number of deleted agents
+func setAuditDetail(c *gin.Context, key string, value any) {
+	details, _ := c.Value(contextKeyAuditDetails).(map[string]any)
+	if details == nil {
+		details = map[string]any{}
+		c.Set(contextKeyAuditDetails, details)
+	}
+	details[key] = value
+}
+
+// setAuditIDs adds the IDs of the resources affected by the audited action to the summary of its result, e.g. the
+// IDs of the created agents
+func setAuditIDs(c *gin.Context, key string, ids []uint) {
+	listed, truncated := auditIDs(ids)
+	setAuditDetail(c, key, listed)
+	if truncated {
+		setAuditDetail(c, key+"_truncated", true)
+	}
+}
+
+// auditIDs returns the IDs listed in the audit summaries, at most AuditSummaryMaxIDs of them, and whether there are
+// more of them
+func auditIDs(ids []uint) ([]uint, bool) {
+	if ids == nil {
+		return []uint{}, false
+	}
+	if len(ids) > AuditSummaryMaxIDs {
+		return ids[:AuditSummaryMaxIDs], true
+	}
+	return ids, false
+}
+
+// newRequestAuditEvent creates the audit event of the request with its client, without the outcome
+func newRequestAuditEvent(c *gin.Context) *db.AuditEvent {
+	event := &db.AuditEvent{
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		ClientIP:  c.ClientIP(),
+		TenantID:  db.TenantFromContext(c.Request.Context()),
+		RequestID: c.GetString(logger.ContextKeyRequestID),
+	}
+	if principal := principalFromContext(c); principal != nil {
+		event.Subject = principal.Subject
+		if principal.APIKey != nil {
+			event.APIKeyID = principal.APIKey.ID
+		}
+	}
+
+	return event
+}
+
+// recordAuditEvent stores the audit event, the request is not failed if it cannot be stored
+func (gh *GinHandler) recordAuditEvent(ctx context.Context, event *db.AuditEvent) {
+	if err := gh.audit.Record(ctx, event); err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"subject":    event.Subject,
+			"action":     event.Action,
+			"request_id": event.RequestID,
+		}).Error("cannot audit the request")
+	}
+}
+
+// summarizeRequest describes the request by its query and the fields of its JSON body, the values of the body are
+// not kept as they may be secrets. The body is left intact for the handlers.
+func summarizeRequest(c *gin.Context) map[string]any {
+	summary := map[string]any{}
+	if query := c.Request.URL.Query(); len(query) > 0 {
+		summary["query"] = query
+	}
+	if c.Request.ContentLength > 0 {
+		summary["bytes"] = c.Request.ContentLength
+	}
+	if c.ContentType() != "application/json" || c.Request.ContentLength <= 0 ||
+		c.Request.ContentLength > AuditSummaryMaxBodySize {
+		return summary
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return summary
+	}
+	var object map[string]json.RawMessage
+	var array []json.RawMessage
+	switch {
+	case json.Unmarshal(body, &object) == nil:
+		fields := make([]string, 0, len(object))
+		for field := range object {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		summary["fields"] = fields
+	case json.Unmarshal(body, &array) == nil:
+		summary["items"] = len(array)
+	}
+
+	return summary
+}
+
+// Audit records the requests of the action, e.g. agent.delete, in the append-only audit events with their client,
+// outcome and a summary. The resource of the action is its prefix, and its ID is the first ID in the route, e.g.
+// agent_id, unless the handler sets it. It should be used after the authentication and the tenant middlewares.
+func (gh *GinHandler) Audit(action string) gin.HandlerFunc {
+	resource, _, _ := strings.Cut(action, ".")
+	return func(c *gin.Context) {
+		summary := summarizeRequest(c)
+
+		c.Next()
+
+		event := newRequestAuditEvent(c)
+		event.Action = action
+		event.Resource = resource
+		for _, param := range c.Params {
+			if strings.HasSuffix(param.Key, "_id") {
+				event.ResourceID = param.Value
+				break
+			}
+		}
+		if id := c.GetString(contextKeyAuditResourceID); id != "" {
+			event.ResourceID = id
+		}
+		event.Status = c.Writer.Status()
+		event.Outcome = db.AuditSucceeded
+		if event.Status >= http.StatusBadRequest {
+			event.Outcome = db.AuditFailed
+		}
+		if details, ok := c.Value(contextKeyAuditDetails).(map[string]any); ok {
+			summary["result"] = details
+		}
+		if b, err := json.Marshal(summary); err == nil {
+			event.Summary = string(b)
+		}
+
+		gh.recordAuditEvent(c.Request.Context(), event)
+	}
+}
+
+// HandleGetAuditEvents handles requests to list the audit events
+// @Summary List audit events
+// @Description List the audited requests, i.e. the changes, the exports and the denied requests, newest first.
+// @Description The next page starts after the last event of the page with the next cursor.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant_id query string false "Filter the events by the tenant of the client"
+// @Param subject query string false "Filter the events by the client, e.g. api_key:1a2b3c4d"
+// @Param key query string false "Filter the events by the prefix of an API key"
+// @Param action query string false "Filter the events by the action, e.g. agent.delete"
+// @Param resource query string false "Filter the events by the resource, e.g. agent"
+// @Param resource_id query string false "Filter the events by the ID of the resource"
+// @Param outcome query string false "Filter the events by the outcome (succeeded, failed, denied)"
+// @Param request_id query string false "Filter the events by the ID of the request"
+// @Param from query string false "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD)"
+// @Param cursor query string false "Cursor of the page, from next_cursor of the previous page"
+// @Param limit query int false "Number of events in the page, 100 by default and at most 1000"
+// @Success 200 {object} GetAuditEventsResponse
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/audit [get]
+func (gh *GinHandler) HandleGetAuditEvents(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetAuditEvents")
+	defer span.End()
+
+	// Handle query params
+	var queryParams AuditEventsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	if queryParams.Limit == 0 {
+		queryParams.Limit = AuditEventsDefaultLimit
+	}
+	if queryParams.Limit < 0 || queryParams.Limit > AuditEventsMaxLimit {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("limit should be between 1 and %d", AuditEventsMaxLimit)})
+		return
+	}
+	var beforeID uint
+	var err error
+	if queryParams.Cursor != "" {
+		if beforeID, err = decodeAuditCursor(queryParams.Cursor); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	filter := queryParams.toFilter()
+	if queryParams.From != "" {
+		if filter.From, err = parseStatsTime(queryParams.From); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from: " + err.Error()})
+			return
+		}
+	}
+	if queryParams.To != "" {
+		if filter.To, err = parseStatsTime(queryParams.To); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to: " + err.Error()})
+			return
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from should be before to"})
+		return
+	}
+
+	var ok bool
+	if filter.APIKeyID, ok = gh.resolveUsageKey(c, queryParams.Key); !ok {
+		return
+	}
+
+	// One more event is fetched to know whether there is a next page
+	events, err := gh.db.GetAuditEvents(ctx, filter, beforeID, queryParams.Limit+1)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve the audit events")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the audit events"})
+		return
+	}
+
+	response := GetAuditEventsResponse{
+		Message: "audit events have been retrieved successfully",
+		Events:  make([]AuditEvent, 0, len(events)),
+	}
+	if len(events) > queryParams.Limit {
+		events = events[:queryParams.Limit]
+		response.NextCursor = encodeAuditCursor(events[len(events)-1].ID)
+	}
+	for i := range events {
+		response.Events = append(response.Events, newAuditEvent(&events[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/pkg/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(logger.GinMiddleware(), gh.AuthMiddleware(gh.apiKeys), gh.TenantMiddleware())
+	router.POST("/admin/tenants", gh.Audit("tenant.create"), gh.HandleCreateTenant)
+	router.POST("/admin/api-keys", gh.Audit("api_key.create"), gh.HandleCreateAPIKey)
+	router.GET("/admin/audit", gh.HandleGetAuditEvents)
+
+	call := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(auth.APIKeyHeader, "bootstrap_key")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create a tenant, then a key of the tenant twice with one of them failing
+	id := fmt.Sprintf("audit-%d", time.Now().UnixNano())
+	w := call(http.MethodPost, "/admin/tenants", fmt.Sprintf(`{"id":%q,"name":"Audit"}`, id))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	requestID := w.Header().Get(logger.RequestIDHeader)
+	assert.NotEmpty(t, requestID)
+	w = call(http.MethodPost, "/admin/api-keys", fmt.Sprintf(`{"name":"secret name","tenant_id":%q}`, id))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var createResponse CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	w = call(http.MethodPost, "/admin/api-keys", `{"name":"","tenant_id":"unknown"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	list := func(query string) GetAuditEventsResponse {
+		w := call(http.MethodGet, "/admin/audit?"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetAuditEventsResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// The created resources are audited with their ID
+	response := list("action=tenant.create&resource_id=" + id)
+	assert.Len(t, response.Events, 1)
+	event := response.Events[0]
+	assert.Equal(t, "tenant", event.Resource)
+	assert.Equal(t, requestID, event.RequestID)
+	assert.Equal(t, "api_key:"+auth.BootstrapAPIKey.Name, event.Subject)
+	assert.Equal(t, db.DefaultTenant, event.TenantID)
+	assert.Equal(t, http.StatusCreated, event.Status)
+
+	response = list(fmt.Sprintf("action=api_key.create&resource_id=%d", createResponse.APIKey.ID))
+	assert.Len(t, response.Events, 1)
+	assert.Equal(t, "succeeded", response.Events[0].Outcome)
+
+	// The summaries have the fields of the bodies without their values
+	response = list("action=api_key.create&outcome=failed&limit=1")
+	assert.Len(t, response.Events, 1)
+	var summary map[string]any
+	assert.NoError(t, json.Unmarshal(response.Events[0].Summary, &summary))
+	assert.Equal(t, []any{"name", "tenant_id"}, summary["fields"])
+	assert.NotContains(t, string(response.Events[0].Summary), "unknown")
+
+	// The events are paginated newest first
+	first := list("limit=1")
+	assert.Len(t, first.Events, 1)
+	assert.NotEmpty(t, first.NextCursor)
+	second := list("limit=1&cursor=" + first.NextCursor)
+	assert.Len(t, second.Events, 1)
+	assert.Less(t, second.Events[0].ID, first.Events[0].ID)
+
+	// Invalid queries
+	for _, query := range []string{"limit=-1", "limit=1001", "cursor=!", "from=yesterday", "from=2026-01-02&to=2026-01-01"} {
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/admin/audit?"+query, "").Code, query)
+	}
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/admin/audit?key=unknown", "").Code)
+}
+
+func TestAuditIDs(t *testing.T) {
+	ids, truncated := auditIDs(nil)
+	assert.Equal(t, []uint{}, ids)
+	assert.False(t, truncated)
+
+	// At most AuditSummaryMaxIDs IDs are listed
+	ids, truncated = auditIDs(make([]uint, AuditSummaryMaxIDs+1))
+	assert.Len(t, ids, AuditSummaryMaxIDs)
+	assert.True(t, truncated)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// AuditEventsQueryParams represents the query parameters for listing the audit events.
+type AuditEventsQueryParams struct {
+	TenantID string `form:"tenant_id"`
+	Subject  string `form:"subject"`
+	// Key is the prefix of an API key
+	Key        string `form:"key"`
+	Action     string `form:"action"`
+	Resource   string `form:"resource"`
+	ResourceID string `form:"resource_id"`
+	Outcome    string `form:"outcome"`
+	RequestID  string `form:"request_id"`
+	From       string `form:"from"`
+	To         string `form:"to"`
+	Cursor     string `form:"cursor"`
+	Limit      int    `form:"limit"`
+}
+
+// toFilter converts the query params to the filter of the audit events, except for the key and the time range
+func (q AuditEventsQueryParams) toFilter() db.AuditFilter {
+	optional := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+
+	return db.AuditFilter{
+		TenantID:   optional(q.TenantID),
+		Subject:    optional(q.Subject),
+		Action:     optional(q.Action),
+		Resource:   optional(q.Resource),
+		ResourceID: optional(q.ResourceID),
+		Outcome:    optional(q.Outcome),
+		RequestID:  optional(q.RequestID),
+	}
+}
+
+// AuditEvent represents an audited request, the summary describes the request without the values of its body.
+type AuditEvent struct {
+	ID         uint            `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	TenantID   string          `json:"tenant_id"`
+	Subject    string          `json:"subject"`
+	APIKeyID   uint            `json:"api_key_id"`
+	Action     string          `json:"action,omitempty"`
+	Resource   string          `json:"resource,omitempty"`
+	ResourceID string          `json:"resource_id,omitempty"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"`
+	Status     int             `json:"status,omitempty"`
+	Outcome    string          `json:"outcome"`
+	Reason     string          `json:"reason,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	ClientIP   string          `json:"client_ip,omitempty"`
+	Summary    json.RawMessage `json:"summary,omitempty" swaggertype:"object"`
+}
+
+func newAuditEvent(event *db.AuditEvent) AuditEvent {
+	response := AuditEvent{
+		ID:         event.ID,
+		CreatedAt:  event.CreatedAt,
+		TenantID:   event.TenantID,
+		Subject:    event.Subject,
+		APIKeyID:   event.APIKeyID,
+		Action:     event.Action,
+		Resource:   event.Resource,
+		ResourceID: event.ResourceID,
+		Method:     event.Method,
+		Route:      event.Route,
+		Status:     event.Status,
+		Outcome:    event.Outcome,
+		Reason:     event.Reason,
+		RequestID:  event.RequestID,
+		ClientIP:   event.ClientIP,
+	}
+	if json.Valid([]byte(event.Summary)) {
+		response.Summary = json.RawMessage(event.Summary)
+	}
+
+	return response
+}
+
+// GetAuditEventsResponse represents the response format for listing the audit events, newest first.
+// NextCursor is empty on the last page.
+type GetAuditEventsResponse struct {
+	Message    string       `json:"message"`
+	Events     []AuditEvent `json:"events"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// encodeAuditCursor converts the ID of the last event of a page to the cursor of the next page
+func encodeAuditCursor(id uint) string {
+	return strconv.FormatUint(uint64(id), 36)
+}
+
+// decodeAuditCursor parses a cursor created by encodeAuditCursor
+func decodeAuditCursor(cursor string) (uint, error) {
+	id, err := strconv.ParseUint(cursor, 36, 64)
+	if err != nil || id == 0 {
+		return 0, db.ErrInvalidCursor
+	}
+	return uint(id), nil
+}
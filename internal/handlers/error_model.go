@@ -3,3 +3,9 @@ package handlers
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
+
+// QueryErrorResponse represents the response format for an invalid filter query, Position is 1-based.
+type QueryErrorResponse struct {
+	Error    string `json:"error"`
+	Position int    `json:"position"`
+}
@@ -2,30 +2,328 @@ package handlers
 
 import (
 	"argus/config"
+	"argus/internal/audit"
+	"argus/internal/auth"
 	"argus/internal/db"
+	"argus/internal/importer"
 	"argus/internal/iputil"
+	"argus/internal/quota"
+	"argus/internal/tenant"
+	"argus/internal/usage"
+	"argus/pkg/logger"
+	"argus/pkg/ratelimit"
+	"bytes"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignedRequestMaxBodySize is the maximum size of the body of the signed requests, as they are read in memory
+const SignedRequestMaxBodySize = ImportMaxBodySize
+
+// Keys of the authenticated client in the gin context
+const (
+	// ContextKeyAPIKey is the key of the *db.APIKey of the requests authenticated by an API key
+	ContextKeyAPIKey = "api_key"
+	// ContextKeyPrincipal is the key of the *auth.Principal of the authenticated requests
+	ContextKeyPrincipal = "principal"
+	// ContextKeyTenant is the key of the *db.Tenant of the requests
+	ContextKeyTenant = "tenant"
 )
 
 type GinHandler struct {
 	cfg             config.Config
 	db              db.DB
 	ipStatsGatherer iputil.IPStatsGatherer
+	importJobs      *importer.Jobs
+	apiKeys         *auth.APIKeyStore
+	meter           *usage.Meter
+	quotas          *quota.Enforcer
+	signatures      *auth.SignatureVerifier
+	tenants         *tenant.Store
+	audit           *audit.Recorder
 }
 
 func NewGinHandler(cfg config.Config, db db.DB, ipStatsGatherer iputil.IPStatsGatherer) *GinHandler {
-	return &GinHandler{cfg: cfg, db: db, ipStatsGatherer: ipStatsGatherer}
+	return &GinHandler{
+		cfg:             cfg,
+		db:              db,
+		ipStatsGatherer: ipStatsGatherer,
+		importJobs:      importer.NewJobs(ImportJobRetention),
+		apiKeys:         auth.NewAPIKeyStore(db, time.Duration(cfg.Auth.APIKeyCacheTTLInSecs)*time.Second, cfg.Argus.APIKey),
+		meter:           usage.NewMeter(db, usage.DefaultFlushInterval),
+		quotas: quota.NewEnforcer(db, quota.Limits{
+			RateLimit:    cfg.Quota.RateLimit,
+			Burst:        cfg.Quota.Burst,
+			DailyQuota:   cfg.Quota.DailyQuota,
+			MonthlyQuota: cfg.Quota.MonthlyQuota,
+		}),
+		signatures: auth.NewSignatureVerifier(db, time.Duration(cfg.Signature.MaxSkewInSecs)*time.Second),
+		tenants:    tenant.NewStore(db, time.Duration(cfg.Tenants.CacheTTLInSecs)*time.Second),
+		audit:      audit.NewRecorder(db),
+	}
+}
+
+// SetAuditSink forwards the audit events to the sink besides storing them, nil stops forwarding them
+func (gh *GinHandler) SetAuditSink(sink audit.Sink) {
+	gh.audit.SetSink(sink)
+}
+
+// SetMeter meters the usage with the meter, e.g. to share it with the background workers and flush it on shutdown
+func (gh *GinHandler) SetMeter(meter *usage.Meter) {
+	gh.meter = meter
+}
+
+// apiKeyFromContext returns the API key authenticated by AuthMiddleware, or nil if there is none
+func apiKeyFromContext(c *gin.Context) *db.APIKey {
+	apiKey, _ := c.Value(ContextKeyAPIKey).(*db.APIKey)
+	return apiKey
 }
 
+// principalFromContext returns the authenticated client of the request, or nil if there is none
+func principalFromContext(c *gin.Context) *auth.Principal {
+	principal, _ := c.Value(ContextKeyPrincipal).(*auth.Principal)
+	return principal
+}
+
+// tenantFromContext returns the tenant of the request set by TenantMiddleware, or nil if there is none
+func tenantFromContext(c *gin.Context) *db.Tenant {
+	t, _ := c.Value(ContextKeyTenant).(*db.Tenant)
+	return t
+}
+
+// usageEndpoint returns the endpoint of the request in the usage, e.g. GET /api/v1/agents/:agent_id
+func usageEndpoint(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		route = "unknown"
+	}
+	return c.Request.Method + " " + route
+}
+
+// APIKeyAuthenticator returns the authenticator of the API keys, which are cached by the handler
+func (gh *GinHandler) APIKeyAuthenticator() auth.Authenticator {
+	return gh.apiKeys
+}
+
+// AuthMiddleware authenticates the requests by the first authenticator finding credentials in them, the requests
+// without any credentials are rejected. The principal of the request is put in the gin context for the handlers and
+// the logs, with its API key if it has one.
+func (gh *GinHandler) AuthMiddleware(authenticators ...auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.AuthenticateRequest(c.Request)
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidCredentials) {
+					logger.WithError(err).Debug("cannot authenticate the request")
+					if errors.Is(err, auth.ErrInvalidToken) {
+						c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+					}
+					c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+					return
+				}
+				logger.WithError(err).Warn("cannot check the credentials of the request")
+				c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot check the credentials"})
+				return
+			}
+			if principal == nil {
+				continue
+			}
+
+			c.Set(ContextKeyPrincipal, principal)
+			c.Set(logger.ContextKeyUser, principal.Subject)
+			if principal.APIKey != nil {
+				c.Set(ContextKeyAPIKey, principal.APIKey)
+			}
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+	}
+}
+
+// TenantMiddleware restricts the queries of the request to the tenant of its client, the clients which are not bound
+// to a tenant belong to the default tenant. It should be used after AuthMiddleware, if the requests are authenticated.
+// The engine should have ContextWithFallback, so the queries made with the gin context are restricted too.
+func (gh *GinHandler) TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := db.DefaultTenant
+		if principal := principalFromContext(c); principal != nil && principal.Tenant != "" {
+			tenantID = principal.Tenant
+		}
+
+		t, err := gh.tenants.Get(c, tenantID)
+		if err != nil {
+			if errors.Is(err, db.ErrTenantNotFound) {
+				logger.WithField("tenant", tenantID).Debug("the tenant of the request does not exist")
+				c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "unknown tenant"})
+				return
+			}
+			logger.WithError(err).Warn("cannot retrieve the tenant of the request")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the tenant"})
+			return
+		}
+
+		c.Set(ContextKeyTenant, t)
+		c.Request = c.Request.WithContext(db.WithTenant(c.Request.Context(), t.ID))
+		c.Next()
+	}
+}
+
+// BillingMiddleware meters the usage of the requests authenticated by an API key, it should be used after
+// AuthMiddleware, and after SignatureMiddleware and QuotaMiddleware so that the requests they reject are not billed.
+// The upstream lookups made with the context of the request are counted for its key too.
 func (gh *GinHandler) BillingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		key := c.Request.Header.Get("API-Key")
-		// TODO: should be defined for each agent in a separate table (Out of scope of this project)
-		if key != gh.cfg.Argus.APIKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-			c.Abort()
+		apiKey := apiKeyFromContext(c)
+		if apiKey == nil {
+			c.Next()
+			return
+		}
+
+		request := gh.meter.StartRequest(apiKey.ID, usageEndpoint(c))
+		c.Request = c.Request.WithContext(iputil.WithUpstreamObserver(c.Request.Context(), request))
+
+		c.Next()
+		request.Finish(c.Writer.Status())
+	}
+}
+
+// SignatureMiddleware verifies the signatures of the requests of the API keys, the requests without a signature are
+// only rejected if their key requires signing. It should be used after AuthMiddleware.
+func (gh *GinHandler) SignatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := apiKeyFromContext(c)
+		signature := c.Request.Header.Get(auth.SignatureHeader)
+		if apiKey == nil || (signature == "" && !apiKey.Signing.RequireSignature) {
+			c.Next()
+			return
+		}
+		if signature == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "the requests of the api key should be signed"})
+			return
 		}
+
+		// The body is hashed in the signature, so it is read and replaced for the handlers
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, SignedRequestMaxBodySize))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "the body of the signed request is too large"})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "cannot read request body"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		err := gh.signatures.Verify(c.Request.Context(), apiKey, auth.SignedRequest{
+			Method:    c.Request.Method,
+			URI:       c.Request.URL.RequestURI(),
+			Timestamp: c.Request.Header.Get(auth.TimestampHeader),
+			Nonce:     c.Request.Header.Get(auth.NonceHeader),
+			Signature: signature,
+			Body:      body,
+		})
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidSignature) {
+				logger.WithError(err).WithField("api_key_id", apiKey.ID).Debug("cannot verify the signature of the request")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+				return
+			}
+			logger.WithError(err).Warn("cannot check the signature of the request")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot check the signature of the request"})
+			return
+		}
+
 		c.Next()
 	}
 }
+
+// ceilSeconds formats the duration in whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// QuotaMiddleware rejects the requests exceeding the rate limit or the quotas of their API key with
+// 429 Too Many Requests, it should be used after AuthMiddleware. The RateLimit headers describe the limit
+// with the least remaining requests. If the limits cannot be checked, the request is allowed.
+func (gh *GinHandler) QuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The bootstrap key is not limited, so it can always be used to manage the keys
+		apiKey := apiKeyFromContext(c)
+		if apiKey == nil || apiKey.ID == 0 {
+			c.Next()
+			return
+		}
+
+		decision, err := gh.quotas.Check(c.Request.Context(), apiKey)
+		if err != nil {
+			logger.WithError(err).WithField("api_key_id", apiKey.ID).Warn("cannot check the limits of the api key")
+			c.Next()
+			return
+		}
+
+		if status, ok := decision.Closest(); ok {
+			c.Header("RateLimit-Policy", decision.Policy())
+			c.Header("RateLimit-Limit", strconv.FormatInt(status.Limit, 10))
+			c.Header("RateLimit-Remaining", strconv.FormatInt(status.Remaining, 10))
+			c.Header("RateLimit-Reset", ceilSeconds(status.Reset))
+		}
+		if !decision.Allowed {
+			c.Header("Retry-After", ceilSeconds(decision.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: decision.Exceeded + " exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimitMiddleware rejects the requests exceeding the rate limit of their key, e.g. the IP of the client, with
+// 429 Too Many Requests
+func (gh *GinHandler) RateLimitMiddleware(limiter ratelimit.Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if allowed, retryAfter := limiter.Allow(key(c)); !allowed {
+			c.Header("Retry-After", ceilSeconds(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: "rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects the requests whose client is not granted the scope with 403 Forbidden naming the missing
+// scope, the denied attempts are audited. It should be used after the authentication middlewares.
+func (gh *GinHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFromContext(c)
+		if principal == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+			return
+		}
+		if principal.HasScope(scope) {
+			c.Next()
+			return
+		}
+
+		reason := "missing scope " + scope
+		event := newRequestAuditEvent(c)
+		event.Outcome = db.AuditDenied
+		event.Reason = reason
+		event.Status = http.StatusForbidden
+		gh.recordAuditEvent(c.Request.Context(), event)
+
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: reason})
+	}
+}
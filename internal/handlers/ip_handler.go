@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"argus/internal/iputil"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"net/netip"
+)
+
+// Results of the IP lookups in the metrics
+const (
+	LookupResultEnriched = "enriched"
+	LookupResultBogon    = "bogon"
+	LookupResultFailed   = "failed"
+)
+
+var ipLookupsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "argus_ip_lookups_total",
+	Help: "Number of the IP lookups by their result",
+}, []string{"result"})
+
+// HandleLookupIP handles enriching an IP address without creating an agent
+// @Summary Look up an IP address
+// @Description Gather the statistics and the classification of an IP address without creating an agent.
+// @Description The statistics are not gathered for bogon IP addresses, e.g. private ones.
+// @Tags ip
+// @Accept json
+// @Produce json
+// @Param ip path string true "IPv4 or IPv6 address"
+// @Param provider query string false "Name of the IP stats provider to use, default is the configured one"
+// @Success 200 {object} LookupIPResponse
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 429 {object} ErrorResponse "Rate limit exceeded"
+// @Failure 503 {object} ErrorResponse "Cannot gather statistics"
+// @Router /ip/{ip} [get]
+func (gh *GinHandler) HandleLookupIP(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleLookupIP")
+	defer span.End()
+
+	var queryParams LookupIPQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	ip, err := netip.ParseAddr(c.Param("ip"))
+	if err != nil || ip.Zone() != "" {
+		logger.WithField("ip", c.Param("ip")).Debug("cannot parse the ip address")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "IP should be in format of IPv4 or IPv6"})
+		return
+	}
+	gh.lookupIP(ctx, c, ip, queryParams.Provider)
+}
+
+// lookupIP classifies the IP address and gathers its stats if it is not a bogon, then writes the response
+func (gh *GinHandler) lookupIP(ctx context.Context, c *gin.Context, ip netip.Addr, provider string) {
+	ip = ip.Unmap()
+	response := LookupIPResponse{
+		IPAddress:      ip.String(),
+		Classification: iputil.Classify(ip),
+	}
+
+	// Bogon IP addresses have no statistics
+	if response.Classification.Bogon {
+		ipLookupsCounter.WithLabelValues(LookupResultBogon).Inc()
+		response.Message = "the IP address is not public, no statistics are gathered"
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	stats, ok := gh.gatherIPStats(ctx, c, provider, response.IPAddress)
+	if !ok {
+		ipLookupsCounter.WithLabelValues(LookupResultFailed).Inc()
+		return
+	}
+	ipLookupsCounter.WithLabelValues(LookupResultEnriched).Inc()
+
+	response.Message = "statistics of the IP address have been gathered successfully"
+	response.Stats = stats
+	c.JSON(http.StatusOK, response)
+}
+
+// clientAddr returns the address of the client, it is only taken from the headers set by the trusted proxies
+func clientAddr(c *gin.Context) (netip.Addr, bool) {
+	ip, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		logger.WithField("client_ip", c.ClientIP()).WithError(err).Warn("cannot parse the client ip address")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot detect the IP address of the client"})
+		return netip.Addr{}, false
+	}
+
+	return ip.Unmap(), true
+}
+
+// HandleLookupSelf handles enriching the IP address of the client without creating an agent
+// @Summary Look up the client IP address
+// @Description Gather the statistics and the classification of the IP address of the caller, e.g. for agents behind NAT.
+// @Description Forwarding headers are only used for requests coming from the trusted proxies.
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Param provider query string false "Name of the IP stats provider to use, default is the configured one"
+// @Success 200 {object} LookupIPResponse
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 429 {object} ErrorResponse "Rate limit exceeded"
+// @Failure 503 {object} ErrorResponse "Cannot gather statistics"
+// @Router /agents/self [get]
+func (gh *GinHandler) HandleLookupSelf(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleLookupSelf")
+	defer span.End()
+
+	var queryParams LookupIPQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	ip, ok := clientAddr(c)
+	if !ok {
+		return
+	}
+
+	gh.lookupIP(ctx, c, ip, queryParams.Provider)
+}
+
+// HandleCreateSelfAgent handles creating an agent for the IP address of the client
+// @Summary Create an agent for the client IP address
+// @Description Create a new agent with the IP address of the caller, e.g. for agents behind NAT.
+// @Description Forwarding headers are only used for requests coming from the trusted proxies.
+// @Tags agents
+// @Accept json
+// @Produce json
+// @Success 201 {object} CreateAgentResponse "Successfully created agent"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "Cannot gather statistics"
+// @Router /agents/self [post]
+func (gh *GinHandler) HandleCreateSelfAgent(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleCreateSelfAgent")
+	defer span.End()
+
+	ip, ok := clientAddr(c)
+	if !ok {
+		return
+	}
+	if !ip.Is4() {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "IP should be in format of IPv4"})
+		return
+	}
+	if iputil.Classify(ip).Bogon {
+		logger.WithField("ip", ip.String()).Debug("cannot create an agent for a bogon ip address")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the IP address of the client is not public"})
+		return
+	}
+
+	gh.createAgent(ctx, c, ip.String())
+}
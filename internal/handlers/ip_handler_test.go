@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/iputil"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleLookupIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	// The lookup should not use the database at all
+	gh := NewGinHandler(config.Config{}, nil, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/ip/:ip", gh.HandleLookupIP)
+
+	tests := []struct {
+		name                   string
+		ip                     string
+		expectedCode           int
+		expectedClassification iputil.Classification
+		expectedStats          bool
+	}{
+		{
+			name:                   "Public IP",
+			ip:                     "8.8.8.8",
+			expectedCode:           http.StatusOK,
+			expectedClassification: iputil.Classification{Version: "ipv4", Scope: iputil.ScopePublic},
+			expectedStats:          true,
+		},
+		{
+			name:                   "Bogon IP",
+			ip:                     "192.168.1.1",
+			expectedCode:           http.StatusOK,
+			expectedClassification: iputil.Classification{Version: "ipv4", Scope: iputil.ScopePrivate, Bogon: true},
+		},
+		{
+			name:         "Invalid IP",
+			ip:           "8.8.8",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/ip/"+tt.ip, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var lookupResponse LookupIPResponse
+			err := json.Unmarshal(w.Body.Bytes(), &lookupResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ip, lookupResponse.IPAddress)
+			assert.Equal(t, tt.expectedClassification, lookupResponse.Classification)
+			assert.Equal(t, tt.expectedStats, lookupResponse.Stats != nil)
+		})
+	}
+}
+
+func TestHandleSelf(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	testDB := getTestDatabase(ctx, t)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	assert.NoError(t, router.SetTrustedProxies(nil))
+	router.GET("/agents/self", gh.HandleLookupSelf)
+	router.POST("/agents/self", gh.HandleCreateSelfAgent)
+
+	tests := []struct {
+		name         string
+		method       string
+		remoteAddr   string
+		expectedCode int
+		expectedIP   string
+	}{
+		{
+			name:         "Look Up",
+			method:       http.MethodGet,
+			remoteAddr:   "8.8.4.4:4321",
+			expectedCode: http.StatusOK,
+			expectedIP:   "8.8.4.4",
+		},
+		{
+			name:         "Create",
+			method:       http.MethodPost,
+			remoteAddr:   "8.8.4.4:4321",
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "Create For Private IP",
+			method:       http.MethodPost,
+			remoteAddr:   "192.168.1.1:4321",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/agents/self", nil)
+			req.RemoteAddr = tt.remoteAddr
+			// Forwarding headers are ignored without trusted proxies
+			req.Header.Set("X-Forwarded-For", "1.1.1.1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedIP != "" {
+				var lookupResponse LookupIPResponse
+				err := json.Unmarshal(w.Body.Bytes(), &lookupResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedIP, lookupResponse.IPAddress)
+			}
+		})
+	}
+}
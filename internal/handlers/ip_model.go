@@ -0,0 +1,17 @@
+package handlers
+
+import "argus/internal/iputil"
+
+// LookupIPQueryParams represents the query parameters for looking up an IP address.
+type LookupIPQueryParams struct {
+	Provider string `form:"provider"`
+}
+
+// LookupIPResponse represents the response format for looking up an IP address.
+type LookupIPResponse struct {
+	Message        string                `json:"message"`
+	IPAddress      string                `json:"ip_address"`
+	Classification iputil.Classification `json:"classification"`
+	// Stats is not gathered for the bogon IP addresses
+	Stats *iputil.Stats `json:"stats,omitempty"`
+}
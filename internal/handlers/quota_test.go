@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/pkg/ratelimit"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	cfg.Quota.RateLimit = 100
+	cfg.Quota.Burst = 100
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.Default()
+	router.POST("/admin/api-keys", gh.HandleCreateAPIKey)
+	router.PUT("/admin/api-keys/:key_id/limits", gh.HandleUpdateAPIKeyLimits)
+	router.GET("/protected", gh.AuthMiddleware(gh.apiKeys), gh.QuotaMiddleware(), gh.BillingMiddleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	callProtected := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create a key with a daily quota of 2 requests
+	body := `{"name":"limited","limits":{"daily_quota":2}}`
+	req, _ := http.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createResponse CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	assert.Equal(t, int64(2), *createResponse.APIKey.Limits.DailyQuota)
+
+	w = callProtected(createResponse.Secret)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusNoContent, callProtected(createResponse.Secret).Code)
+
+	w = callProtected(createResponse.Secret)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "daily quota exceeded")
+
+	// The rejected request is not billed
+	assert.NoError(t, gh.meter.Flush(ctx))
+	keyID := createResponse.APIKey.ID
+	usage, err := gh.db.GetUsage(ctx, db.UsageFilter{APIKeyID: &keyID, From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, http.StatusNoContent, usage[0].Status)
+		assert.Equal(t, int64(2), usage[0].Requests)
+	}
+
+	// The bootstrap key is not limited
+	assert.Equal(t, http.StatusNoContent, callProtected("bootstrap_key").Code)
+
+	// Invalid limits
+	path := fmt.Sprintf("/admin/api-keys/%d/limits", createResponse.APIKey.ID)
+	for _, body := range []string{`{"daily_quota":-1}`, `{"rate_limit":"fast"}`} {
+		req, _ = http.NewRequest(http.MethodPut, path, bytes.NewBufferString(body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, "/admin/api-keys/999999/limits", bytes.NewBufferString(`{}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Removing the quota takes effect immediately
+	req, _ = http.NewRequest(http.MethodPut, path, bytes.NewBufferString(`{"daily_quota":null}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updateResponse APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updateResponse))
+	assert.Nil(t, updateResponse.APIKey.Limits.DailyQuota)
+	assert.Equal(t, http.StatusNoContent, callProtected(createResponse.Secret).Code)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gh GinHandler
+	router := gin.New()
+	router.Use(gh.RateLimitMiddleware(ratelimit.NewTokenBucket(0.5, 1), (*gin.Context).ClientIP))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var response ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "rate limit exceeded", response.Error)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequireScope(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.Default()
+	router.Use(gh.AuthMiddleware(gh.apiKeys), gh.BillingMiddleware())
+	admin := router.Group("/admin", gh.RequireScope(auth.ScopeAdmin))
+	admin.POST("/api-keys", gh.HandleCreateAPIKey)
+	admin.PUT("/api-keys/:key_id/scopes", gh.HandleUpdateAPIKeyScopes)
+	router.GET("/agents", gh.RequireScope(auth.ScopeAgentsRead), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.DELETE("/agents", gh.RequireScope(auth.ScopeAgentsDelete), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	call := func(method string, path string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Keys are created with the default scopes
+	w := call(http.MethodPost, "/admin/api-keys", "bootstrap_key", `{"name":"reader"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createResponse CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	assert.Equal(t, auth.DefaultScopes, createResponse.APIKey.Scopes)
+	reader := createResponse.Secret
+
+	w = call(http.MethodPost, "/admin/api-keys", "bootstrap_key", `{"name":"unknown","scopes":["agents:read","root"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			name:         "Granted Scope",
+			method:       http.MethodGet,
+			path:         "/agents",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:          "Missing Scope",
+			method:        http.MethodDelete,
+			path:          "/agents",
+			expectedCode:  http.StatusForbidden,
+			expectedError: "missing scope agents:delete",
+		},
+		{
+			name:          "Missing Admin Scope",
+			method:        http.MethodPost,
+			path:          "/admin/api-keys",
+			expectedCode:  http.StatusForbidden,
+			expectedError: "missing scope admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(tt.method, tt.path, reader, `{"name":"escalated"}`)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedError != "" {
+				var errorResponse ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResponse))
+				assert.Equal(t, tt.expectedError, errorResponse.Error)
+			}
+		})
+	}
+
+	// The new scopes are effective immediately, admin grants every scope
+	path := fmt.Sprintf("/admin/api-keys/%d/scopes", createResponse.APIKey.ID)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, path, "bootstrap_key", `{"scopes":[]}`).Code)
+	w = call(http.MethodPut, path, "bootstrap_key", `{"scopes":["admin","admin"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updateResponse APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updateResponse))
+	assert.Equal(t, []string{auth.ScopeAdmin}, updateResponse.APIKey.Scopes)
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, "/agents", reader, "").Code)
+
+	// The admin scope is not granted to the keys of the tenants, as the admin APIs are not restricted to a tenant
+	tenantID := fmt.Sprintf("scopes-%d", time.Now().UnixNano())
+	_, err = gh.db.CreateTenant(ctx, &db.Tenant{ID: tenantID, Name: "Scopes"})
+	assert.NoError(t, err)
+	w = call(http.MethodPost, "/admin/api-keys", "bootstrap_key", fmt.Sprintf(`{"name":"tenant admin","tenant_id":%q,"scopes":["admin"]}`, tenantID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(http.MethodPost, "/admin/api-keys", "bootstrap_key", fmt.Sprintf(`{"name":"tenant reader","tenant_id":%q}`, tenantID))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	path = fmt.Sprintf("/admin/api-keys/%d/scopes", createResponse.APIKey.ID)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, path, "bootstrap_key", `{"scopes":["admin"]}`).Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPut, "/admin/api-keys/0/scopes", "bootstrap_key", `{"scopes":["admin"]}`).Code)
+}
+
+func TestAuthMiddleware_BearerToken(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	// Create a JWKS with a generated key
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"kid": "test",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	assert.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	authenticator, err := auth.NewJWTAuthenticator(ctx, auth.JWTOptions{
+		JWKSFile:        jwksFile,
+		RefreshInterval: time.Hour,
+		Issuer:          "issuer",
+		Audience:        "argus",
+		ScopesClaim:     "scope",
+		TenantClaim:     "tenant",
+	})
+	assert.NoError(t, err)
+
+	router := gin.Default()
+	router.Use(gh.AuthMiddleware(authenticator, gh.apiKeys), gh.BillingMiddleware())
+	router.GET("/agents", gh.RequireScope(auth.ScopeAgentsRead), func(c *gin.Context) {
+		c.String(http.StatusOK, principalFromContext(c).Tenant)
+	})
+
+	sign := func(audience string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"iss":    "issuer",
+			"aud":    audience,
+			"sub":    "inventory",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"scope":  "agents:read",
+			"tenant": "acme",
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedCode   int
+		expectedTenant string
+	}{
+		{
+			name:           "Bearer Token",
+			headers:        map[string]string{"Authorization": "Bearer " + sign("argus")},
+			expectedCode:   http.StatusOK,
+			expectedTenant: "acme",
+		},
+		{
+			name:         "Invalid Bearer Token",
+			headers:      map[string]string{"Authorization": "Bearer " + sign("other"), "API-Key": "bootstrap_key"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "API Key",
+			headers:      map[string]string{"API-Key": "bootstrap_key"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Other Authorization Scheme",
+			headers:      map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.expectedTenant, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_ClientCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, nil, argusIpClient)
+
+	router := gin.Default()
+	router.Use(gh.AuthMiddleware(gh.apiKeys, auth.ClientCertAuthenticator{Scopes: []string{auth.ScopeAgentsRead}}), gh.BillingMiddleware())
+	router.GET("/agents", gh.RequireScope(auth.ScopeAgentsRead), func(c *gin.Context) {
+		c.String(http.StatusOK, principalFromContext(c).Subject)
+	})
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "inventory", Organization: []string{"Acme"}}},
+	}}}
+
+	tests := []struct {
+		name            string
+		tls             *tls.ConnectionState
+		apiKey          string
+		expectedCode    int
+		expectedSubject string
+	}{
+		{
+			name:            "Verified Client Certificate",
+			tls:             verified,
+			expectedCode:    http.StatusOK,
+			expectedSubject: "cert:CN=inventory,O=Acme",
+		},
+		{
+			name:            "API Key Over Client Certificate",
+			tls:             verified,
+			apiKey:          "bootstrap_key",
+			expectedCode:    http.StatusOK,
+			expectedSubject: "api_key:bootstrap",
+		},
+		{
+			name:         "Without Client Certificate",
+			tls:          &tls.ConnectionState{},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Plain HTTP",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/agents", nil)
+			req.TLS = tt.tls
+			if tt.apiKey != "" {
+				req.Header.Set("API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.expectedSubject, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/iputil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignatureMiddleware(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	cfg.Signature.MaxSkewInSecs = 300
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.Default()
+	router.POST("/admin/api-keys", gh.HandleCreateAPIKey)
+	router.PUT("/admin/api-keys/:key_id/signing", gh.HandleUpdateAPIKeySigning)
+	router.POST("/agents", gh.AuthMiddleware(gh.apiKeys), gh.SignatureMiddleware(), gh.BillingMiddleware(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+
+	// Create a key which does not require signing
+	req, _ := http.NewRequest(http.MethodPost, "/admin/api-keys", bytes.NewBufferString(`{"name":"agent"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createResponse CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+	assert.NotEmpty(t, createResponse.SigningSecret)
+	assert.True(t, createResponse.APIKey.CanSign)
+	assert.False(t, createResponse.APIKey.RequireSignature)
+
+	body := `{"ip_address":"8.8.8.8"}`
+	call := func(secret string, nonce string, sentBody string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/agents?async=true", bytes.NewBufferString(sentBody))
+		req.Header.Set("API-Key", createResponse.Secret)
+		if secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(auth.TimestampHeader, timestamp)
+			req.Header.Set(auth.NonceHeader, nonce)
+			req.Header.Set(auth.SignatureHeader, auth.SignRequest(secret, http.MethodPost, "/agents?async=true", timestamp, nonce, []byte(body)))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Legacy clients keep working until the key requires signing
+	assert.Equal(t, http.StatusOK, call("", "", body).Code)
+	w = call(createResponse.SigningSecret, "first", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, w.Body.String(), "the handlers should still read the body")
+	assert.Equal(t, http.StatusUnauthorized, call(createResponse.SigningSecret, "first", body).Code, "replays should be rejected")
+	assert.Equal(t, http.StatusUnauthorized, call(createResponse.SigningSecret, "second", `{"ip_address":"1.1.1.1"}`).Code)
+
+	// Require signing and rotate the signing secret
+	path := fmt.Sprintf("/admin/api-keys/%d/signing", createResponse.APIKey.ID)
+	req, _ = http.NewRequest(http.MethodPut, path, bytes.NewBufferString(`{"require_signature":true,"rotate_secret":true}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updateResponse UpdateAPIKeySigningResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updateResponse))
+	assert.NotEmpty(t, updateResponse.SigningSecret)
+	assert.NotEqual(t, createResponse.SigningSecret, updateResponse.SigningSecret)
+	assert.True(t, updateResponse.APIKey.RequireSignature)
+
+	assert.Equal(t, http.StatusUnauthorized, call("", "", body).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(createResponse.SigningSecret, "third", body).Code)
+	assert.Equal(t, http.StatusOK, call(updateResponse.SigningSecret, "third", body).Code)
+
+	// The secret is kept if it is not rotated
+	req, _ = http.NewRequest(http.MethodPut, path, bytes.NewBufferString(`{"require_signature":false}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "signing_secret")
+	assert.Equal(t, http.StatusOK, call(updateResponse.SigningSecret, "fourth", body).Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/admin/api-keys/999999/signing", bytes.NewBufferString(`{}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
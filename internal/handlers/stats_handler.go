@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AgentStatsDefaultBuckets is the number of time buckets when the start of the time range is not given
+	AgentStatsDefaultBuckets = 30
+	// AgentStatsMaxBuckets is the maximum number of time buckets in the time range
+	AgentStatsMaxBuckets = 1000
+	// AgentStatsMaxRows is the maximum number of buckets returned, counting every group in every time bucket
+	AgentStatsMaxRows = 10000
+)
+
+const (
+	StatsFormatJSON    = "json"
+	StatsFormatGrafana = "grafana"
+)
+
+var (
+	ValidAgentStatsGroups = []string{"country", "asn", "isp", "city"} // ValidAgentStatsGroups defines valid fields for grouping the stats.
+	// AgentStatsIntervals defines valid time buckets of the stats and their durations.
+	AgentStatsIntervals = map[string]time.Duration{
+		"hour": time.Hour,
+		"day":  24 * time.Hour,
+		"week": 7 * 24 * time.Hour,
+	}
+)
+
+// parseStatsTime parses a time in Unix milliseconds, RFC 3339 or YYYY-MM-DD format
+func parseStatsTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+
+	return parseQueryTime(value)
+}
+
+// HandleGetAgentStats handles counting agents grouped by fields and time buckets
+// @Summary Get statistics of agents
+// @Description Count the agents matching the filters, grouped by fields and bucketed by their creation time
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param group_by query []string false "Fields to group the agents by (country, asn, isp, city)" collectionFormat(csv)
+// @Param interval query string false "Time buckets of the creation time (hour, day, week)"
+// @Param from query string false "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to 30 buckets before the end"
+// @Param to query string false "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to now"
+// @Param format query string false "Format of the response (json, grafana), the grafana format requires an interval"
+// @Param ip_address query string false "Filter agents by IP address"
+// @Param country query []string false "Filter agents by country codes" collectionFormat(csv)
+// @Param city query []string false "Filter agents by cities" collectionFormat(csv)
+// @Param region query []string false "Filter agents by regions" collectionFormat(csv)
+// @Param asn query []string false "Filter agents by ASNs (e.g., 'AS3320')" collectionFormat(csv)
+// @Param isp query string false "Filter agents by ISP containing this value"
+// @Param created_after query string false "Filter agents created at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Filter agents created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param q query string false "Filter agents by a query (see README)"
+// @Param include_deleted query bool false "Include the deleted agents"
+// @Success 200 {object} GetAgentStatsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /stats/agents [get]
+func (gh *GinHandler) HandleGetAgentStats(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetAgentStats")
+	defer span.End()
+
+	// Handle query params
+	var queryParams AgentStatsQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+	agentsFilter, err := queryParams.toFilter()
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	groupBy := splitQueryValues(queryParams.GroupBy, nil)
+	for _, field := range groupBy {
+		if !slices.Contains(ValidAgentStatsGroups, field) {
+			logger.WithField("group_by", field).Debug("cannot parse the group by parameter")
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "the valid group by fields are: " + strings.Join(ValidAgentStatsGroups, ", "),
+			})
+			return
+		}
+	}
+	var interval time.Duration
+	if queryParams.Interval != "" {
+		var ok bool
+		interval, ok = AgentStatsIntervals[queryParams.Interval]
+		if !ok {
+			logger.WithField("interval", queryParams.Interval).Debug("cannot parse the interval parameter")
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the valid intervals are: hour, day, week"})
+			return
+		}
+	}
+	if queryParams.Format == "" {
+		queryParams.Format = StatsFormatJSON
+	}
+	if queryParams.Format != StatsFormatJSON && queryParams.Format != StatsFormatGrafana {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the valid formats are: json, grafana"})
+		return
+	}
+	if queryParams.Format == StatsFormatGrafana && interval == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the grafana format requires an interval"})
+		return
+	}
+
+	// Resolve the time range
+	var from, to *time.Time
+	for _, param := range []struct {
+		name  string
+		value string
+		time  **time.Time
+	}{
+		{name: "from", value: queryParams.From, time: &from},
+		{name: "to", value: queryParams.To, time: &to},
+	} {
+		if param.value == "" {
+			continue
+		}
+		t, err := parseStatsTime(param.value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: param.name + ": " + err.Error()})
+			return
+		}
+		*param.time = &t
+	}
+	if interval != 0 {
+		if to == nil {
+			now := time.Now().UTC()
+			to = &now
+		}
+		if from == nil {
+			start := to.Add(-AgentStatsDefaultBuckets * interval)
+			from = &start
+		}
+	}
+	if from != nil && to != nil {
+		if !from.Before(*to) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from should be before to"})
+			return
+		}
+		if interval != 0 && to.Sub(*from)/interval >= AgentStatsMaxBuckets {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "the time range has more than " + strconv.Itoa(AgentStatsMaxBuckets) + " buckets, use a bigger interval",
+			})
+			return
+		}
+	}
+	// The time range narrows the creation time filter
+	if from != nil && (agentsFilter.CreatedAfter == nil || from.After(*agentsFilter.CreatedAfter)) {
+		agentsFilter.CreatedAfter = from
+	}
+	if to != nil && (agentsFilter.CreatedBefore == nil || to.Before(*agentsFilter.CreatedBefore)) {
+		agentsFilter.CreatedBefore = to
+	}
+
+	// Retrieve the stats from database, one more row is fetched to know whether they are truncated
+	rows, err := gh.db.GetAgentStats(ctx, agentsFilter, groupBy, queryParams.Interval, AgentStatsMaxRows+1)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve the agent stats from the database")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the agent stats from the database"})
+		return
+	}
+	truncated := len(rows) > AgentStatsMaxRows
+	if truncated {
+		rows = rows[:AgentStatsMaxRows]
+	}
+
+	if queryParams.Format == StatsFormatGrafana {
+		c.JSON(http.StatusOK, newGrafanaTimeSeries(rows, truncated))
+		return
+	}
+
+	data := AgentStatsData{
+		GroupBy:   groupBy,
+		Interval:  queryParams.Interval,
+		From:      from,
+		To:        to,
+		Buckets:   []AgentStatsBucket{},
+		Truncated: truncated,
+	}
+	for _, row := range rows {
+		bucket := AgentStatsBucket{Time: row.Bucket, Count: row.Count}
+		if len(groupBy) > 0 {
+			bucket.Group = make(map[string]string, len(groupBy))
+			for i, field := range groupBy {
+				bucket.Group[field] = row.Group[i]
+			}
+		}
+		data.Buckets = append(data.Buckets, bucket)
+	}
+
+	c.JSON(http.StatusOK, GetAgentStatsResponse{
+		Message: "agent stats have been retrieved successfully",
+		Data:    data,
+	})
+}
+
+// newGrafanaTimeSeries converts the stats to a time series per group, ordered by their first appearance.
+// The stats should be bucketed by time, every series is flagged if they are truncated.
+func newGrafanaTimeSeries(rows []db.AgentStatsRow, truncated bool) []GrafanaTimeSeries {
+	series := []GrafanaTimeSeries{}
+	indexes := map[string]int{}
+	for _, row := range rows {
+		target := strings.Join(row.Group, ", ")
+		if target == "" {
+			target = "agents"
+		}
+		i, ok := indexes[target]
+		if !ok {
+			i = len(series)
+			indexes[target] = i
+			series = append(series, GrafanaTimeSeries{Target: target, Datapoints: [][2]int64{}, Truncated: truncated})
+		}
+		series[i].Datapoints = append(series[i].Datapoints, [2]int64{row.Count, row.Bucket.UnixMilli()})
+	}
+
+	return series
+}
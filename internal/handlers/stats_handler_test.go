@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleGetAgentStats(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	// Create a test data
+	testDB := getTestDatabase(ctx, t)
+	for _, a := range []*db.Agent{
+		{IPAddress: "8.8.4.1", Region: "Stats Region", Country: "US"},
+		{IPAddress: "8.8.4.2", Region: "Stats Region", Country: "US"},
+		{IPAddress: "8.8.4.3", Region: "Stats Region", Country: "DE"},
+	} {
+		_, err := testDB.CreateNewAgent(ctx, a)
+		assert.NoError(t, err)
+	}
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	assert.NotNil(t, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, testDB, argusIpClient)
+
+	router := gin.Default()
+	router.GET("/stats/agents", gh.HandleGetAgentStats)
+
+	// Request the stats grouped by country
+	req, _ := http.NewRequest(http.MethodGet, "/stats/agents?region=Stats+Region&group_by=country", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var statsResponse GetAgentStatsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &statsResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, []AgentStatsBucket{
+		{Group: map[string]string{"country": "US"}, Count: 2},
+		{Group: map[string]string{"country": "DE"}, Count: 1},
+	}, statsResponse.Data.Buckets)
+
+	// The groups can be repeated too
+	req, _ = http.NewRequest(http.MethodGet, "/stats/agents?region=Stats+Region&group_by=country&group_by=city", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	statsResponse = GetAgentStatsResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &statsResponse))
+	assert.Equal(t, []string{"country", "city"}, statsResponse.Data.GroupBy)
+	assert.Equal(t, []AgentStatsBucket{
+		{Group: map[string]string{"country": "US", "city": ""}, Count: 2},
+		{Group: map[string]string{"country": "DE", "city": ""}, Count: 1},
+	}, statsResponse.Data.Buckets)
+
+	// Request the stats as a Grafana time series
+	to := time.Now().Add(time.Hour)
+	req, _ = http.NewRequest(http.MethodGet, "/stats/agents?region=Stats+Region&interval=hour&format=grafana&to="+
+		to.Format(time.RFC3339), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var series []GrafanaTimeSeries
+	err = json.Unmarshal(w.Body.Bytes(), &series)
+	assert.NoError(t, err)
+	if assert.Len(t, series, 1) {
+		assert.Equal(t, "agents", series[0].Target)
+		assert.False(t, series[0].Truncated)
+		var total int64
+		for _, datapoint := range series[0].Datapoints {
+			total += datapoint[0]
+		}
+		assert.Equal(t, int64(3), total)
+	}
+
+	// Request too many buckets
+	req, _ = http.NewRequest(http.MethodGet, "/stats/agents?interval=hour&from=2020-01-01", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Request an invalid group
+	req, _ = http.NewRequest(http.MethodGet, "/stats/agents?group_by=ip_address", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestNewGrafanaTimeSeries_Truncated(t *testing.T) {
+	bucket := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []db.AgentStatsRow{
+		{Bucket: &bucket, Group: []string{"US"}, Count: 2},
+		{Bucket: &bucket, Group: []string{"DE"}, Count: 1},
+	}
+
+	series := newGrafanaTimeSeries(rows, true)
+	assert.Len(t, series, 2)
+	for _, s := range series {
+		assert.True(t, s.Truncated, s.Target)
+	}
+	assert.False(t, newGrafanaTimeSeries(rows, false)[0].Truncated)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import "time"
+
+// AgentStatsQueryParams represents the query parameters for the statistics of agents.
+type AgentStatsQueryParams struct {
+	AgentsFilterQueryParams
+
+	// GroupBy are the fields to group the agents by, repeated or comma-separated
+	GroupBy []string `form:"group_by"`
+	// Interval is the size of the time buckets of the creation time (hour, day or week)
+	Interval string `form:"interval"`
+	// From and To limit the time range, they accept Unix milliseconds as well, e.g. ${__from} in Grafana
+	From string `form:"from"`
+	To   string `form:"to"`
+	// Format is the format of the response (json or grafana)
+	Format string `form:"format"`
+}
+
+// AgentStatsBucket represents the number of agents in a time bucket and group.
+type AgentStatsBucket struct {
+	Time  *time.Time        `json:"time,omitempty"`
+	Group map[string]string `json:"group,omitempty"`
+	Count int64             `json:"count"`
+}
+
+// AgentStatsData represents the statistics of agents.
+type AgentStatsData struct {
+	GroupBy  []string           `json:"group_by,omitempty"`
+	Interval string             `json:"interval,omitempty"`
+	From     *time.Time         `json:"from,omitempty"`
+	To       *time.Time         `json:"to,omitempty"`
+	Buckets  []AgentStatsBucket `json:"buckets"`
+	// Truncated reports whether there were more buckets than the maximum number of them
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GetAgentStatsResponse represents the response format for the statistics of agents.
+type GetAgentStatsResponse struct {
+	Message string         `json:"message"`
+	Data    AgentStatsData `json:"data"`
+}
+
+// GrafanaTimeSeries represents a time series in the format of Grafana JSON datasources.
+// Each data point is a pair of the value and the time in Unix milliseconds.
+type GrafanaTimeSeries struct {
+	Target     string     `json:"target"`
+	Datapoints [][2]int64 `json:"datapoints"`
+	// Truncated reports whether there were more buckets than the maximum number of them
+	Truncated bool `json:"truncated,omitempty"`
+}
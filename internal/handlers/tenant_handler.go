@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"net/http"
+)
+
+// isKnownProvider reports whether the enrichment provider of the settings is registered, no provider is the default
+func (gh *GinHandler) isKnownProvider(settings TenantSettings) bool {
+	if settings.EnrichmentProvider == nil {
+		return true
+	}
+	selector, ok := gh.ipStatsGatherer.(iputil.ProviderSelector)
+	if !ok {
+		return false
+	}
+	_, err := selector.Provider(*settings.EnrichmentProvider)
+	return err == nil
+}
+
+// HandleCreateTenant handles requests to create a new tenant
+// @Summary Create a tenant
+// @Description Create a new tenant, its clients only see the agents of the tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body CreateTenantRequest true "Request body for creating a tenant"
+// @Success 201 {object} TenantResponse "Successfully created tenant"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 409 {object} ErrorResponse "Tenant already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tenants [post]
+func (gh *GinHandler) HandleCreateTenant(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleCreateTenant")
+	defer span.End()
+
+	var createRequest CreateTenantRequest
+	if err := c.ShouldBindJSON(&createRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse create tenant request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := createRequest.validate(); err != nil {
+		logger.WithError(err).Debug("cannot validate create tenant request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !gh.isKnownProvider(createRequest.Settings) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown enrichment provider"})
+		return
+	}
+
+	tenant, err := gh.db.CreateTenant(ctx, &db.Tenant{
+		ID:       createRequest.ID,
+		Name:     createRequest.Name,
+		Settings: createRequest.Settings.toDB(),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrTenantExists) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "tenant already exists"})
+			return
+		}
+		logger.WithError(err).Warn("cannot create tenant")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot create tenant"})
+		return
+	}
+	// The tenant may be cached as unknown
+	gh.tenants.Invalidate(tenant.ID)
+
+	setAuditResourceID(c, tenant.ID)
+	c.JSON(http.StatusCreated, TenantResponse{
+		Message: "tenant has been created successfully",
+		Tenant:  newTenant(tenant),
+	})
+}
+
+// HandleGetTenants handles requests to list the tenants
+// @Summary List tenants
+// @Description List the tenants with their settings
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} GetTenantsResponse "Successfully retrieved tenants"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tenants [get]
+func (gh *GinHandler) HandleGetTenants(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetTenants")
+	defer span.End()
+
+	tenants, err := gh.db.GetTenants(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve tenants")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve tenants"})
+		return
+	}
+
+	response := make([]Tenant, len(tenants))
+	for i := range tenants {
+		response[i] = newTenant(&tenants[i])
+	}
+
+	c.JSON(http.StatusOK, GetTenantsResponse{
+		Message: "tenants have been retrieved successfully",
+		Tenants: response,
+	})
+}
+
+// HandleGetTenant handles requests to get a tenant
+// @Summary Get a tenant
+// @Description Get a tenant with its settings
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "ID of the tenant"
+// @Success 200 {object} TenantResponse "Successfully retrieved tenant"
+// @Failure 404 {object} ErrorResponse "Tenant not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tenants/{tenant_id} [get]
+func (gh *GinHandler) HandleGetTenant(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetTenant")
+	defer span.End()
+
+	tenant, err := gh.db.GetTenant(ctx, c.Param("tenant_id"))
+	if err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such tenant by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot retrieve tenant")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve tenant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TenantResponse{
+		Message: "tenant has been retrieved successfully",
+		Tenant:  newTenant(tenant),
+	})
+}
+
+// HandleUpdateTenant handles requests to change a tenant
+// @Summary Update a tenant
+// @Description Replace the name and the settings of a tenant, null settings are the defaults
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "ID of the tenant"
+// @Param request body UpdateTenantRequest true "Name and settings of the tenant"
+// @Success 200 {object} TenantResponse "Successfully updated tenant"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Tenant not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tenants/{tenant_id} [put]
+func (gh *GinHandler) HandleUpdateTenant(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleUpdateTenant")
+	defer span.End()
+
+	var updateRequest UpdateTenantRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		logger.WithError(err).Debug("cannot parse update tenant request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot parse request body"})
+		return
+	}
+	if err := updateRequest.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !gh.isKnownProvider(updateRequest.Settings) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown enrichment provider"})
+		return
+	}
+
+	tenant, err := gh.db.UpdateTenant(ctx, c.Param("tenant_id"), updateRequest.Name, updateRequest.Settings.toDB())
+	if err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such tenant by id"})
+			return
+		}
+		logger.WithError(err).Warn("cannot update tenant")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot update tenant"})
+		return
+	}
+	// The settings are cached with the tenant
+	gh.tenants.Invalidate(tenant.ID)
+
+	c.JSON(http.StatusOK, TenantResponse{
+		Message: "tenant has been updated successfully",
+		Tenant:  newTenant(tenant),
+	})
+}
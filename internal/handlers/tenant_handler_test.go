@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/iputil"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTenantHandlers(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	providers := iputil.NewProviders(iputil.ProviderIPInfo, argusIpClient)
+
+	gh := NewGinHandler(config.Config{}, getTestDatabase(ctx, t), providers)
+
+	router := gin.Default()
+	router.POST("/admin/tenants", gh.HandleCreateTenant)
+	router.GET("/admin/tenants", gh.HandleGetTenants)
+	router.GET("/admin/tenants/:tenant_id", gh.HandleGetTenant)
+	router.PUT("/admin/tenants/:tenant_id", gh.HandleUpdateTenant)
+
+	call := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Invalid requests
+	id := fmt.Sprintf("team-%d", time.Now().UnixNano())
+	for _, body := range []string{
+		`{"name":"Team"}`,
+		`{"id":"Team A","name":"Team"}`,
+		`{"id":"team"}`,
+		`{"id":"team","name":"Team","settings":{"retention_days":-1}}`,
+		`{"id":"team","name":"Team","settings":{"enrichment_provider":"unknown"}}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/tenants", body).Code, body)
+	}
+
+	// Create a tenant with its settings
+	w := call(http.MethodPost, "/admin/tenants", fmt.Sprintf(`{"id":%q,"name":"Team","settings":{"enrichment_provider":"ipinfo","retention_days":7}}`, id))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response TenantResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, id, response.Tenant.ID)
+	assert.Equal(t, "ipinfo", *response.Tenant.Settings.EnrichmentProvider)
+	assert.Equal(t, 7, *response.Tenant.Settings.RetentionDays)
+
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/admin/tenants", fmt.Sprintf(`{"id":%q,"name":"Other"}`, id)).Code)
+
+	// Reset the settings to the defaults
+	w = call(http.MethodPut, "/admin/tenants/"+id, `{"name":"Team A","settings":{}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Team A", response.Tenant.Name)
+	assert.Nil(t, response.Tenant.Settings.EnrichmentProvider)
+	assert.Nil(t, response.Tenant.Settings.RetentionDays)
+
+	w = call(http.MethodGet, "/admin/tenants/"+id, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Team A", response.Tenant.Name)
+
+	w = call(http.MethodGet, "/admin/tenants", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listResponse GetTenantsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResponse))
+	assert.GreaterOrEqual(t, len(listResponse.Tenants), 2)
+
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/admin/tenants/unknown", "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPut, "/admin/tenants/unknown", `{"name":"Unknown"}`).Code)
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.APIKey = "bootstrap_key"
+	gh := NewGinHandler(cfg, getTestDatabase(ctx, t), argusIpClient)
+
+	router := gin.Default()
+	// The queries made with the gin context are restricted to the tenant of the request context
+	router.ContextWithFallback = true
+	router.Use(gh.AuthMiddleware(gh.apiKeys), gh.TenantMiddleware())
+	router.POST("/admin/tenants", gh.HandleCreateTenant)
+	router.POST("/admin/api-keys", gh.HandleCreateAPIKey)
+	router.POST("/agents", gh.HandleCreateAgent)
+	router.GET("/agents", gh.HandleGetAgents)
+	router.GET("/agents/:agent_id", gh.HandleGetAgentDetail)
+	router.DELETE("/agents/:agent_id", gh.HandleDeleteAgent)
+
+	call := func(method string, path string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(auth.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create two tenants with a key for each one
+	suffix := time.Now().UnixNano()
+	keys := map[string]string{}
+	for _, name := range []string{"acme", "globex"} {
+		id := fmt.Sprintf("%s-%d", name, suffix)
+		w := call(http.MethodPost, "/admin/tenants", "bootstrap_key", fmt.Sprintf(`{"id":%q,"name":%q}`, id, name))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w = call(http.MethodPost, "/admin/api-keys", "bootstrap_key", fmt.Sprintf(`{"name":%q,"tenant_id":%q,"scopes":["admin"]}`, name, id))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var createResponse CreateAPIKeyResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+		assert.Equal(t, id, createResponse.APIKey.TenantID)
+		keys[name] = createResponse.Secret
+	}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/api-keys", "bootstrap_key", `{"name":"unknown","tenant_id":"unknown"}`).Code)
+
+	// Both tenants create an agent of the same IP address
+	agentIDs := map[string]uint{}
+	for name, key := range keys {
+		w := call(http.MethodPost, "/agents", key, `{"ip_address":"8.8.8.8"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var createResponse CreateAgentResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResponse))
+		agentIDs[name] = createResponse.Agent.ID
+	}
+
+	// The agents of a tenant are not visible to the other one
+	path := fmt.Sprintf("/agents/%d", agentIDs["globex"])
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, path, keys["globex"], "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, path, keys["acme"], "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, path, keys["acme"], "").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, path, keys["globex"], "").Code)
+
+	w := call(http.MethodGet, "/agents", keys["acme"], "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listResponse GetAgentsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResponse))
+	assert.Len(t, listResponse.Data.Agents, 1)
+	assert.Equal(t, agentIDs["acme"], listResponse.Data.Agents[0].ID)
+
+	// The agents of the tenants are not visible to the clients of the default tenant
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, path, "bootstrap_key", "").Code)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"regexp"
+	"time"
+)
+
+// tenantIDPattern is the format of the tenant ids, they are used in the bearer tokens and the URLs
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant represents a team sharing the deployment, its agents are not visible to the other tenants.
+type Tenant struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Settings  TenantSettings `json:"settings"`
+}
+
+// TenantSettings represents the configuration overrides of a tenant, null means the default.
+type TenantSettings struct {
+	// EnrichmentProvider gathers the stats of the IP addresses of the tenant when no provider is asked for
+	EnrichmentProvider *string `json:"enrichment_provider"`
+	// RetentionDays is the number of days the deleted agents are kept before being purged, zero keeps them forever
+	RetentionDays *int `json:"retention_days"`
+}
+
+func (s TenantSettings) validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.EnrichmentProvider, validation.NilOrNotEmpty),
+		validation.Field(&s.RetentionDays, validation.Min(0)),
+	)
+}
+
+// toDB converts the settings to their database model
+func (s TenantSettings) toDB() db.TenantSettings {
+	return db.TenantSettings{
+		EnrichmentProvider: s.EnrichmentProvider,
+		RetentionDays:      s.RetentionDays,
+	}
+}
+
+// newTenant converts the database model of a tenant to its response model
+func newTenant(t *db.Tenant) Tenant {
+	return Tenant{
+		ID:        t.ID,
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+		Settings: TenantSettings{
+			EnrichmentProvider: t.Settings.EnrichmentProvider,
+			RetentionDays:      t.Settings.RetentionDays,
+		},
+	}
+}
+
+// CreateTenantRequest represents the request format for creating a tenant.
+type CreateTenantRequest struct {
+	// ID identifies the tenant in the bearer tokens and the API keys, e.g. acme
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Settings TenantSettings `json:"settings"`
+}
+
+func (req CreateTenantRequest) validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.ID,
+			validation.Required.Error("id cannot be empty"),
+			validation.Match(tenantIDPattern).Error("id should only have lowercase letters, digits and dashes"),
+		),
+		validation.Field(&req.Name,
+			validation.Required.Error("name cannot be empty"),
+			validation.Length(1, 100),
+		),
+		validation.Field(&req.Settings, validation.By(func(any) error {
+			return req.Settings.validate()
+		})),
+	)
+}
+
+// UpdateTenantRequest represents the request format for replacing the name and the settings of a tenant.
+type UpdateTenantRequest struct {
+	Name     string         `json:"name"`
+	Settings TenantSettings `json:"settings"`
+}
+
+func (req UpdateTenantRequest) validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Name,
+			validation.Required.Error("name cannot be empty"),
+			validation.Length(1, 100),
+		),
+		validation.Field(&req.Settings, validation.By(func(any) error {
+			return req.Settings.validate()
+		})),
+	)
+}
+
+// TenantResponse represents the response format for a tenant.
+type TenantResponse struct {
+	Message string `json:"message"`
+	Tenant  Tenant `json:"tenant"`
+}
+
+// GetTenantsResponse represents the response format for listing the tenants.
+type GetTenantsResponse struct {
+	Message string   `json:"message"`
+	Tenants []Tenant `json:"tenants"`
+}
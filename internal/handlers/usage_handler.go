@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	tracing "argus/pkg/otel"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// usageInvoiceHeader is the header of the usage invoices
+var usageInvoiceHeader = []string{"month", "api_key_id", "prefix", "name", "owner", "endpoint", "requests", "upstream_lookups"}
+
+// resolveUsageKey returns the ID of the API key having the prefix, nil means all keys.
+// In case of an unknown key, it writes the error response and returns false.
+func (gh *GinHandler) resolveUsageKey(c *gin.Context, prefix string) (*uint, bool) {
+	if prefix == "" {
+		return nil, true
+	}
+
+	apiKey, err := gh.db.GetAPIKeyByPrefix(c, prefix)
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "cannot find such api key by prefix"})
+			return nil, false
+		}
+		logger.WithError(err).Warn("cannot retrieve api key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve api key"})
+		return nil, false
+	}
+
+	return &apiKey.ID, true
+}
+
+// HandleGetUsage handles requests to summarize the usage of the API keys
+// @Summary Get the usage of API keys
+// @Description Summarize the requests and the upstream lookups of the API keys by endpoint and response status
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key query string false "Prefix of the API key, all keys by default"
+// @Param from query string false "Start of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to the start of the month"
+// @Param to query string false "End of the time range (Unix milliseconds, RFC 3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} UsageResponse
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/usage [get]
+func (gh *GinHandler) HandleGetUsage(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetUsage")
+	defer span.End()
+
+	// Handle query params
+	var queryParams UsageQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+
+	// The usage is in hourly buckets, so the time range is rounded to the hours
+	now := time.Now().UTC()
+	filter := db.UsageFilter{
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		To:   now,
+	}
+	var err error
+	if queryParams.From != "" {
+		if filter.From, err = parseStatsTime(queryParams.From); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from: " + err.Error()})
+			return
+		}
+	}
+	if queryParams.To != "" {
+		if filter.To, err = parseStatsTime(queryParams.To); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to: " + err.Error()})
+			return
+		}
+	}
+	if !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from should be before to"})
+		return
+	}
+
+	var ok bool
+	if filter.APIKeyID, ok = gh.resolveUsageKey(c, queryParams.Key); !ok {
+		return
+	}
+
+	rows, err := gh.db.GetUsage(ctx, filter)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve the usage")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{
+		Message: "usage has been retrieved successfully",
+		From:    filter.From,
+		To:      filter.To,
+		Keys:    newKeyUsages(rows),
+	})
+}
+
+// HandleGetUsageInvoice handles exporting the usage of a month as an invoice
+// @Summary Get the usage invoice of a month
+// @Description Export the requests and the upstream lookups of the API keys in a month by endpoint, with a total row for each key
+// @Tags admin
+// @Produce text/csv
+// @Param key query string false "Prefix of the API key, all keys by default"
+// @Param month query string false "Month of the invoice (YYYY-MM), defaults to the current month"
+// @Success 200 {file} file "CSV file of the usage"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/usage/invoice [get]
+func (gh *GinHandler) HandleGetUsageInvoice(c *gin.Context) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(c, "HandleGetUsageInvoice")
+	defer span.End()
+
+	// Handle query params
+	var queryParams UsageInvoiceQueryParams
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		logger.WithError(err).Debug("cannot bind query params")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "bad query params"})
+		return
+	}
+
+	month := time.Now().UTC()
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if queryParams.Month != "" {
+		var err error
+		if month, err = time.Parse("2006-01", queryParams.Month); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "month should be in format of YYYY-MM"})
+			return
+		}
+	}
+	filter := db.UsageFilter{From: month, To: month.AddDate(0, 1, 0)}
+
+	var ok bool
+	if filter.APIKeyID, ok = gh.resolveUsageKey(c, queryParams.Key); !ok {
+		return
+	}
+
+	rows, err := gh.db.GetUsage(ctx, filter)
+	if err != nil {
+		logger.WithError(err).Warn("cannot retrieve the usage")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "cannot retrieve the usage"})
+		return
+	}
+
+	monthName := month.Format("2006-01")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s.csv"`, monthName))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(usageInvoiceHeader)
+	for _, key := range newKeyUsages(rows) {
+		record := func(endpoint string, requests int64, upstreamLookups int64) []string {
+			return []string{
+				monthName,
+				strconv.FormatUint(uint64(key.APIKeyID), 10),
+				key.Prefix,
+				key.Name,
+				key.Owner,
+				endpoint,
+				strconv.FormatInt(requests, 10),
+				strconv.FormatInt(upstreamLookups, 10),
+			}
+		}
+
+		// The statuses are not billed separately
+		var endpoints []EndpointUsage
+		for _, e := range key.Endpoints {
+			if n := len(endpoints); n > 0 && endpoints[n-1].Endpoint == e.Endpoint {
+				endpoints[n-1].Requests += e.Requests
+				endpoints[n-1].UpstreamLookups += e.UpstreamLookups
+				continue
+			}
+			endpoints = append(endpoints, e)
+		}
+		for _, e := range endpoints {
+			_ = w.Write(record(e.Endpoint, e.Requests, e.UpstreamLookups))
+		}
+		_ = w.Write(record("total", key.Requests, key.UpstreamLookups))
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		logger.WithError(err).Warn("cannot write the usage invoice")
+	}
+}
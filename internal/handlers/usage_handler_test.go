@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandleGetUsage(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	tdb := getTestDatabase(ctx, t)
+	gh := NewGinHandler(config.Config{}, tdb, argusIpClient)
+
+	secret, prefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	apiKey, err := tdb.CreateAPIKey(ctx, &db.APIKey{Prefix: prefix, Hash: auth.HashAPIKey(secret), Name: "metered", Owner: "billing"})
+	assert.NoError(t, err)
+
+	router := gin.Default()
+	router.ContextWithFallback = true
+	router.POST("/agents", gh.AuthMiddleware(gh.apiKeys), gh.BillingMiddleware(), gh.HandleCreateAgent)
+	router.GET("/admin/usage", gh.HandleGetUsage)
+	router.GET("/admin/usage/invoice", gh.HandleGetUsageInvoice)
+
+	// One created agent with an upstream lookup, and one bad request
+	for _, body := range []string{`{"ip_address":"8.8.8.8"}`, `{"ip_address":"8.8"}`} {
+		req, _ := http.NewRequest(http.MethodPost, "/agents", bytes.NewBufferString(body))
+		req.Header.Set("API-Key", secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+	assert.NoError(t, gh.meter.Flush(ctx))
+
+	testData := struct {
+		expectedKey KeyUsage
+	}{
+		expectedKey: KeyUsage{
+			APIKeyID:        apiKey.ID,
+			Prefix:          prefix,
+			Name:            "metered",
+			Owner:           "billing",
+			Requests:        2,
+			UpstreamLookups: 1,
+			Endpoints: []EndpointUsage{
+				{Endpoint: "POST /agents", Status: http.StatusCreated, Requests: 1, UpstreamLookups: 1},
+				{Endpoint: "POST /agents", Status: http.StatusBadRequest, Requests: 1},
+			},
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/usage?key="+prefix, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var usageResponse UsageResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &usageResponse))
+	assert.Equal(t, []KeyUsage{testData.expectedKey}, usageResponse.Keys)
+
+	// The invoice has a row for each endpoint and a total
+	req, _ = http.NewRequest(http.MethodGet, "/admin/usage/invoice?key="+prefix, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	month := time.Now().UTC().Format("2006-01")
+	assert.Equal(t, [][]string{
+		usageInvoiceHeader,
+		{month, strconv.FormatUint(uint64(apiKey.ID), 10), prefix, "metered", "billing", "POST /agents", "2", "1"},
+		{month, strconv.FormatUint(uint64(apiKey.ID), 10), prefix, "metered", "billing", "total", "2", "1"},
+	}, records)
+
+	// Invalid params
+	for _, query := range []string{"key=ffffffff", "from=yesterday", "from=2026-02-01&to=2026-01-01"} {
+		req, _ = http.NewRequest(http.MethodGet, "/admin/usage?"+query, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.NotEqual(t, http.StatusOK, w.Code, query)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"argus/internal/auth"
+	"argus/internal/db"
+	"time"
+)
+
+// UsageQueryParams represents the query parameters for retrieving the usage.
+type UsageQueryParams struct {
+	// Key is the prefix of an API key
+	Key  string `form:"key"`
+	From string `form:"from"`
+	To   string `form:"to"`
+}
+
+// UsageInvoiceQueryParams represents the query parameters for the monthly usage invoice.
+type UsageInvoiceQueryParams struct {
+	// Key is the prefix of an API key
+	Key string `form:"key"`
+	// Month is in format of YYYY-MM
+	Month string `form:"month"`
+}
+
+// EndpointUsage represents the usage of an endpoint with a response status, status is 0 for background work.
+type EndpointUsage struct {
+	Endpoint        string `json:"endpoint"`
+	Status          int    `json:"status"`
+	Requests        int64  `json:"requests"`
+	UpstreamLookups int64  `json:"upstream_lookups"`
+}
+
+// KeyUsage represents the usage of an API key, the bootstrap key has the ID of 0.
+type KeyUsage struct {
+	APIKeyID        uint            `json:"api_key_id"`
+	Prefix          string          `json:"prefix,omitempty"`
+	Name            string          `json:"name"`
+	Owner           string          `json:"owner,omitempty"`
+	Requests        int64           `json:"requests"`
+	UpstreamLookups int64           `json:"upstream_lookups"`
+	Endpoints       []EndpointUsage `json:"endpoints"`
+}
+
+// newKeyUsages groups the usage rows, which are ordered by the key, by the key
+func newKeyUsages(rows []db.UsageRow) []KeyUsage {
+	keys := make([]KeyUsage, 0)
+	for _, row := range rows {
+		if len(keys) == 0 || keys[len(keys)-1].APIKeyID != row.APIKeyID {
+			name := row.Name
+			if row.APIKeyID == 0 {
+				name = auth.BootstrapAPIKey.Name
+			}
+			keys = append(keys, KeyUsage{APIKeyID: row.APIKeyID, Prefix: row.Prefix, Name: name, Owner: row.Owner})
+		}
+
+		key := &keys[len(keys)-1]
+		key.Requests += row.Requests
+		key.UpstreamLookups += row.UpstreamLookups
+		key.Endpoints = append(key.Endpoints, EndpointUsage{
+			Endpoint:        row.Endpoint,
+			Status:          row.Status,
+			Requests:        row.Requests,
+			UpstreamLookups: row.UpstreamLookups,
+		})
+	}
+
+	return keys
+}
+
+// UsageResponse represents the response format for retrieving the usage in the time range [from, to).
+type UsageResponse struct {
+	Message string     `json:"message"`
+	From    time.Time  `json:"from"`
+	To      time.Time  `json:"to"`
+	Keys    []KeyUsage `json:"keys"`
+}
@@ -0,0 +1,249 @@
+// Package importer imports agents in bulk from CSV and NDJSON files.
+//
+// The files are read line by line, and every batch of lines is validated, enriched with bounded concurrency
+// and inserted before reading the next one, so big files are not kept in memory.
+package importer
+
+import (
+	"argus/internal/db"
+	"argus/internal/iputil"
+	tracing "argus/pkg/otel"
+	"context"
+	"errors"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.opentelemetry.io/otel"
+	"io"
+	"sync"
+	"time"
+)
+
+// Statuses of the imported lines
+const (
+	StatusCreated = "created"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// LineResult is the result of importing a line of the file
+type LineResult struct {
+	Line      int
+	IPAddress string
+	Status    string
+	AgentID   uint
+	// Reason explains why the line is skipped or failed
+	Reason string
+}
+
+// Report is the result of an import
+type Report struct {
+	Created int
+	Skipped int
+	Failed  int
+	Lines   []LineResult
+}
+
+func (r *Report) add(result LineResult) {
+	switch result.Status {
+	case StatusCreated:
+		r.Created++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Lines = append(r.Lines, result)
+}
+
+// CreatedIDs returns the IDs of the created agents, in the order of their lines
+func (r *Report) CreatedIDs() []uint {
+	var ids []uint
+	for _, line := range r.Lines {
+		if line.Status == StatusCreated {
+			ids = append(ids, line.AgentID)
+		}
+	}
+	return ids
+}
+
+// Options configures the importer
+type Options struct {
+	// Concurrency is the maximum number of IP addresses enriched at the same time
+	Concurrency int
+	// BatchSize is the number of lines processed and inserted together
+	BatchSize int
+	// Timeout is the maximum duration of gathering stats about an IP address
+	Timeout time.Duration
+}
+
+type Importer struct {
+	db              db.DB
+	ipStatsGatherer iputil.IPStatsGatherer
+	opts            Options
+}
+
+func New(db db.DB, ipStatsGatherer iputil.IPStatsGatherer, opts Options) *Importer {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	return &Importer{db: db, ipStatsGatherer: ipStatsGatherer, opts: opts}
+}
+
+// Import creates the agents of the IP addresses in the file, progress (if not nil) is called with the number of
+// processed lines after each batch. IP addresses which already have an agent, or are repeated in the file, are
+// skipped. The lines which cannot be parsed fail, if the file cannot be read any further a ReadError is returned and
+// the report contains the lines read before it.
+func (im *Importer) Import(ctx context.Context, r io.Reader, format string, progress func(processed int)) (*Report, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "Import")
+	defer span.End()
+
+	report := &Report{Lines: []LineResult{}}
+	reader, err := newRecordReader(r, format)
+	if err != nil {
+		return report, err
+	}
+
+	seen := map[string]bool{}
+	batch := make([]record, 0, im.opts.BatchSize)
+	for {
+		// The records read before the end of the file, or a line which cannot be read, are imported
+		rec, err := reader.next()
+		if err == nil {
+			batch = append(batch, rec)
+		}
+		if len(batch) == im.opts.BatchSize || (err != nil && len(batch) > 0) {
+			if batchErr := im.importBatch(ctx, batch, seen, report); batchErr != nil {
+				return report, batchErr
+			}
+			batch = batch[:0]
+			if progress != nil {
+				progress(len(report.Lines))
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+}
+
+// importBatch validates, enriches and inserts a batch of records, and adds their results to the report
+func (im *Importer) importBatch(ctx context.Context, batch []record, seen map[string]bool, report *Report) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Validate the records
+	results := make([]LineResult, len(batch))
+	var candidates []int
+	var ipAddresses []string
+	for i, rec := range batch {
+		results[i] = LineResult{Line: rec.line, IPAddress: rec.ipAddress}
+		switch {
+		case rec.err != nil:
+			results[i].Status, results[i].Reason = StatusFailed, rec.err.Error()
+		case rec.ipAddress == "":
+			results[i].Status, results[i].Reason = StatusFailed, "IP address cannot be empty"
+		case is.IPv4.Validate(rec.ipAddress) != nil:
+			results[i].Status, results[i].Reason = StatusFailed, "IP should be in format of IPv4"
+		case seen[rec.ipAddress]:
+			results[i].Status, results[i].Reason = StatusSkipped, "IP address is repeated in the file"
+		default:
+			seen[rec.ipAddress] = true
+			candidates = append(candidates, i)
+			ipAddresses = append(ipAddresses, rec.ipAddress)
+		}
+	}
+
+	// Skip the existing agents
+	existing, err := im.db.FindExistingIPAddresses(ctx, ipAddresses)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, ip := range existing {
+		exists[ip] = true
+	}
+	var toEnrich []int
+	for _, i := range candidates {
+		if exists[results[i].IPAddress] {
+			results[i].Status, results[i].Reason = StatusSkipped, "agent already exists"
+			continue
+		}
+		toEnrich = append(toEnrich, i)
+	}
+
+	// Enrich the IP addresses with bounded concurrency
+	agents := make([]*db.Agent, len(batch))
+	semaphore := make(chan struct{}, im.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, i := range toEnrich {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			gatherCtx, cancel := context.WithTimeout(ctx, im.opts.Timeout)
+			defer cancel()
+			stats, err := im.ipStatsGatherer.GetInfo(gatherCtx, results[i].IPAddress)
+			if err != nil {
+				results[i].Status, results[i].Reason = StatusFailed, "cannot gather statistics for this IP address"
+				if errors.Is(err, context.DeadlineExceeded) {
+					results[i].Reason = "timeout exceeded"
+				}
+				return
+			}
+			agents[i] = &db.Agent{
+				IPAddress: results[i].IPAddress,
+				ASN:       stats.ASN,
+				ISP:       stats.ISP,
+				City:      stats.City,
+				Region:    stats.Region,
+				Country:   stats.Country,
+				Location:  stats.Location,
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Insert the enriched agents, one by one if the batch fails so that only the lines of the failing agents fail
+	var enriched []*db.Agent
+	for _, a := range agents {
+		if a != nil {
+			enriched = append(enriched, a)
+		}
+	}
+	if len(enriched) > 0 {
+		if err = im.db.CreateAgents(ctx, enriched, len(enriched)); err != nil {
+			for i, a := range agents {
+				if a == nil {
+					continue
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				a.ID = 0
+				if _, err = im.db.CreateNewAgent(ctx, a); err != nil {
+					results[i].Status, results[i].Reason = StatusFailed, "cannot create agent"
+					agents[i] = nil
+				}
+			}
+		}
+	}
+	for i, a := range agents {
+		if a != nil {
+			results[i].Status, results[i].AgentID = StatusCreated, a.ID
+		}
+	}
+
+	for _, result := range results {
+		report.add(result)
+	}
+
+	return nil
+}
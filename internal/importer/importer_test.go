@@ -0,0 +1,231 @@
+package importer
+
+import (
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// fakeDB stores the created agents in memory, the other methods of db.DB are not implemented.
+// The agent of failingIP cannot be inserted, and neither can the batches containing it.
+type fakeDB struct {
+	db.DB
+	agents    []*db.Agent
+	failingIP string
+}
+
+func (f *fakeDB) FindExistingIPAddresses(ctx context.Context, ipAddresses []string) ([]string, error) {
+	var existing []string
+	for _, a := range f.agents {
+		if slices.Contains(ipAddresses, a.IPAddress) {
+			existing = append(existing, a.IPAddress)
+		}
+	}
+	return existing, nil
+}
+
+func (f *fakeDB) CreateAgents(ctx context.Context, agents []*db.Agent, batchSize int) error {
+	for _, a := range agents {
+		if a.IPAddress == f.failingIP {
+			return errors.New("cannot insert the batch")
+		}
+	}
+	for _, a := range agents {
+		a.ID = uint(len(f.agents) + 1)
+		f.agents = append(f.agents, a)
+	}
+	return nil
+}
+
+func (f *fakeDB) CreateNewAgent(ctx context.Context, a *db.Agent) (*db.Agent, error) {
+	if a.IPAddress == f.failingIP {
+		return nil, errors.New("cannot insert the agent")
+	}
+	a.ID = uint(len(f.agents) + 1)
+	f.agents = append(f.agents, a)
+	return a, nil
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		format          string
+		body            string
+		expectedLines   []LineResult
+		expectedCreated int
+	}{
+		{
+			name:   "CSV With Header",
+			format: FormatCSV,
+			body:   "name,ip_address\nfirst,8.8.8.8\nsecond,8.8.4.4\nrepeated,8.8.8.8\n\nexisting,1.1.1.1\ninvalid,8.8.8\nshort\n",
+			expectedLines: []LineResult{
+				{Line: 2, IPAddress: "8.8.8.8", Status: StatusCreated, AgentID: 2},
+				{Line: 3, IPAddress: "8.8.4.4", Status: StatusCreated, AgentID: 3},
+				{Line: 4, IPAddress: "8.8.8.8", Status: StatusSkipped, Reason: "IP address is repeated in the file"},
+				{Line: 6, IPAddress: "1.1.1.1", Status: StatusSkipped, Reason: "agent already exists"},
+				{Line: 7, IPAddress: "8.8.8", Status: StatusFailed, Reason: "IP should be in format of IPv4"},
+				{Line: 8, Status: StatusFailed, Reason: "the line has no ip_address column"},
+			},
+			expectedCreated: 2,
+		},
+		{
+			name:   "CSV Without Header",
+			format: FormatCSV,
+			body:   "8.8.8.8\n8.8.4.4",
+			expectedLines: []LineResult{
+				{Line: 1, IPAddress: "8.8.8.8", Status: StatusCreated, AgentID: 2},
+				{Line: 2, IPAddress: "8.8.4.4", Status: StatusCreated, AgentID: 3},
+			},
+			expectedCreated: 2,
+		},
+		{
+			name:   "NDJSON",
+			format: FormatNDJSON,
+			body:   "{\"ip_address\": \"8.8.8.8\"}\n\n{\"ip_address\": \"1.1.1.1\"}\nnot json\n{}\n",
+			expectedLines: []LineResult{
+				{Line: 1, IPAddress: "8.8.8.8", Status: StatusCreated, AgentID: 2},
+				{Line: 3, IPAddress: "1.1.1.1", Status: StatusSkipped, Reason: "agent already exists"},
+				{Line: 4, Status: StatusFailed, Reason: "the line is not a valid JSON object"},
+				{Line: 5, Status: StatusFailed, Reason: "IP address cannot be empty"},
+			},
+			expectedCreated: 1,
+		},
+		{
+			name:   "NDJSON Too Long Line",
+			format: FormatNDJSON,
+			body: "{\"ip_address\": \"8.8.8.8\"}\r\n{\"ip_address\": \"" + strings.Repeat("8", MaxLineLength) + "\"}\r\n" +
+				"{\"ip_address\": \"8.8.4.4\"}",
+			expectedLines: []LineResult{
+				{Line: 1, IPAddress: "8.8.8.8", Status: StatusCreated, AgentID: 2},
+				{Line: 2, Status: StatusFailed, Reason: fmt.Sprintf("the line is longer than %d bytes", MaxLineLength)},
+				{Line: 3, IPAddress: "8.8.4.4", Status: StatusCreated, AgentID: 3},
+			},
+			expectedCreated: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB := &fakeDB{agents: []*db.Agent{{ID: 1, IPAddress: "1.1.1.1"}}}
+			argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+			assert.NoError(t, err)
+
+			// Use small batches to import over several batches
+			im := New(testDB, argusIpClient, Options{Concurrency: 2, BatchSize: 2, Timeout: time.Second})
+			var progress []int
+			report, err := im.Import(ctx, strings.NewReader(tt.body), tt.format, func(processed int) {
+				progress = append(progress, processed)
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLines, report.Lines)
+			assert.Equal(t, tt.expectedCreated, report.Created)
+			assert.Equal(t, len(tt.expectedLines), report.Created+report.Skipped+report.Failed)
+			assert.Equal(t, len(tt.expectedLines), progress[len(progress)-1])
+			assert.Equal(t, "AS15169", testDB.agents[len(testDB.agents)-1].ASN)
+		})
+	}
+}
+
+func TestImport_EnrichmentFailure(t *testing.T) {
+	ctx := context.Background()
+
+	testDB := &fakeDB{}
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClientWithError{})
+	assert.NoError(t, err)
+
+	im := New(testDB, argusIpClient, Options{Concurrency: 2, BatchSize: 10, Timeout: time.Second})
+	report, err := im.Import(ctx, strings.NewReader("8.8.8.8\n8.8.4.4\n"), FormatCSV, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, "cannot gather statistics for this IP address", report.Lines[0].Reason)
+	assert.Empty(t, testDB.agents)
+
+	// Unknown formats are rejected
+	_, err = im.Import(ctx, strings.NewReader(""), "xml", nil)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestImport_ReadError(t *testing.T) {
+	ctx := context.Background()
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+	im := New(&fakeDB{}, argusIpClient, Options{Concurrency: 2, BatchSize: 2, Timeout: time.Second})
+
+	// The lines read before the error are reported, with the line which cannot be read
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		body := io.MultiReader(strings.NewReader("{\"ip_address\": \"8.8.8.8\"}\n"), iotest.ErrReader(errors.New("read failed")))
+		report, err := im.Import(ctx, body, format, nil)
+		var readErr *ReadError
+		if assert.ErrorAs(t, err, &readErr, format) {
+			assert.Equal(t, 2, readErr.Line, format)
+		}
+		assert.Len(t, report.Lines, 1, format)
+	}
+}
+
+func TestImport_CreateFailure(t *testing.T) {
+	ctx := context.Background()
+
+	testDB := &fakeDB{failingIP: "8.8.4.4"}
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	// Only the line of the agent which cannot be inserted fails, the next batches are still imported
+	im := New(testDB, argusIpClient, Options{Concurrency: 2, BatchSize: 3, Timeout: time.Second})
+	report, err := im.Import(ctx, strings.NewReader("8.8.8.8\n8.8.4.4\n1.1.1.1\n1.0.0.1\n"), FormatCSV, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []LineResult{
+		{Line: 1, IPAddress: "8.8.8.8", Status: StatusCreated, AgentID: 1},
+		{Line: 2, IPAddress: "8.8.4.4", Status: StatusFailed, Reason: "cannot create agent"},
+		{Line: 3, IPAddress: "1.1.1.1", Status: StatusCreated, AgentID: 2},
+		{Line: 4, IPAddress: "1.0.0.1", Status: StatusCreated, AgentID: 3},
+	}, report.Lines)
+	assert.Equal(t, 3, report.Created)
+	assert.Equal(t, 1, report.Failed)
+}
+
+func TestJobs(t *testing.T) {
+	jobs := NewJobs(time.Hour)
+
+	// The job should not be canceled with the request starting it
+	ctx, cancel := context.WithCancel(db.WithTenant(context.Background(), "acme"))
+	finish := make(chan struct{})
+	var jobID string
+	job := jobs.Start(ctx, func(ctx context.Context, progress func(processed int)) (*Report, error) {
+		jobID = JobIDFromContext(ctx)
+		progress(1)
+		<-finish
+		return &Report{Created: 1, Lines: []LineResult{{Line: 1, Status: StatusCreated}}}, ctx.Err()
+	})
+	assert.Equal(t, JobRunning, job.Status)
+	assert.Equal(t, "acme", job.TenantID)
+	cancel()
+
+	// Wait for the job to finish
+	close(finish)
+	assert.Eventually(t, func() bool {
+		job, ok := jobs.Get(job.ID)
+		return ok && job.Status == JobSucceeded
+	}, time.Second, 10*time.Millisecond)
+
+	job, _ = jobs.Get(job.ID)
+	assert.Equal(t, job.ID, jobID)
+	assert.Equal(t, 1, job.Processed)
+	assert.Equal(t, 1, job.Report.Created)
+	assert.NotNil(t, job.FinishedAt)
+
+	_, ok := jobs.Get("unknown")
+	assert.False(t, ok)
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"argus/internal/db"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Statuses of the import jobs
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is an import running in the background
+type Job struct {
+	ID string
+	// TenantID is the tenant of the imported agents, the job is only visible to the clients of the tenant
+	TenantID   string
+	Status     string
+	Processed  int
+	Report     *Report
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// jobIDKey is the key of the ID of the job in the context of its import
+type jobIDKey struct{}
+
+// JobIDFromContext returns the ID of the job running the import of ctx, it is empty if the import is not a job
+func JobIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey{}).(string)
+	return id
+}
+
+// Jobs is an in-memory store of the import jobs, finished jobs are removed after the retention. The jobs are only
+// known by the instance running them and are lost when it stops.
+type Jobs struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	retention time.Duration
+}
+
+func NewJobs(retention time.Duration) *Jobs {
+	return &Jobs{jobs: map[string]*Job{}, retention: retention}
+}
+
+// Start runs the import in the background and returns the created job of the tenant of ctx, the import has the
+// values of ctx and the ID of the job but it is not canceled with ctx. The import should report its progress using the given function.
+func (js *Jobs) Start(ctx context.Context, run func(ctx context.Context, progress func(processed int)) (*Report, error)) Job {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	job := &Job{
+		ID:        hex.EncodeToString(id),
+		TenantID:  db.TenantFromContext(ctx),
+		Status:    JobRunning,
+		CreatedAt: time.Now(),
+	}
+
+	js.mu.Lock()
+	js.removeExpired()
+	js.jobs[job.ID] = job
+	snapshot := *job
+	js.mu.Unlock()
+
+	go func() {
+		report, err := run(context.WithValue(context.WithoutCancel(ctx), jobIDKey{}, job.ID), func(processed int) {
+			js.mu.Lock()
+			job.Processed = processed
+			js.mu.Unlock()
+		})
+
+		js.mu.Lock()
+		defer js.mu.Unlock()
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Report = report
+		job.Status = JobSucceeded
+		if err != nil {
+			job.Status, job.Error = JobFailed, err.Error()
+		}
+		if report != nil {
+			job.Processed = len(report.Lines)
+		}
+	}()
+
+	return snapshot
+}
+
+// Get returns a snapshot of the job
+func (js *Jobs) Get(id string) (Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	job, ok := js.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+// removeExpired removes the jobs finished before the retention, the lock should be held
+func (js *Jobs) removeExpired() {
+	for id, job := range js.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > js.retention {
+			delete(js.jobs, id)
+		}
+	}
+}
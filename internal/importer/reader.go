@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// MaxLineLength is the maximum length of a line of NDJSON files
+const MaxLineLength = 64 * 1024
+
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// ReadError is returned when the imported file cannot be read any further, from the line
+type ReadError struct {
+	Line int
+	Err  error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("cannot read line %d: %v", e.Line, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// record is an IP address read from a line of the imported file.
+// err is set if the line cannot be parsed, the other lines can still be read.
+type record struct {
+	line      int
+	ipAddress string
+	err       error
+}
+
+// recordReader reads the records of an imported file one by one
+type recordReader interface {
+	// next returns the next record, or io.EOF at the end of the file
+	next() (record, error)
+}
+
+// newRecordReader creates a reader of the records in the format
+func newRecordReader(r io.Reader, format string) (recordReader, error) {
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		reader.LazyQuotes = true
+		reader.ReuseRecord = true
+		return &csvReader{reader: reader}, nil
+	case FormatNDJSON:
+		return &ndjsonReader{reader: bufio.NewReader(r)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// csvReader reads the IP addresses from the ip_address column of a CSV file.
+// If the first row is not a header containing ip_address, the first column is used and the row is a record.
+type csvReader struct {
+	reader     *csv.Reader
+	readHeader bool
+	column     int
+	line       int
+}
+
+func (cr *csvReader) next() (record, error) {
+	for {
+		row, err := cr.reader.Read()
+		// The reader continues after the lines which cannot be parsed
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			cr.readHeader, cr.line = true, parseErr.Line
+			return record{line: parseErr.StartLine, err: errors.New("the line is not valid CSV")}, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return record{}, err
+		}
+		if err != nil {
+			return record{}, &ReadError{Line: cr.line + 1, Err: err}
+		}
+		line, _ := cr.reader.FieldPos(0)
+		cr.line = line
+
+		if !cr.readHeader {
+			cr.readHeader = true
+			isHeader := false
+			for i, field := range row {
+				if strings.EqualFold(strings.TrimSpace(field), "ip_address") {
+					cr.column, isHeader = i, true
+					break
+				}
+			}
+			if isHeader {
+				continue
+			}
+		}
+
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		if cr.column >= len(row) {
+			return record{line: line, err: errors.New("the line has no ip_address column")}, nil
+		}
+
+		return record{line: line, ipAddress: strings.TrimSpace(row[cr.column])}, nil
+	}
+}
+
+// ndjsonReader reads the IP addresses from the ip_address field of the JSON objects, one in each line
+type ndjsonReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (nr *ndjsonReader) next() (record, error) {
+	for {
+		text, tooLong, err := nr.readLine()
+		if errors.Is(err, io.EOF) {
+			return record{}, err
+		}
+		if err != nil {
+			return record{}, &ReadError{Line: nr.line + 1, Err: err}
+		}
+		nr.line++
+		if tooLong {
+			return record{line: nr.line, err: fmt.Errorf("the line is longer than %d bytes", MaxLineLength)}, nil
+		}
+		text = bytes.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+
+		var object struct {
+			IPAddress string `json:"ip_address"`
+		}
+		if err := json.Unmarshal(text, &object); err != nil {
+			return record{line: nr.line, err: errors.New("the line is not a valid JSON object")}, nil
+		}
+
+		return record{line: nr.line, ipAddress: strings.TrimSpace(object.IPAddress)}, nil
+	}
+}
+
+// readLine reads the next line, or returns io.EOF at the end of the file.
+// The lines longer than MaxLineLength are skipped to their end and reported as too long.
+func (nr *ndjsonReader) readLine() ([]byte, bool, error) {
+	var text []byte
+	read, tooLong := false, false
+	for {
+		chunk, err := nr.reader.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		if !tooLong {
+			text = append(text, chunk...)
+			if len(bytes.TrimRight(text, "\r\n")) > MaxLineLength {
+				text, tooLong = nil, true
+			}
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == nil, errors.Is(err, io.EOF) && read:
+			return text, tooLong, nil
+		default:
+			return nil, false, err
+		}
+	}
+}
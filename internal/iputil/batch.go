@@ -0,0 +1,86 @@
+package iputil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the number of IP addresses gathered at the same time by gatherers without batch support
+const DefaultBatchConcurrency = 8
+
+// BatchResult is the result of gathering the stats of an IP address in a batch, either Stats or Err is set
+type BatchResult struct {
+	Stats *Stats
+	Err   error
+}
+
+// BatchIPStatsGatherer is implemented by gatherers which can gather the stats of multiple IP addresses at once
+type BatchIPStatsGatherer interface {
+	IPStatsGatherer
+	// GetInfoBatch gathers the stats of the IP addresses, the results are in the same order as the IP addresses.
+	// The returned error means the whole batch has failed, failures of single IP addresses are in their results.
+	GetInfoBatch(ctx context.Context, ips []string) ([]BatchResult, error)
+	// BatchRounds returns the number of requests made one after the other by GetInfoBatch for n IP addresses
+	BatchRounds(n int) int
+}
+
+// BatchRounds returns the number of requests made one after the other by GetInfoBatch for n IP addresses,
+// e.g. to give the timeout of a request to each of them
+func BatchRounds(gatherer IPStatsGatherer, n int, concurrency int) int {
+	if batchGatherer, ok := gatherer.(BatchIPStatsGatherer); ok {
+		return batchGatherer.BatchRounds(n)
+	}
+	return rounds(n, concurrency)
+}
+
+// rounds returns the number of rounds of at most size items needed for n items
+func rounds(n int, size int) int {
+	size = max(size, 1)
+	return (n + size - 1) / size
+}
+
+// GetInfoBatch gathers the stats of the IP addresses with the batch support of the gatherer if it has any,
+// otherwise it falls back to GetInfoParallel. The error of a failed batch is set for all of its IP addresses.
+func GetInfoBatch(ctx context.Context, gatherer IPStatsGatherer, ips []string, concurrency int) []BatchResult {
+	batchGatherer, ok := gatherer.(BatchIPStatsGatherer)
+	if !ok {
+		return GetInfoParallel(ctx, gatherer, ips, concurrency)
+	}
+
+	results, err := batchGatherer.GetInfoBatch(ctx, ips)
+	if err == nil && len(results) != len(ips) {
+		err = fmt.Errorf("got %d results for %d IP addresses", len(results), len(ips))
+	}
+	if err != nil {
+		results = make([]BatchResult, len(ips))
+		for i := range results {
+			results[i].Err = err
+		}
+	}
+
+	return results
+}
+
+// GetInfoParallel gathers the stats of the IP addresses one by one, with at most concurrency of them at the same time
+func GetInfoParallel(ctx context.Context, gatherer IPStatsGatherer, ips []string, concurrency int) []BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]BatchResult, len(ips))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, ip string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i].Stats, results[i].Err = gatherer.GetInfo(ctx, ip)
+		}(i, ip)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,94 @@
+package iputil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetInfoBatch(t *testing.T) {
+	// Setup, the batch API is chunked by its maximum size
+	ips := make([]string, IPInfoBatchMaxSize+2)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	failedIP := ips[IPInfoBatchMaxSize]
+
+	tests := []struct {
+		name           string
+		client         IPInfoClient
+		expectedFailed []string
+		expectedError  error
+	}{
+		{
+			name: "Batch API",
+			client: &MockIPInfoBatchClient{
+				MockIPInfoClientWithPartialFailure: MockIPInfoClientWithPartialFailure{FailedIPs: []string{failedIP}},
+			},
+			expectedFailed: []string{failedIP},
+			expectedError:  ErrNoBatchResult,
+		},
+		{
+			name:           "Parallel Fallback",
+			client:         &MockIPInfoClientWithPartialFailure{FailedIPs: []string{failedIP}},
+			expectedFailed: []string{failedIP},
+		},
+		{
+			name:           "Failed Batch",
+			client:         &MockIPInfoBatchClientWithError{},
+			expectedFailed: ips,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argusClient, err := NewArgusIPClient(tt.client)
+			assert.NoError(t, err)
+
+			// Execute
+			results := GetInfoBatch(context.Background(), argusClient, ips, DefaultBatchConcurrency)
+
+			// Assert
+			assert.Len(t, results, len(ips))
+			for i, result := range results {
+				if slices.Contains(tt.expectedFailed, ips[i]) {
+					assert.Error(t, result.Err, "IP %s should fail", ips[i])
+					if tt.expectedError != nil {
+						assert.ErrorIs(t, result.Err, tt.expectedError)
+					}
+					continue
+				}
+				assert.NoError(t, result.Err, "IP %s should not fail", ips[i])
+				assert.Equal(t, net.ParseIP(ips[i]), result.Stats.IP, "results should be in the same order")
+			}
+		})
+	}
+
+	// The batches are at most of the maximum size
+	client := &MockIPInfoBatchClient{}
+	argusClient, err := NewArgusIPClient(client)
+	assert.NoError(t, err)
+	GetInfoBatch(context.Background(), argusClient, ips, DefaultBatchConcurrency)
+	if assert.Len(t, client.Batches, 2) {
+		assert.Len(t, client.Batches[0], IPInfoBatchMaxSize)
+		assert.Len(t, client.Batches[1], 2)
+	}
+}
+
+func TestBatchRounds(t *testing.T) {
+	batchClient, err := NewArgusIPClient(&MockIPInfoBatchClient{})
+	assert.NoError(t, err)
+	parallelClient, err := NewArgusIPClient(&MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	// A request per chunk of the batch API, otherwise a round per DefaultBatchConcurrency IP addresses
+	assert.Equal(t, 1, BatchRounds(batchClient, 1, 4))
+	assert.Equal(t, 3, BatchRounds(batchClient, 2*IPInfoBatchMaxSize+1, 4))
+	assert.Equal(t, 2, BatchRounds(parallelClient, DefaultBatchConcurrency+1, 4))
+	assert.Equal(t, 3, BatchRounds(NewProviders(ProviderIPInfo, batchClient), 9, 4), "providers do not support batches")
+	assert.Equal(t, 0, BatchRounds(batchClient, 0, 4))
+}
@@ -0,0 +1,74 @@
+package iputil
+
+import "net/netip"
+
+// Scopes of the IP addresses
+const (
+	ScopePublic        = "public"
+	ScopePrivate       = "private"
+	ScopeLoopback      = "loopback"
+	ScopeLinkLocal     = "link_local"
+	ScopeMulticast     = "multicast"
+	ScopeUnspecified   = "unspecified"
+	ScopeSharedAddress = "shared_address"
+	ScopeDocumentation = "documentation"
+	ScopeReserved      = "reserved"
+)
+
+// Classification describes the kind of an IP address
+type Classification struct {
+	// Version is either ipv4 or ipv6
+	Version string `json:"version"`
+	Scope   string `json:"scope"`
+	// Bogon reports whether the IP address should not appear on the public internet
+	Bogon bool `json:"bogon"`
+}
+
+// specialPrefixes are the special-purpose ranges of the IANA registries which are not covered by the netip methods
+var specialPrefixes = []struct {
+	prefix netip.Prefix
+	scope  string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), ScopeReserved},
+	{netip.MustParsePrefix("100.64.0.0/10"), ScopeSharedAddress},
+	{netip.MustParsePrefix("192.0.0.0/24"), ScopeReserved},
+	{netip.MustParsePrefix("192.0.2.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("198.18.0.0/15"), ScopeReserved},
+	{netip.MustParsePrefix("198.51.100.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("203.0.113.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("240.0.0.0/4"), ScopeReserved},
+	{netip.MustParsePrefix("2001:db8::/32"), ScopeDocumentation},
+	{netip.MustParsePrefix("100::/64"), ScopeReserved},
+}
+
+// Classify classifies the IP address by its version and scope
+func Classify(ip netip.Addr) Classification {
+	ip = ip.Unmap()
+	c := Classification{Version: "ipv6", Scope: ScopePublic}
+	if ip.Is4() {
+		c.Version = "ipv4"
+	}
+
+	switch {
+	case ip.IsUnspecified():
+		c.Scope = ScopeUnspecified
+	case ip.IsLoopback():
+		c.Scope = ScopeLoopback
+	case ip.IsPrivate():
+		c.Scope = ScopePrivate
+	case ip.IsLinkLocalUnicast():
+		c.Scope = ScopeLinkLocal
+	case ip.IsMulticast():
+		c.Scope = ScopeMulticast
+	default:
+		for _, special := range specialPrefixes {
+			if special.prefix.Contains(ip) {
+				c.Scope = special.scope
+				break
+			}
+		}
+	}
+	c.Bogon = c.Scope != ScopePublic
+
+	return c
+}
@@ -0,0 +1,33 @@
+package iputil
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		ip       string
+		expected Classification
+	}{
+		{"8.8.8.8", Classification{Version: "ipv4", Scope: ScopePublic}},
+		{"10.1.2.3", Classification{Version: "ipv4", Scope: ScopePrivate, Bogon: true}},
+		{"127.0.0.1", Classification{Version: "ipv4", Scope: ScopeLoopback, Bogon: true}},
+		{"169.254.1.1", Classification{Version: "ipv4", Scope: ScopeLinkLocal, Bogon: true}},
+		{"100.64.0.1", Classification{Version: "ipv4", Scope: ScopeSharedAddress, Bogon: true}},
+		{"192.0.2.1", Classification{Version: "ipv4", Scope: ScopeDocumentation, Bogon: true}},
+		{"0.0.0.0", Classification{Version: "ipv4", Scope: ScopeUnspecified, Bogon: true}},
+		{"224.0.0.1", Classification{Version: "ipv4", Scope: ScopeMulticast, Bogon: true}},
+		{"::ffff:10.0.0.1", Classification{Version: "ipv4", Scope: ScopePrivate, Bogon: true}},
+		{"2606:4700::1111", Classification{Version: "ipv6", Scope: ScopePublic}},
+		{"fd00::1", Classification{Version: "ipv6", Scope: ScopePrivate, Bogon: true}},
+		{"2001:db8::1", Classification{Version: "ipv6", Scope: ScopeDocumentation, Bogon: true}},
+	}
+
+	for _, tc := range testCases {
+		output := Classify(netip.MustParseAddr(tc.ip))
+		assert.Equal(t, tc.expected, output, "Expected Classify(%s) to be %v", tc.ip, tc.expected)
+	}
+}
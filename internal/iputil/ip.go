@@ -10,7 +10,7 @@ type IPStatsGatherer interface {
 }
 
 type Stats struct {
-	IP          net.IP `json:"ip" csv:"ip"`
+	IP          net.IP `json:"ip" csv:"ip" swaggertype:"string"`
 	City        string `json:"city,omitempty" yaml:"city,omitempty"`
 	Region      string `json:"region,omitempty" yaml:"region,omitempty"`
 	Country     string `json:"country,omitempty" yaml:"country,omitempty"`
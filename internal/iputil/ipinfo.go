@@ -3,6 +3,7 @@ package iputil
 import (
 	tracing "argus/pkg/otel"
 	"context"
+	"errors"
 	"github.com/ipinfo/go/v2/ipinfo"
 	"go.opentelemetry.io/otel"
 	"net"
@@ -12,6 +13,16 @@ type IPInfoClient interface {
 	GetIPInfo(ip net.IP) (*ipinfo.Core, error)
 }
 
+// IPInfoBatchClient is implemented by IPInfo clients supporting the batch API, e.g. *ipinfo.Client
+type IPInfoBatchClient interface {
+	GetIPStrInfoBatch(ips []string, opts ipinfo.BatchReqOpts) (ipinfo.BatchCore, error)
+}
+
+// IPInfoBatchMaxSize is the maximum number of IP addresses in a request to the batch API of IPInfo
+const IPInfoBatchMaxSize = 1000
+
+var ErrNoBatchResult = errors.New("no result for the IP address in the batch")
+
 type ArgusIPInfoClient struct {
 	client IPInfoClient
 }
@@ -29,6 +40,7 @@ func (ipi *ArgusIPInfoClient) GetInfo(ctx context.Context, ip string) (*Stats, e
 		err  error
 	}, 1)
 
+	observeUpstreamLookups(ctx, 1)
 	go func() {
 		info, err := ipi.client.GetIPInfo(net.ParseIP(ip))
 		resultChan <- struct {
@@ -45,17 +57,91 @@ func (ipi *ArgusIPInfoClient) GetInfo(ctx context.Context, ip string) (*Stats, e
 		if result.err != nil {
 			return nil, result.err
 		}
-		return &Stats{
-			IP:          result.info.IP,
-			City:        result.info.City,
-			Region:      result.info.Region,
-			Country:     result.info.Country,
-			CountryName: result.info.CountryName,
-			Location:    result.info.Location,
-			ISP:         result.info.ASN.Name,
-			ASN:         result.info.ASN.ASN,
-		}, nil
+		return newStats(result.info), nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
+
+// BatchRounds returns the number of requests to the batch API of IPInfo for n IP addresses, or the number of rounds of
+// parallel requests if the client does not support the batch API
+func (ipi *ArgusIPInfoClient) BatchRounds(n int) int {
+	if _, ok := ipi.client.(IPInfoBatchClient); ok {
+		return rounds(n, IPInfoBatchMaxSize)
+	}
+	return rounds(n, DefaultBatchConcurrency)
+}
+
+// GetInfoBatch gathers the stats of the IP addresses using the batch API of IPInfo, in chunks of its maximum size.
+// If the client does not support the batch API, the IP addresses are gathered in parallel.
+func (ipi *ArgusIPInfoClient) GetInfoBatch(ctx context.Context, ips []string) ([]BatchResult, error) {
+	ctx, span := otel.Tracer(tracing.TracerName()).Start(ctx, "GetIPInfoBatch")
+	defer span.End()
+
+	batchClient, ok := ipi.client.(IPInfoBatchClient)
+	if !ok {
+		return GetInfoParallel(ctx, ipi, ips, DefaultBatchConcurrency), nil
+	}
+
+	results := make([]BatchResult, len(ips))
+	for start := 0; start < len(ips); start += IPInfoBatchMaxSize {
+		chunk := ips[start:min(start+IPInfoBatchMaxSize, len(ips))]
+
+		resultChan := make(chan struct {
+			info ipinfo.BatchCore
+			err  error
+		}, 1)
+		observeUpstreamLookups(ctx, len(chunk))
+		go func() {
+			info, err := batchClient.GetIPStrInfoBatch(chunk, ipinfo.BatchReqOpts{BatchSize: IPInfoBatchMaxSize})
+			resultChan <- struct {
+				info ipinfo.BatchCore
+				err  error
+			}{
+				info: info,
+				err:  err,
+			}
+		}()
+
+		select {
+		case result := <-resultChan:
+			// The batch API may return the results of some IP addresses along with an error
+			if result.err != nil && len(result.info) == 0 {
+				return nil, result.err
+			}
+			for i, ip := range chunk {
+				info, ok := result.info[ip]
+				switch {
+				case ok && info != nil:
+					results[start+i].Stats = newStats(info)
+				case result.err != nil:
+					results[start+i].Err = result.err
+				default:
+					results[start+i].Err = ErrNoBatchResult
+				}
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return results, nil
+}
+
+// newStats converts the IPInfo data to stats
+func newStats(info *ipinfo.Core) *Stats {
+	stats := &Stats{
+		IP:          info.IP,
+		City:        info.City,
+		Region:      info.Region,
+		Country:     info.Country,
+		CountryName: info.CountryName,
+		Location:    info.Location,
+	}
+	if info.ASN != nil {
+		stats.ISP = info.ASN.Name
+		stats.ASN = info.ASN.ASN
+	}
+
+	return stats
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"github.com/ipinfo/go/v2/ipinfo"
 	"net"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -52,3 +54,64 @@ func (m *MockIPInfoClientWithTimeout) GetIPInfo(ip net.IP) (*ipinfo.Core, error)
 	}
 	return core, nil
 }
+
+// MockIPInfoClientWithPartialFailure is a mock implementation of IPInfoClient that returns error for FailedIPs.
+type MockIPInfoClientWithPartialFailure struct {
+	FailedIPs []string
+}
+
+func (m *MockIPInfoClientWithPartialFailure) GetIPInfo(ip net.IP) (*ipinfo.Core, error) {
+	if slices.Contains(m.FailedIPs, ip.String()) {
+		return nil, errors.New("cannot get ip info")
+	}
+	return mockCore(ip.String()), nil
+}
+
+// MockIPInfoBatchClient is a mock implementation of IPInfoClient and IPInfoBatchClient.
+// The batch API has no result for FailedIPs, and the requested batches are recorded in Batches.
+type MockIPInfoBatchClient struct {
+	MockIPInfoClientWithPartialFailure
+
+	mu      sync.Mutex
+	Batches [][]string
+}
+
+func (m *MockIPInfoBatchClient) GetIPStrInfoBatch(ips []string, opts ipinfo.BatchReqOpts) (ipinfo.BatchCore, error) {
+	m.mu.Lock()
+	m.Batches = append(m.Batches, ips)
+	m.mu.Unlock()
+
+	batch := ipinfo.BatchCore{}
+	for _, ip := range ips {
+		if !slices.Contains(m.FailedIPs, ip) {
+			batch[ip] = mockCore(ip)
+		}
+	}
+	return batch, nil
+}
+
+// MockIPInfoBatchClientWithError is a mock implementation of IPInfoClient and IPInfoBatchClient.
+// The batch API fails as a whole, while the single IP API works.
+type MockIPInfoBatchClientWithError struct {
+	MockIPInfoClient
+}
+
+func (m *MockIPInfoBatchClientWithError) GetIPStrInfoBatch(ips []string, opts ipinfo.BatchReqOpts) (ipinfo.BatchCore, error) {
+	return nil, errors.New("cannot get batch ip info")
+}
+
+// mockCore returns the IPInfo data of the IP address, which is the same as MockIPInfoClient except the IP address
+func mockCore(ip string) *ipinfo.Core {
+	return &ipinfo.Core{
+		IP:          net.ParseIP(ip),
+		City:        "Mountain View",
+		Region:      "CA",
+		Country:     "US",
+		CountryName: "United States",
+		Location:    "37.386,-122.0838",
+		ASN: &ipinfo.CoreASN{
+			ASN:  "AS15169",
+			Name: "Google LLC",
+		},
+	}
+}
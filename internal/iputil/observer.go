@@ -0,0 +1,22 @@
+package iputil
+
+import "context"
+
+// UpstreamObserver is notified of the IP addresses looked up from the upstream providers, e.g. to meter them
+type UpstreamObserver interface {
+	ObserveUpstreamLookups(lookups int)
+}
+
+type upstreamObserverKey struct{}
+
+// WithUpstreamObserver returns a context notifying the observer of the upstream lookups made with it
+func WithUpstreamObserver(ctx context.Context, observer UpstreamObserver) context.Context {
+	return context.WithValue(ctx, upstreamObserverKey{}, observer)
+}
+
+// observeUpstreamLookups notifies the observer of the context, if it has any
+func observeUpstreamLookups(ctx context.Context, lookups int) {
+	if observer, ok := ctx.Value(upstreamObserverKey{}).(UpstreamObserver); ok {
+		observer.ObserveUpstreamLookups(lookups)
+	}
+}
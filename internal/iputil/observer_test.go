@@ -0,0 +1,55 @@
+package iputil
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingObserver counts the upstream lookups
+type countingObserver struct {
+	mu      sync.Mutex
+	lookups int
+}
+
+func (o *countingObserver) ObserveUpstreamLookups(lookups int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lookups += lookups
+}
+
+func TestUpstreamObserver(t *testing.T) {
+	ips := []string{"8.8.8.8", "8.8.4.4", "1.1.1.1"}
+
+	tests := []struct {
+		name   string
+		client IPInfoClient
+	}{
+		{name: "Batch API", client: &MockIPInfoBatchClient{}},
+		{name: "Parallel Fallback", client: &MockIPInfoClient{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argusClient, err := NewArgusIPClient(tt.client)
+			assert.NoError(t, err)
+
+			observer := &countingObserver{}
+			ctx := WithUpstreamObserver(context.Background(), observer)
+
+			_, err = argusClient.GetInfo(ctx, "8.8.8.8")
+			assert.NoError(t, err)
+			GetInfoBatch(ctx, argusClient, ips, DefaultBatchConcurrency)
+
+			assert.Equal(t, 1+len(ips), observer.lookups)
+		})
+	}
+
+	// Lookups without an observer are not counted
+	argusClient, err := NewArgusIPClient(&MockIPInfoClient{})
+	assert.NoError(t, err)
+	_, err = argusClient.GetInfo(context.Background(), "8.8.8.8")
+	assert.NoError(t, err)
+}
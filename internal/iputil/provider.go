@@ -0,0 +1,67 @@
+package iputil
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ProviderIPInfo is the name of the IPInfo provider
+const ProviderIPInfo = "ipinfo"
+
+var ErrUnknownProvider = errors.New("unknown ip stats provider")
+
+// ProviderSelector is implemented by gatherers which can delegate to a specific provider by its name
+type ProviderSelector interface {
+	Provider(name string) (IPStatsGatherer, error)
+}
+
+// Providers keeps multiple named IPStatsGatherer and uses the default one for GetInfo
+type Providers struct {
+	defaultProvider string
+	gatherers       map[string]IPStatsGatherer
+}
+
+// NewProviders creates a new Providers with the given gatherer registered as the default provider
+func NewProviders(defaultProvider string, gatherer IPStatsGatherer) *Providers {
+	return &Providers{
+		defaultProvider: defaultProvider,
+		gatherers: map[string]IPStatsGatherer{
+			defaultProvider: gatherer,
+		},
+	}
+}
+
+// Register adds a new provider, it replaces the provider if the name already exists
+func (p *Providers) Register(name string, gatherer IPStatsGatherer) {
+	p.gatherers[name] = gatherer
+}
+
+// Provider returns the gatherer of the provider, an empty name means the default provider
+func (p *Providers) Provider(name string) (IPStatsGatherer, error) {
+	if name == "" {
+		name = p.defaultProvider
+	}
+	gatherer, ok := p.gatherers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return gatherer, nil
+}
+
+// Names returns the sorted names of the registered providers
+func (p *Providers) Names() []string {
+	names := make([]string, 0, len(p.gatherers))
+	for name := range p.gatherers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetInfo gathers the stats using the default provider
+func (p *Providers) GetInfo(ctx context.Context, ip string) (*Stats, error) {
+	return p.gatherers[p.defaultProvider].GetInfo(ctx, ip)
+}
@@ -0,0 +1,40 @@
+package iputil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviders(t *testing.T) {
+	// Setup
+	argusClient, err := NewArgusIPClient(&MockIPInfoClient{})
+	assert.NoError(t, err)
+	failingClient, err := NewArgusIPClient(&MockIPInfoClientWithError{})
+	assert.NoError(t, err)
+
+	providers := NewProviders(ProviderIPInfo, argusClient)
+	providers.Register("failing", failingClient)
+
+	// The default provider is used for an empty name
+	gatherer, err := providers.Provider("")
+	assert.NoError(t, err)
+	assert.Equal(t, argusClient, gatherer)
+
+	// Named providers are returned
+	gatherer, err = providers.Provider("failing")
+	assert.NoError(t, err)
+	assert.Equal(t, failingClient, gatherer)
+
+	// Unknown providers are rejected
+	_, err = providers.Provider("unknown")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	assert.Equal(t, []string{"failing", ProviderIPInfo}, providers.Names())
+
+	// GetInfo uses the default provider
+	stats, err := providers.GetInfo(context.Background(), "8.8.8.8")
+	assert.NoError(t, err)
+	assert.Equal(t, "Mountain View", stats.City)
+}
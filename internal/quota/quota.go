@@ -0,0 +1,165 @@
+// Package quota enforces the rate limits and the request quotas of the API keys across the instances.
+package quota
+
+import (
+	"argus/internal/db"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Limits of an API key, zero means unlimited
+type Limits struct {
+	// RateLimit is the number of requests per second, Burst is the number of requests allowed at once
+	RateLimit    float64
+	Burst        int
+	DailyQuota   int64
+	MonthlyQuota int64
+}
+
+// Resolve returns the limits of the key, its overrides replace the defaults
+func (l Limits) Resolve(key *db.APIKey) Limits {
+	if key.Limits.RateLimit != nil {
+		l.RateLimit = *key.Limits.RateLimit
+	}
+	if key.Limits.Burst != nil {
+		l.Burst = *key.Limits.Burst
+	}
+	if key.Limits.DailyQuota != nil {
+		l.DailyQuota = *key.Limits.DailyQuota
+	}
+	if key.Limits.MonthlyQuota != nil {
+		l.MonthlyQuota = *key.Limits.MonthlyQuota
+	}
+
+	return l
+}
+
+// Status is the state of one of the limits after a request
+type Status struct {
+	// Limit is the number of requests allowed in Window
+	Limit     int64
+	Window    time.Duration
+	Remaining int64
+	// Reset is the time until the limit allows Limit requests again
+	Reset time.Duration
+}
+
+// Decision is the result of checking the limits of a request
+type Decision struct {
+	Allowed bool
+	// Exceeded is the name of the limit rejecting the request, e.g. daily quota
+	Exceeded string
+	// RetryAfter is the time to wait before the request can be allowed, if it is not allowed
+	RetryAfter time.Duration
+	// Statuses of the limits of the key, in order of the rate limit, daily quota and monthly quota
+	Statuses []Status
+}
+
+// Closest returns the status with the least remaining requests, which should be reported to the client
+func (d Decision) Closest() (Status, bool) {
+	if len(d.Statuses) == 0 {
+		return Status{}, false
+	}
+
+	closest := d.Statuses[0]
+	for _, s := range d.Statuses[1:] {
+		if s.Remaining < closest.Remaining {
+			closest = s
+		}
+	}
+	return closest, true
+}
+
+// Policy describes the limits in the format of the RateLimit-Policy header, e.g. 10;w=1, 1000;w=86400
+func (d Decision) Policy() string {
+	policies := make([]string, len(d.Statuses))
+	for i, s := range d.Statuses {
+		policies[i] = fmt.Sprintf("%d;w=%d", s.Limit, int64(math.Ceil(s.Window.Seconds())))
+	}
+	return strings.Join(policies, ", ")
+}
+
+// Enforcer checks the limits of the API keys, their state is kept in the database to be shared by the instances
+type Enforcer struct {
+	db       db.DB
+	defaults Limits
+	now      func() time.Time
+}
+
+func NewEnforcer(database db.DB, defaults Limits) *Enforcer {
+	return &Enforcer{db: database, defaults: defaults, now: time.Now}
+}
+
+// Check counts a request of the key if it is within the limits of the key. The rate limit is checked first,
+// so the rejected requests do not use the quotas.
+func (e *Enforcer) Check(ctx context.Context, key *db.APIKey) (Decision, error) {
+	limits := e.defaults.Resolve(key)
+	now := e.now().UTC()
+	decision := Decision{Allowed: true}
+
+	if limits.RateLimit > 0 {
+		burst := max(limits.Burst, 1)
+		allowed, tokens, err := e.db.TakeRateLimitToken(ctx, fmt.Sprintf("api_key:%d", key.ID), limits.RateLimit, burst)
+		if err != nil {
+			return Decision{}, err
+		}
+
+		status := Status{
+			Limit:     int64(burst),
+			Window:    time.Duration(float64(burst) / limits.RateLimit * float64(time.Second)),
+			Remaining: max(int64(math.Floor(tokens)), 0),
+			Reset:     time.Duration((float64(burst) - tokens) / limits.RateLimit * float64(time.Second)),
+		}
+		decision.Statuses = append(decision.Statuses, status)
+		if !allowed {
+			decision.Allowed, decision.Exceeded = false, "rate limit"
+			decision.RetryAfter = time.Duration((1 - tokens) / limits.RateLimit * float64(time.Second))
+			return decision, nil
+		}
+	}
+
+	// The quotas are in calendar days and months of UTC
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var quotas []db.Quota
+	var ends []time.Time
+	var names []string
+	if limits.DailyQuota > 0 {
+		quotas = append(quotas, db.Quota{Period: db.QuotaDaily, PeriodStart: day, Limit: limits.DailyQuota})
+		ends = append(ends, day.AddDate(0, 0, 1))
+		names = append(names, "daily quota")
+	}
+	if limits.MonthlyQuota > 0 {
+		quotas = append(quotas, db.Quota{Period: db.QuotaMonthly, PeriodStart: month, Limit: limits.MonthlyQuota})
+		ends = append(ends, month.AddDate(0, 1, 0))
+		names = append(names, "monthly quota")
+	}
+	if len(quotas) == 0 {
+		return decision, nil
+	}
+
+	allowed, err := e.db.ConsumeQuotas(ctx, key.ID, quotas)
+	if err != nil {
+		return Decision{}, err
+	}
+	for i, q := range quotas {
+		status := Status{
+			Limit:     q.Limit,
+			Window:    ends[i].Sub(q.PeriodStart),
+			Remaining: max(q.Limit-q.Count, 0),
+			Reset:     ends[i].Sub(now),
+		}
+		decision.Statuses = append(decision.Statuses, status)
+		// The request is rejected by the first exceeded quota, the quotas after it are not checked
+		if !allowed && q.Count >= q.Limit {
+			decision.Allowed, decision.Exceeded = false, names[i]
+			decision.RetryAfter = status.Reset
+			break
+		}
+	}
+
+	return decision, nil
+}
@@ -0,0 +1,153 @@
+package quota
+
+import (
+	"argus/internal/db"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeDB keeps the buckets and the quota counters in memory, the buckets are not refilled.
+// The other methods of db.DB are not implemented.
+type fakeDB struct {
+	db.DB
+	buckets map[string]float64
+	counts  map[string]int64
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{buckets: map[string]float64{}, counts: map[string]int64{}}
+}
+
+func (f *fakeDB) TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	tokens, ok := f.buckets[key]
+	if !ok {
+		tokens = float64(burst)
+	}
+	if tokens < 1 {
+		return false, tokens, nil
+	}
+	f.buckets[key] = tokens - 1
+	return true, tokens - 1, nil
+}
+
+func (f *fakeDB) ConsumeQuotas(ctx context.Context, apiKeyID uint, quotas []db.Quota) (bool, error) {
+	for i := range quotas {
+		key := quotas[i].Period + quotas[i].PeriodStart.String()
+		if f.counts[key] >= quotas[i].Limit {
+			for j := 0; j < i; j++ {
+				f.counts[quotas[j].Period+quotas[j].PeriodStart.String()]--
+				quotas[j].Count--
+			}
+			quotas[i].Count = quotas[i].Limit
+			return false, nil
+		}
+		f.counts[key]++
+		quotas[i].Count = f.counts[key]
+	}
+	return true, nil
+}
+
+func TestEnforcer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)
+
+	unlimitedRate, dailyQuota, monthlyQuota := 0.0, int64(2), int64(3)
+
+	tests := []struct {
+		name               string
+		key                *db.APIKey
+		requests           int
+		expectedAllowed    int
+		expectedExceeded   string
+		expectedRetryAfter time.Duration
+		expectedPolicy     string
+		expectedRemaining  int64
+	}{
+		{
+			name:               "Default Rate Limit",
+			key:                &db.APIKey{ID: 1},
+			requests:           3,
+			expectedAllowed:    2,
+			expectedExceeded:   "rate limit",
+			expectedRetryAfter: 2 * time.Second,
+			expectedPolicy:     "2;w=4",
+			expectedRemaining:  0,
+		},
+		{
+			name: "Daily Quota",
+			key: &db.APIKey{ID: 2, Limits: db.APIKeyLimits{
+				RateLimit:    &unlimitedRate,
+				DailyQuota:   &dailyQuota,
+				MonthlyQuota: &monthlyQuota,
+			}},
+			requests:           3,
+			expectedAllowed:    2,
+			expectedExceeded:   "daily quota",
+			expectedRetryAfter: 6 * time.Hour,
+			expectedPolicy:     "2;w=86400",
+			expectedRemaining:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer := NewEnforcer(newFakeDB(), Limits{RateLimit: 0.5, Burst: 2})
+			enforcer.now = func() time.Time { return now }
+
+			var decision Decision
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				var err error
+				decision, err = enforcer.Check(ctx, tt.key)
+				assert.NoError(t, err)
+				if decision.Allowed {
+					allowed++
+				}
+			}
+
+			assert.Equal(t, tt.expectedAllowed, allowed)
+			assert.False(t, decision.Allowed)
+			assert.Equal(t, tt.expectedExceeded, decision.Exceeded)
+			assert.Equal(t, tt.expectedRetryAfter, decision.RetryAfter)
+			assert.Equal(t, tt.expectedPolicy, decision.Policy())
+
+			closest, ok := decision.Closest()
+			assert.True(t, ok)
+			assert.Equal(t, tt.expectedRemaining, closest.Remaining)
+		})
+	}
+}
+
+func TestEnforcer_MonthlyQuota(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC)
+
+	fdb := newFakeDB()
+	enforcer := NewEnforcer(fdb, Limits{DailyQuota: 10, MonthlyQuota: 1})
+	enforcer.now = func() time.Time { return now }
+	key := &db.APIKey{ID: 1}
+
+	decision, err := enforcer.Check(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "10;w=86400, 1;w=2678400", decision.Policy())
+	closest, _ := decision.Closest()
+	assert.Equal(t, Status{Limit: 1, Window: 31 * 24 * time.Hour, Remaining: 0, Reset: 12 * time.Hour}, closest)
+
+	// The exceeded monthly quota does not use the daily quota
+	decision, err = enforcer.Check(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 12*time.Hour, decision.RetryAfter)
+	assert.Equal(t, "monthly quota", decision.Exceeded)
+	assert.Equal(t, int64(9), decision.Statuses[0].Remaining)
+
+	// Without limits every request is allowed
+	enforcer = NewEnforcer(fdb, Limits{})
+	decision, err = enforcer.Check(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Empty(t, decision.Statuses)
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"argus/config"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ginprometheus "github.com/zsais/go-gin-prometheus"
+	"net/http"
+	"sync"
+)
+
+const MetricsPath = "/metrics"
+
+var (
+	prometheusOnce sync.Once
+	prometheus     *ginprometheus.Prometheus
+)
+
+// routeLabelledRoutes are labelled by their route instead of their path in the metrics, to keep the cardinality of
+// the lookups of any IP address low. The other requests are labelled by their path.
+var routeLabelledRoutes = map[string]bool{
+	ApiV1 + "/ip/:ip": true,
+}
+
+// metricsURLLabel returns the url label of the metrics of the request
+func metricsURLLabel(c *gin.Context) string {
+	if route := c.FullPath(); routeLabelledRoutes[route] {
+		return route
+	}
+	return c.Request.URL.Path
+}
+
+// metricsMiddleware records the metrics of the requests. The metrics are registered globally, so they are created
+// once and shared by the servers.
+func metricsMiddleware() gin.HandlerFunc {
+	prometheusOnce.Do(func() {
+		prometheus = ginprometheus.NewPrometheus("gin")
+		prometheus.ReqCntURLLabelMappingFn = metricsURLLabel
+	})
+	return prometheus.HandlerFunc()
+}
+
+// NewMetricsServer creates the server of the metrics on their own port, so they are not exposed with the APIs. It
+// returns nil if the port of the metrics is not set, then the metrics are served by the API server.
+func NewMetricsServer(cfg config.Config) *http.Server {
+	if cfg.Metrics.Port == "" {
+		return nil
+	}
+
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	engine.GET(MetricsPath, gin.WrapH(promhttp.Handler()))
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.Metrics.Port),
+		Handler: engine,
+	}
+}
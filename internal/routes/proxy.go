@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"argus/config"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedHeader is the standard header of RFC 7239, e.g. Forwarded: for=192.0.2.60;proto=https
+const forwardedHeader = "Forwarded"
+
+// forwardedForHeader is the internal header the Forwarded header is normalized to, as Gin only supports lists of IPs
+const forwardedForHeader = "X-Argus-Forwarded-For"
+
+// configureClientIP sets up the engine, so c.ClientIP() only uses the headers of the requests coming from the
+// trusted proxies. Without trusted proxies, the address of the connection is used.
+func configureClientIP(engine *gin.Engine, cfg config.Config) error {
+	var trustedProxies []string
+	for _, proxy := range cfg.Proxy.TrustedProxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := engine.SetTrustedProxies(trustedProxies); err != nil {
+		return err
+	}
+
+	engine.ForwardedByClientIP = true
+	engine.RemoteIPHeaders = nil
+	for _, header := range cfg.Proxy.RemoteIPHeaders {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		switch header {
+		case "":
+			continue
+		case forwardedHeader:
+			engine.RemoteIPHeaders = append(engine.RemoteIPHeaders, forwardedForHeader)
+		default:
+			engine.RemoteIPHeaders = append(engine.RemoteIPHeaders, header)
+		}
+	}
+
+	return nil
+}
+
+// normalizeForwardedHeader converts the Forwarded header to a list of IPs in the internal header.
+// The internal header is always replaced, so clients cannot set it directly.
+func normalizeForwardedHeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del(forwardedForHeader)
+		if forwarded := c.Request.Header.Values(forwardedHeader); len(forwarded) > 0 {
+			c.Request.Header.Set(forwardedForHeader, strings.Join(parseForwardedFor(forwarded), ", "))
+		}
+		c.Next()
+	}
+}
+
+// parseForwardedFor returns the for parameters of the Forwarded header values, without the quotes and the ports.
+// Unknown and obfuscated identifiers are kept, so Gin stops at them like at any other invalid IP.
+func parseForwardedFor(values []string) []string {
+	var addresses []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, address, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(name, "for") {
+					continue
+				}
+
+				address = strings.Trim(address, `"`)
+				if host, _, err := net.SplitHostPort(address); err == nil {
+					address = host
+				}
+				addresses = append(addresses, strings.Trim(address, "[]"))
+			}
+		}
+	}
+
+	return addresses
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"argus/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		headers        map[string]string
+		expectedIP     string
+	}{
+		{
+			name:       "No Trusted Proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:           "Untrusted Proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "5.5.5.5:1234",
+			headers:        map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expectedIP:     "5.5.5.5",
+		},
+		{
+			name:           "Trusted Proxies",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "1.2.3.4, 10.0.0.2"},
+			expectedIP:     "1.2.3.4",
+		},
+		{
+			name:           "Spoofed Forwarded For",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4"},
+			expectedIP:     "1.2.3.4",
+		},
+		{
+			name:           "Real IP",
+			trustedProxies: []string{"10.0.0.1"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Real-IP": "1.2.3.4"},
+			expectedIP:     "1.2.3.4",
+		},
+		{
+			name:           "Forwarded",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"Forwarded": `for=192.0.2.60;proto=https, For="[2001:db8::1]:4711"`},
+			expectedIP:     "2001:db8::1",
+		},
+		{
+			name:           "Obfuscated Forwarded",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"Forwarded": "for=_hidden"},
+			expectedIP:     "10.0.0.1",
+		},
+		{
+			name:           "Internal Header",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{forwardedForHeader: "1.2.3.4"},
+			expectedIP:     "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.Proxy.TrustedProxies = tt.trustedProxies
+			cfg.Proxy.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP", "Forwarded"}
+
+			engine := gin.New()
+			assert.NoError(t, configureClientIP(engine, cfg))
+			engine.Use(normalizeForwardedHeader())
+			engine.GET("/", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedIP, w.Body.String())
+		})
+	}
+}
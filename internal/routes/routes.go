@@ -2,51 +2,178 @@ package routes
 
 import (
 	"argus/config"
+	"argus/internal/audit"
+	"argus/internal/auth"
 	"argus/internal/db"
 	"argus/internal/handlers"
 	"argus/internal/iputil"
+	"argus/internal/usage"
 	"argus/pkg/logger"
+	"argus/pkg/ratelimit"
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	ginprometheus "github.com/zsais/go-gin-prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const ApiV1 = "/api/v1"
 
-// NewGinServer creates a new Server instance.
-func NewGinServer(cfg config.Config, db db.DB, ipStatsGatherer iputil.IPStatsGatherer) (*http.Server, error) {
+// NewGinServer creates a new Server instance, the usage of its requests is counted by the meter.
+func NewGinServer(cfg config.Config, db db.DB, ipStatsGatherer iputil.IPStatsGatherer, meter *usage.Meter) (*http.Server, error) {
 	// Gin Configuration
 	gin.SetMode(cfg.Argus.GinMode)
 
-	// Create new engine for the server
-	engine := gin.Default()
+	// Create new engine for the server, the requests are logged with the authenticated client
+	engine := gin.New()
+	engine.Use(logger.GinMiddleware(), gin.Recovery())
+	// The values of the request context, e.g. the usage of the request, are reachable from the gin context
+	engine.ContextWithFallback = true
+	if err := configureClientIP(engine, cfg); err != nil {
+		return nil, fmt.Errorf("cannot configure the trusted proxies: %w", err)
+	}
 
 	// Create the HTTP server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.Argus.Port),
 		Handler: engine,
 	}
+	if err := configureTLS(server, cfg); err != nil {
+		return nil, fmt.Errorf("cannot configure tls: %w", err)
+	}
 	logger.Info("new gin server has been created")
 
 	// Create new Gin handler
 	ginHandler := handlers.NewGinHandler(cfg, db, ipStatsGatherer)
+	auditSink, err := audit.OpenSink(cfg.Audit.LogSink)
+	if err != nil {
+		return nil, err
+	}
+	ginHandler.SetAuditSink(auditSink)
+	ginHandler.SetMeter(meter)
 
 	// Set up the middlewares
-	p := ginprometheus.NewPrometheus("gin")
-	p.Use(engine)
+	engine.Use(metricsMiddleware(), normalizeForwardedHeader())
+	// The metrics are only served by the API server if they do not have their own port
+	if cfg.Metrics.Port == "" {
+		engine.GET(MetricsPath, gin.WrapH(promhttp.Handler()))
+	}
+
+	// Public APIs, they are never authenticated
+	public := engine.Group(ApiV1)
+	public.GET("/health/ping", ginHandler.Ping)
+
+	// The other APIs are authenticated in production mode
+	v1 := engine.Group(ApiV1)
 	if cfg.Argus.IsProductionMode {
-		engine.Use(ginHandler.BillingMiddleware())
+		authenticators, err := newAuthenticators(cfg, server, ginHandler)
+		if err != nil {
+			return nil, err
+		}
+		// The requests rejected by their signature or limits are not billed
+		v1.Use(
+			ginHandler.AuthMiddleware(authenticators...),
+			ginHandler.SignatureMiddleware(),
+			ginHandler.QuotaMiddleware(),
+			ginHandler.BillingMiddleware(),
+		)
 	}
+	// The queries of the APIs are restricted to the tenant of the client
+	v1.Use(ginHandler.TenantMiddleware())
+
+	// The scopes of the API keys are only enforced when the keys are, i.e. in production mode
+	requireScope := func(scope string) gin.HandlerFunc {
+		if !cfg.Argus.IsProductionMode {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return ginHandler.RequireScope(scope)
+	}
+	read := requireScope(auth.ScopeAgentsRead)
+	write := requireScope(auth.ScopeAgentsWrite)
+	remove := requireScope(auth.ScopeAgentsDelete)
+	export := requireScope(auth.ScopeExport)
+	// The changes and the exports are audited
+	audited := ginHandler.Audit
 
 	// Register routes of modules
-	v1 := engine.Group(ApiV1)
-	// Health APIs
-	v1.GET("/health/ping", ginHandler.Ping)
 	// AgentDetailedResponse Monitoring APIs
-	v1.POST("/agents", ginHandler.HandleCreateAgent)
-	v1.GET("/agents", ginHandler.HandleGetAgents)
-	v1.GET("/agents/:agent_id", ginHandler.HandleGetAgentDetail)
+	v1.POST("/agents", write, audited("agent.create"), ginHandler.HandleCreateAgent)
+	v1.POST("/agents:method", ginHandler.RequireAgentsMethod(":batch"), write, audited("agent.batch_create"), ginHandler.HandleBatchCreateAgents)
+	v1.GET("/agents", read, ginHandler.HandleGetAgents)
+	v1.DELETE("/agents", remove, audited("agent.bulk_delete"), ginHandler.HandleBulkDeleteAgents)
+	v1.GET("/agents/export", export, audited("agent.export"), ginHandler.HandleExportAgents)
+	v1.POST("/agents/import", write, audited("agent.import"), ginHandler.HandleImportAgents)
+	v1.GET("/agents/import/:job_id", read, ginHandler.HandleGetImportJob)
+	v1.GET("/agents/:agent_id", read, ginHandler.HandleGetAgentDetail)
+	v1.GET("/agents/:agent_id/enrichment", read, ginHandler.HandleGetEnrichmentJob)
+	v1.DELETE("/agents/:agent_id", remove, audited("agent.delete"), ginHandler.HandleDeleteAgent)
+	v1.POST("/agents/:agent_id/refresh", write, audited("agent.refresh"), ginHandler.HandleRefreshAgent)
+	v1.POST("/agents/:agent_id/restore", write, audited("agent.restore"), ginHandler.HandleRestoreAgent)
+	// IP APIs, the lookups are rate limited as they do not create anything
+	lookupRateLimit := func(c *gin.Context) { c.Next() }
+	if cfg.Lookup.RateLimit > 0 {
+		lookupLimiter := ratelimit.NewTokenBucket(cfg.Lookup.RateLimit, cfg.Lookup.Burst)
+		lookupRateLimit = ginHandler.RateLimitMiddleware(lookupLimiter, (*gin.Context).ClientIP)
+	}
+	v1.GET("/ip/:ip", read, lookupRateLimit, ginHandler.HandleLookupIP)
+	v1.GET("/agents/self", read, lookupRateLimit, ginHandler.HandleLookupSelf)
+	v1.POST("/agents/self", write, audited("agent.create"), ginHandler.HandleCreateSelfAgent)
+	// Statistics APIs
+	v1.GET("/stats/agents", read, ginHandler.HandleGetAgentStats)
+	// Admin APIs
+	admin := v1.Group("/admin", requireScope(auth.ScopeAdmin))
+	admin.DELETE("/agents/:agent_id", audited("agent.purge"), ginHandler.HandlePurgeAgent)
+	admin.POST("/api-keys", audited("api_key.create"), ginHandler.HandleCreateAPIKey)
+	admin.GET("/api-keys", ginHandler.HandleGetAPIKeys)
+	admin.DELETE("/api-keys/:key_id", audited("api_key.revoke"), ginHandler.HandleRevokeAPIKey)
+	admin.PUT("/api-keys/:key_id/limits", audited("api_key.update_limits"), ginHandler.HandleUpdateAPIKeyLimits)
+	admin.PUT("/api-keys/:key_id/scopes", audited("api_key.update_scopes"), ginHandler.HandleUpdateAPIKeyScopes)
+	admin.PUT("/api-keys/:key_id/signing", audited("api_key.update_signing"), ginHandler.HandleUpdateAPIKeySigning)
+	admin.GET("/usage", ginHandler.HandleGetUsage)
+	admin.GET("/usage/invoice", audited("usage.export"), ginHandler.HandleGetUsageInvoice)
+	admin.POST("/tenants", audited("tenant.create"), ginHandler.HandleCreateTenant)
+	admin.GET("/tenants", ginHandler.HandleGetTenants)
+	admin.GET("/tenants/:tenant_id", ginHandler.HandleGetTenant)
+	admin.PUT("/tenants/:tenant_id", audited("tenant.update"), ginHandler.HandleUpdateTenant)
+	admin.GET("/audit", ginHandler.HandleGetAuditEvents)
 
 	return server, nil
 }
+
+// newAuthenticators creates the authenticators of the requests in order of their priority, i.e. the bearer tokens,
+// the API keys and the client certificates.
+func newAuthenticators(cfg config.Config, server *http.Server, ginHandler *handlers.GinHandler) ([]auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+	if cfg.JWT.JWKSURL != "" || cfg.JWT.JWKSFile != "" {
+		jwtAuthenticator, err := auth.NewJWTAuthenticator(context.Background(), auth.JWTOptions{
+			JWKSURL:         cfg.JWT.JWKSURL,
+			JWKSFile:        cfg.JWT.JWKSFile,
+			RefreshInterval: time.Duration(cfg.JWT.RefreshIntervalInSecs) * time.Second,
+			Issuer:          cfg.JWT.Issuer,
+			Audience:        cfg.JWT.Audience,
+			ClockSkew:       time.Duration(cfg.JWT.ClockSkewInSecs) * time.Second,
+			ScopesClaim:     cfg.JWT.ScopesClaim,
+			TenantClaim:     cfg.JWT.TenantClaim,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create the jwt authenticator: %w", err)
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+	authenticators = append(authenticators, ginHandler.APIKeyAuthenticator())
+	if server.TLSConfig != nil && server.TLSConfig.ClientCAs != nil {
+		var scopes []string
+		for _, scope := range cfg.TLS.ClientCertScopes {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				if !auth.IsValidScope(scope) {
+					return nil, fmt.Errorf("unknown scope %q of the client certificates", scope)
+				}
+				scopes = append(scopes, scope)
+			}
+		}
+		authenticators = append(authenticators, auth.ClientCertAuthenticator{Scopes: scopes})
+	}
+	return authenticators, nil
+}
@@ -0,0 +1,333 @@
+package routes
+
+import (
+	"argus/config"
+	"argus/internal/auth"
+	"argus/internal/db"
+	"argus/internal/iputil"
+	"argus/internal/usage"
+	"argus/pkg/logger"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDB is always up and keeps the API keys, the tenants, the agents and the audit events in memory, the other
+// methods of db.DB are not implemented
+type fakeDB struct {
+	db.DB
+	keys    map[string]db.APIKey
+	tenants map[string]db.Tenant
+	agents  map[uint]db.Agent
+	events  []db.AuditEvent
+}
+
+func (f *fakeDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeDB) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*db.APIKey, error) {
+	key, ok := f.keys[prefix]
+	if !ok {
+		return nil, db.ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (f *fakeDB) TouchAPIKey(ctx context.Context, keyID uint, usedAt time.Time) error {
+	return nil
+}
+
+func (f *fakeDB) AddUsage(ctx context.Context, rollups []db.UsageRollup) error {
+	return nil
+}
+
+func (f *fakeDB) GetTenant(ctx context.Context, tenantID string) (*db.Tenant, error) {
+	tenant, ok := f.tenants[tenantID]
+	if !ok {
+		return nil, db.ErrTenantNotFound
+	}
+	return &tenant, nil
+}
+
+func (f *fakeDB) GetAgentByID(ctx context.Context, agentID uint) (*db.Agent, error) {
+	agent, ok := f.agents[agentID]
+	if !ok || agent.TenantID != db.TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &agent, nil
+}
+
+func (f *fakeDB) DeleteAgent(ctx context.Context, agentID uint) error {
+	if _, err := f.GetAgentByID(ctx, agentID); err != nil {
+		return db.ErrAgentNotFound
+	}
+	delete(f.agents, agentID)
+	return nil
+}
+
+func (f *fakeDB) BulkDeleteAgents(ctx context.Context, filter *db.AgentFilter, chunkSize int) ([]uint, error) {
+	var deleted []uint
+	for id, agent := range f.agents {
+		if agent.TenantID == db.TenantFromContext(ctx) && (filter.IPAddress == nil || agent.IPAddress == *filter.IPAddress) {
+			deleted = append(deleted, id)
+			delete(f.agents, id)
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeDB) CreateAuditEvent(ctx context.Context, event *db.AuditEvent) error {
+	event.ID = uint(len(f.events) + 1)
+	f.events = append(f.events, *event)
+	return nil
+}
+
+func TestNewGinServer(t *testing.T) {
+	logger.SetupLogger(logrus.New())
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	var cfg config.Config
+	cfg.Argus.GinMode = gin.TestMode
+	cfg.Argus.IsProductionMode = true
+	server, err := NewGinServer(cfg, &fakeDB{}, argusIpClient, usage.NewMeter(&fakeDB{}, usage.DefaultFlushInterval))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		apiKey       string
+		expectedCode int
+	}{
+		{name: "Health Is Public", method: http.MethodGet, path: ApiV1 + "/health/ping", expectedCode: http.StatusOK},
+		{name: "Metrics Without Their Own Port", method: http.MethodGet, path: MetricsPath, expectedCode: http.StatusOK},
+		{name: "Agents Without Credentials", method: http.MethodGet, path: ApiV1 + "/agents", expectedCode: http.StatusUnauthorized},
+		{name: "Admin Without Credentials", method: http.MethodGet, path: ApiV1 + "/admin/api-keys", expectedCode: http.StatusUnauthorized},
+		{name: "Invalid API Key", method: http.MethodGet, path: ApiV1 + "/agents", apiKey: "test_api_key", expectedCode: http.StatusUnauthorized},
+		{name: "Unknown Route", method: http.MethodGet, path: "/unknown", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestNewGinServer_Tenants(t *testing.T) {
+	logger.SetupLogger(logrus.New())
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	acmeKey, acmePrefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	unknownKey, unknownPrefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	acmeAdminKey, acmeAdminPrefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	fdb := &fakeDB{
+		keys: map[string]db.APIKey{
+			acmePrefix:      {ID: 1, Prefix: acmePrefix, Hash: auth.HashAPIKey(acmeKey), TenantID: "acme", Scopes: db.Scopes{auth.ScopeAgentsRead}},
+			unknownPrefix:   {ID: 2, Prefix: unknownPrefix, Hash: auth.HashAPIKey(unknownKey), TenantID: "unknown", Scopes: db.Scopes{auth.ScopeAgentsRead}},
+			acmeAdminPrefix: {ID: 3, Prefix: acmeAdminPrefix, Hash: auth.HashAPIKey(acmeAdminKey), TenantID: "acme", Scopes: db.Scopes{auth.ScopeAdmin, auth.ScopeAgentsRead}},
+		},
+		tenants: map[string]db.Tenant{db.DefaultTenant: {ID: db.DefaultTenant}, "acme": {ID: "acme"}},
+		agents: map[uint]db.Agent{
+			1: {ID: 1, TenantID: "acme", IPAddress: "8.8.8.8"},
+			2: {ID: 2, TenantID: db.DefaultTenant, IPAddress: "8.8.4.4"},
+		},
+	}
+
+	var cfg config.Config
+	cfg.Argus.GinMode = gin.TestMode
+	cfg.Argus.IsProductionMode = true
+	cfg.Argus.APIKey = "bootstrap_key"
+	server, err := NewGinServer(cfg, fdb, argusIpClient, usage.NewMeter(fdb, usage.DefaultFlushInterval))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		apiKey       string
+		agentID      int
+		expectedCode int
+	}{
+		{name: "Agent Of The Tenant", apiKey: acmeKey, agentID: 1, expectedCode: http.StatusOK},
+		{name: "Agent Of Another Tenant", apiKey: acmeKey, agentID: 2, expectedCode: http.StatusNotFound},
+		{name: "Agent Of The Default Tenant", apiKey: "bootstrap_key", agentID: 2, expectedCode: http.StatusOK},
+		{name: "Agent Of A Tenant From The Default Tenant", apiKey: "bootstrap_key", agentID: 1, expectedCode: http.StatusNotFound},
+		{name: "Unknown Tenant", apiKey: unknownKey, agentID: 1, expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/agents/%d", ApiV1, tt.agentID), nil)
+			req.Header.Set(auth.APIKeyHeader, tt.apiKey)
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+
+	// The admin APIs are not restricted to a tenant, so the keys of the tenants are not granted the admin scope
+	call := func(method string, path string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, ApiV1+path, strings.NewReader(body))
+		req.Header.Set(auth.APIKeyHeader, key)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/agents/1", acmeAdminKey, "").Code)
+	for _, path := range []string{"/admin/api-keys", "/admin/audit", "/admin/tenants"} {
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, path, acmeAdminKey, "").Code, path)
+	}
+	w := call(http.MethodPost, "/admin/api-keys", "bootstrap_key", `{"name":"acme admin","tenant_id":"acme","scopes":["admin"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "default tenant")
+}
+
+func TestNewGinServer_Audit(t *testing.T) {
+	logger.SetupLogger(logrus.New())
+	gin.SetMode(gin.TestMode)
+
+	argusIpClient, err := iputil.NewArgusIPClient(&iputil.MockIPInfoClient{})
+	assert.NoError(t, err)
+
+	deleterKey, deleterPrefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	readerKey, readerPrefix, err := auth.GenerateAPIKey()
+	assert.NoError(t, err)
+	fdb := &fakeDB{
+		keys: map[string]db.APIKey{
+			deleterPrefix: {ID: 1, Prefix: deleterPrefix, Hash: auth.HashAPIKey(deleterKey), TenantID: "acme", Scopes: db.Scopes{auth.ScopeAgentsRead, auth.ScopeAgentsDelete}},
+			readerPrefix:  {ID: 2, Prefix: readerPrefix, Hash: auth.HashAPIKey(readerKey), TenantID: "acme", Scopes: db.Scopes{auth.ScopeAgentsRead}},
+		},
+		tenants: map[string]db.Tenant{"acme": {ID: "acme"}},
+		agents: map[uint]db.Agent{
+			1: {ID: 1, TenantID: "acme", IPAddress: "8.8.8.8"},
+			2: {ID: 2, TenantID: db.DefaultTenant, IPAddress: "8.8.4.4"},
+		},
+	}
+
+	var cfg config.Config
+	cfg.Argus.GinMode = gin.TestMode
+	cfg.Argus.IsProductionMode = true
+	server, err := NewGinServer(cfg, fdb, argusIpClient, usage.NewMeter(fdb, usage.DefaultFlushInterval))
+	assert.NoError(t, err)
+
+	call := func(method string, path string, key string, requestID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, ApiV1+path, nil)
+		req.Header.Set(auth.APIKeyHeader, key)
+		req.Header.Set(logger.RequestIDHeader, requestID)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The reads are not audited
+	w := call(http.MethodGet, "/agents/1", readerKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, w.Header().Get(logger.RequestIDHeader), 32)
+	// The import jobs can be polled with the read scope
+	w = call(http.MethodGet, "/agents/import/unknown", readerKey, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// The unknown methods of the agents are not found before they are authorized or audited
+	w = call(http.MethodPost, "/agents:unknown", readerKey, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, fdb.events)
+
+	// The changes are audited with their client, outcome and request ID
+	w = call(http.MethodDelete, "/agents/1", deleterKey, "req-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-1", w.Header().Get(logger.RequestIDHeader))
+	w = call(http.MethodDelete, "/agents/2", deleterKey, "invalid request id")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotEqual(t, "invalid request id", w.Header().Get(logger.RequestIDHeader))
+	// The denied requests are audited without an action
+	w = call(http.MethodDelete, "/agents/1", readerKey, "req-3")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Len(t, fdb.events, 3)
+	deleted := fdb.events[0]
+	assert.Equal(t, "agent.delete", deleted.Action)
+	assert.Equal(t, "agent", deleted.Resource)
+	assert.Equal(t, "1", deleted.ResourceID)
+	assert.Equal(t, "acme", deleted.TenantID)
+	assert.Equal(t, uint(1), deleted.APIKeyID)
+	assert.Contains(t, deleted.Subject, deleterPrefix)
+	assert.Equal(t, "req-1", deleted.RequestID)
+	assert.Equal(t, ApiV1+"/agents/:agent_id", deleted.Route)
+	assert.Equal(t, http.StatusOK, deleted.Status)
+	assert.Equal(t, db.AuditSucceeded, deleted.Outcome)
+
+	assert.Equal(t, db.AuditFailed, fdb.events[1].Outcome)
+	assert.Equal(t, http.StatusNotFound, fdb.events[1].Status)
+	assert.Equal(t, "2", fdb.events[1].ResourceID)
+
+	assert.Equal(t, db.AuditDenied, fdb.events[2].Outcome)
+	assert.Empty(t, fdb.events[2].Action)
+	assert.Equal(t, "missing scope "+auth.ScopeAgentsDelete, fdb.events[2].Reason)
+	assert.Equal(t, "req-3", fdb.events[2].RequestID)
+
+	// The bulk deletes are audited with the IDs of the deleted agents
+	fdb.agents[3] = db.Agent{ID: 3, TenantID: "acme", IPAddress: "1.1.1.1"}
+	w = call(http.MethodDelete, "/agents?ip_address=1.1.1.1", deleterKey, "req-4")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, fdb.events, 4)
+	assert.Equal(t, "agent.bulk_delete", fdb.events[3].Action)
+	assert.JSONEq(t, `{"query":{"ip_address":["1.1.1.1"]},"result":{"deleted":1,"deleted_ids":[3]}}`, fdb.events[3].Summary)
+}
+
+func TestNewMetricsServer(t *testing.T) {
+	var cfg config.Config
+	assert.Nil(t, NewMetricsServer(cfg))
+
+	cfg.Metrics.Port = "9090"
+	server := NewMetricsServer(cfg)
+	assert.Equal(t, ":9090", server.Addr)
+
+	req, _ := http.NewRequest(http.MethodGet, MetricsPath, nil)
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMetricsURLLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var labels []string
+	router := gin.New()
+	handler := func(c *gin.Context) { labels = append(labels, metricsURLLabel(c)) }
+	router.GET(ApiV1+"/ip/:ip", handler)
+	router.GET(ApiV1+"/agents/:agent_id", handler)
+	router.NoRoute(handler)
+
+	// Only the lookups are labelled by their route
+	for _, path := range []string{ApiV1 + "/ip/8.8.8.8", ApiV1 + "/agents/1", "/unknown"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, []string{ApiV1 + "/ip/:ip", ApiV1 + "/agents/1", "/unknown"}, labels)
+}
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"argus/config"
+	"argus/pkg/tlsutil"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// configureTLS sets up the server to serve TLS if a certificate is configured, the certificate is reloaded when its
+// files change. The client certificates are verified by the client CAs if they are configured.
+func configureTLS(server *http.Server, cfg config.Config) error {
+	if cfg.TLS.CertFile == "" && cfg.TLS.KeyFile == "" {
+		if cfg.TLS.ClientCAFile != "" {
+			return errors.New("the client certificates cannot be verified without a server certificate")
+		}
+		return nil
+	}
+
+	reloader, err := tlsutil.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile,
+		time.Duration(cfg.TLS.ReloadIntervalInSecs)*time.Second)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if cfg.TLS.ClientCAFile != "" {
+		clientCAs, err := tlsutil.LoadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("cannot load the client CAs: %w", err)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		// The clients without a certificate can still use the other authentication methods
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.TLS.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if cfg.TLS.RequireClientCert {
+		return errors.New("the client certificates cannot be required without the client CAs")
+	}
+
+	server.TLSConfig = tlsConfig
+	return nil
+}
@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"argus/config"
+	"argus/pkg/logger"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, signed by its parent or by itself
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and its key to the directory and returns their files
+func (c *testCert) write(t *testing.T, dir string, name string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestConfigureTLS(t *testing.T) {
+	logger.SetupLogger(logrus.New())
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCertFile, serverKeyFile := newTestCert(t, "localhost", ca).write(t, dir, "server")
+	client := newTestCert(t, "inventory", ca)
+	stranger := newTestCert(t, "stranger", newTestCert(t, "Other CA", nil))
+
+	newConfig := func(clientCAFile string, requireClientCert bool) config.Config {
+		var cfg config.Config
+		cfg.TLS.CertFile = serverCertFile
+		cfg.TLS.KeyFile = serverKeyFile
+		cfg.TLS.ReloadIntervalInSecs = 60
+		cfg.TLS.ClientCAFile = clientCAFile
+		cfg.TLS.RequireClientCert = requireClientCert
+		return cfg
+	}
+
+	// Without a certificate, the server is not served over TLS
+	server := &http.Server{}
+	assert.NoError(t, configureTLS(server, config.Config{}))
+	assert.Nil(t, server.TLSConfig)
+
+	var invalid config.Config
+	invalid.TLS.ClientCAFile = caFile
+	assert.Error(t, configureTLS(server, invalid))
+	assert.Error(t, configureTLS(server, newConfig("", true)))
+
+	tests := []struct {
+		name              string
+		requireClientCert bool
+		clientCert        *testCert
+		expectedSubject   string
+		expectedFailure   bool
+	}{
+		{
+			name:            "Verified Client Certificate",
+			clientCert:      client,
+			expectedSubject: "CN=inventory",
+		},
+		{
+			name: "Optional Client Certificate",
+		},
+		{
+			name:              "Required Client Certificate",
+			requireClientCert: true,
+			expectedFailure:   true,
+		},
+		{
+			name:            "Unknown Client Certificate",
+			clientCert:      stranger,
+			expectedFailure: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &http.Server{}
+			assert.NoError(t, configureTLS(server, newConfig(caFile, tt.requireClientCert)))
+
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.VerifiedChains) > 0 {
+					_, _ = io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.String())
+				}
+			}))
+			ts.TLS = server.TLSConfig
+			ts.StartTLS()
+			defer ts.Close()
+
+			// The server name makes the server use its own certificate instead of the one of httptest
+			clientTLS := &tls.Config{RootCAs: x509.NewCertPool(), ServerName: "localhost"}
+			clientTLS.RootCAs.AddCert(ca.cert)
+			if tt.clientCert != nil {
+				// The certificate is sent even if it is not signed by the CAs of the server
+				clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &tls.Certificate{Certificate: [][]byte{tt.clientCert.der}, PrivateKey: tt.clientCert.key}, nil
+				}
+			}
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+
+			resp, err := httpClient.Get(ts.URL)
+			if tt.expectedFailure {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSubject, string(body))
+		})
+	}
+}
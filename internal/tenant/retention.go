@@ -0,0 +1,85 @@
+package tenant
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// DefaultRetentionInterval is the default time between purging the deleted agents
+const DefaultRetentionInterval = time.Hour
+
+// RetentionDays returns the number of days the deleted agents of the tenant are kept, zero keeps them forever
+func RetentionDays(tenant *db.Tenant, defaultDays int) int {
+	if tenant.Settings.RetentionDays != nil {
+		return *tenant.Settings.RetentionDays
+	}
+	return defaultDays
+}
+
+// Retention permanently deletes the agents deleted longer than the retention of their tenant
+type Retention struct {
+	db          db.DB
+	defaultDays int
+	interval    time.Duration
+	now         func() time.Time
+}
+
+// NewRetention creates a retention keeping the deleted agents for defaultDays, unless their tenant overrides it.
+// The agents are purged every interval.
+func NewRetention(database db.DB, defaultDays int, interval time.Duration) *Retention {
+	if interval <= 0 {
+		interval = DefaultRetentionInterval
+	}
+	return &Retention{db: database, defaultDays: defaultDays, interval: interval, now: time.Now}
+}
+
+// Run purges the agents every interval until the context is canceled
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges the agents of every tenant, it returns the number of purged agents
+func (r *Retention) RunOnce(ctx context.Context) int64 {
+	tenants, err := r.db.GetTenants(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Warn("cannot retrieve the tenants to purge their agents")
+		}
+		return 0
+	}
+
+	var total int64
+	for i := range tenants {
+		days := RetentionDays(&tenants[i], r.defaultDays)
+		if days <= 0 {
+			continue
+		}
+
+		log := logger.WithFields(logrus.Fields{"tenant": tenants[i].ID, "retention_days": days})
+		purged, err := r.db.PurgeDeletedAgents(db.WithTenant(ctx, tenants[i].ID), r.now().AddDate(0, 0, -days))
+		total += purged
+		if err != nil {
+			log.WithError(err).Warn("cannot purge the deleted agents")
+			continue
+		}
+		if purged > 0 {
+			log.WithField("purged", purged).Info("the deleted agents have been purged")
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,74 @@
+package tenant
+
+import (
+	"argus/internal/db"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// cachedTenant is a tenant looked up from the database, tenant is nil if there is no tenant with the id
+type cachedTenant struct {
+	tenant    *db.Tenant
+	expiresAt time.Time
+}
+
+// Store looks up the tenants of the requests. The tenants are cached for a short time, so the changes of their
+// settings may take effect on other instances after their cache entry expires.
+type Store struct {
+	db  db.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*cachedTenant
+}
+
+// NewStore creates a store caching the tenants for the ttl
+func NewStore(database db.DB, ttl time.Duration) *Store {
+	return &Store{
+		db:    database,
+		ttl:   ttl,
+		now:   time.Now,
+		cache: map[string]*cachedTenant{},
+	}
+}
+
+// Get returns the tenant having the id, db.ErrTenantNotFound is returned if there is no such tenant
+func (s *Store) Get(ctx context.Context, tenantID string) (*db.Tenant, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[tenantID]
+	s.mu.Unlock()
+	if !ok || !s.now().Before(entry.expiresAt) {
+		tenant, err := s.db.GetTenant(ctx, tenantID)
+		if err != nil && !errors.Is(err, db.ErrTenantNotFound) {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		now := s.now()
+		// The unknown tenants are cached too, the expired entries are removed so they do not pile up
+		for id, e := range s.cache {
+			if !now.Before(e.expiresAt) {
+				delete(s.cache, id)
+			}
+		}
+		entry = &cachedTenant{tenant: tenant, expiresAt: now.Add(s.ttl)}
+		s.cache[tenantID] = entry
+		s.mu.Unlock()
+	}
+
+	if entry.tenant == nil {
+		return nil, db.ErrTenantNotFound
+	}
+	found := *entry.tenant
+	return &found, nil
+}
+
+// Invalidate removes the tenant from the cache, e.g. after its settings are changed
+func (s *Store) Invalidate(tenantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, tenantID)
+}
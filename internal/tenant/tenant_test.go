@@ -0,0 +1,133 @@
+package tenant
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Setup the logger
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+	logger.SetupLogger(log)
+
+	m.Run()
+}
+
+// fakeDB keeps the tenants in memory and records the purges, the other methods of db.DB are not implemented
+type fakeDB struct {
+	db.DB
+	mu      sync.Mutex
+	tenants []db.Tenant
+	lookups int
+	err     error
+	// purges are the times the deleted agents are purged before by the tenant
+	purges map[string]time.Time
+}
+
+func (f *fakeDB) GetTenants(ctx context.Context) ([]db.Tenant, error) {
+	return f.tenants, f.err
+}
+
+func (f *fakeDB) GetTenant(ctx context.Context, tenantID string) (*db.Tenant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, t := range f.tenants {
+		if t.ID == tenantID {
+			return &t, nil
+		}
+	}
+	return nil, db.ErrTenantNotFound
+}
+
+func (f *fakeDB) PurgeDeletedAgents(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.purges[db.TenantFromContext(ctx)] = deletedBefore
+	return 1, nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	fdb := &fakeDB{tenants: []db.Tenant{{ID: db.DefaultTenant}, {ID: "acme", Name: "Acme"}}}
+	store := NewStore(fdb, time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	tenant, err := store.Get(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", tenant.Name)
+
+	// The tenants are cached, the unknown ones too
+	_, err = store.Get(ctx, "acme")
+	assert.NoError(t, err)
+	_, err = store.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, db.ErrTenantNotFound)
+	_, err = store.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, db.ErrTenantNotFound)
+	assert.Equal(t, 2, fdb.lookups)
+
+	// The cached tenant is not changed by the callers
+	tenant.Name = "Changed"
+	tenant, _ = store.Get(ctx, "acme")
+	assert.Equal(t, "Acme", tenant.Name)
+
+	// The tenant is looked up again after it is invalidated or expired
+	store.Invalidate("acme")
+	_, err = store.Get(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fdb.lookups)
+	now = now.Add(time.Minute)
+	_, err = store.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, db.ErrTenantNotFound)
+	assert.Equal(t, 4, fdb.lookups)
+
+	// The errors of the database are not cached
+	fdb.err = errors.New("connection refused")
+	store.Invalidate("acme")
+	_, err = store.Get(ctx, "acme")
+	assert.ErrorIs(t, err, fdb.err)
+	assert.NotErrorIs(t, err, db.ErrTenantNotFound)
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+
+	week, forever := 7, 0
+	fdb := &fakeDB{
+		tenants: []db.Tenant{
+			{ID: db.DefaultTenant},
+			{ID: "acme", Settings: db.TenantSettings{RetentionDays: &week}},
+			{ID: "globex", Settings: db.TenantSettings{RetentionDays: &forever}},
+		},
+		purges: map[string]time.Time{},
+	}
+	retention := NewRetention(fdb, 30, time.Hour)
+	now := time.Now()
+	retention.now = func() time.Time { return now }
+
+	// Each tenant is purged with its own retention, zero keeps the agents forever
+	assert.Equal(t, int64(2), retention.RunOnce(ctx))
+	assert.Equal(t, map[string]time.Time{
+		db.DefaultTenant: now.AddDate(0, 0, -30),
+		"acme":           now.AddDate(0, 0, -7),
+	}, fdb.purges)
+
+	// Without a default retention, only the tenants having a retention are purged
+	fdb.purges = map[string]time.Time{}
+	assert.Equal(t, int64(1), NewRetention(fdb, 0, 0).RunOnce(ctx))
+	assert.Contains(t, fdb.purges, "acme")
+	assert.Len(t, fdb.purges, 1)
+}
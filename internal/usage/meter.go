@@ -0,0 +1,180 @@
+package usage
+
+import (
+	"argus/internal/db"
+	"argus/pkg/logger"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is the time between writing the usage to the database
+const DefaultFlushInterval = 10 * time.Second
+
+// rollupKey identifies a row of the usage rollups
+type rollupKey struct {
+	apiKeyID uint
+	bucket   time.Time
+	endpoint string
+	status   int
+}
+
+// counts is the usage of a rollup key
+type counts struct {
+	requests        int64
+	upstreamLookups int64
+}
+
+// Meter counts the usage in memory and adds it to the hourly rollups in the database periodically,
+// so the requests are not slowed down by writing their usage. Close flushes the usage on shutdown, the usage which
+// is not flushed yet is lost if the process exits otherwise, e.g. on crashes.
+type Meter struct {
+	db       db.DB
+	interval time.Duration
+	now      func() time.Time
+	start    sync.Once
+	stop     sync.Once
+	done     chan struct{}
+
+	mu     sync.Mutex
+	counts map[rollupKey]counts
+}
+
+// NewMeter creates a meter flushing the usage every interval, it starts flushing with its first usage
+func NewMeter(database db.DB, interval time.Duration) *Meter {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	return &Meter{db: database, interval: interval, now: time.Now, done: make(chan struct{}), counts: map[rollupKey]counts{}}
+}
+
+// StartRequest starts metering a request of the API key on the endpoint, it is counted when it is finished
+func (m *Meter) StartRequest(apiKeyID uint, endpoint string) *Request {
+	return &Request{meter: m, apiKeyID: apiKeyID, endpoint: endpoint}
+}
+
+// Background returns an observer counting the upstream lookups of the work done in the background,
+// e.g. jobs which are created by a request, for the API key on the endpoint
+func (m *Meter) Background(apiKeyID uint, endpoint string) *Request {
+	return &Request{meter: m, apiKeyID: apiKeyID, endpoint: endpoint, finished: true}
+}
+
+// add counts the usage in the current hour
+func (m *Meter) add(apiKeyID uint, endpoint string, status int, requests int64, upstreamLookups int64) {
+	m.start.Do(func() { go m.run() })
+
+	key := rollupKey{
+		apiKeyID: apiKeyID,
+		bucket:   m.now().UTC().Truncate(time.Hour),
+		endpoint: endpoint,
+		status:   status,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.counts[key]
+	c.requests += requests
+	c.upstreamLookups += upstreamLookups
+	m.counts[key] = c
+}
+
+// run flushes the usage periodically until the meter is closed
+func (m *Meter) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+			if err := m.Flush(ctx); err != nil {
+				logger.WithError(err).Warn("cannot flush the usage, it will be retried")
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops flushing the usage periodically and flushes the usage counted so far, it should be called on shutdown
+// after the requests and the background work are finished.
+func (m *Meter) Close(ctx context.Context) error {
+	m.stop.Do(func() { close(m.done) })
+	return m.Flush(ctx)
+}
+
+// Flush adds the counted usage to the rollups, the usage is kept for the next flush in case of errors
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.counts
+	m.counts = map[rollupKey]counts{}
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rollups := make([]db.UsageRollup, 0, len(pending))
+	for key, c := range pending {
+		rollups = append(rollups, db.UsageRollup{
+			APIKeyID:        key.apiKeyID,
+			Bucket:          key.bucket,
+			Endpoint:        key.endpoint,
+			Status:          key.status,
+			Requests:        c.requests,
+			UpstreamLookups: c.upstreamLookups,
+		})
+	}
+
+	err := m.db.AddUsage(ctx, rollups)
+	if err != nil {
+		m.mu.Lock()
+		for key, c := range pending {
+			current := m.counts[key]
+			current.requests += c.requests
+			current.upstreamLookups += c.upstreamLookups
+			m.counts[key] = current
+		}
+		m.mu.Unlock()
+	}
+
+	return err
+}
+
+// Request is the usage of a request, it implements iputil.UpstreamObserver to count the lookups it causes
+type Request struct {
+	meter    *Meter
+	apiKeyID uint
+	endpoint string
+
+	mu              sync.Mutex
+	status          int
+	upstreamLookups int64
+	finished        bool
+}
+
+// ObserveUpstreamLookups counts the lookups with the request, or on their own if the request is finished
+func (r *Request) ObserveUpstreamLookups(lookups int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		r.meter.add(r.apiKeyID, r.endpoint, r.status, 0, int64(lookups))
+		return
+	}
+	r.upstreamLookups += int64(lookups)
+}
+
+// Finish counts the request with its response status, the later lookups are counted with the same status
+func (r *Request) Finish(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return
+	}
+	r.finished, r.status = true, status
+	r.meter.add(r.apiKeyID, r.endpoint, status, 1, r.upstreamLookups)
+}
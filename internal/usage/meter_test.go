@@ -0,0 +1,87 @@
+package usage
+
+import (
+	"argus/internal/db"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB keeps the added usage in memory, the other methods of db.DB are not implemented
+type fakeDB struct {
+	db.DB
+	mu      sync.Mutex
+	rollups []db.UsageRollup
+	err     error
+}
+
+func (f *fakeDB) AddUsage(ctx context.Context, rollups []db.UsageRollup) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.rollups = append(f.rollups, rollups...)
+	return nil
+}
+
+func TestMeter(t *testing.T) {
+	ctx := context.Background()
+	fdb := &fakeDB{}
+	meter := NewMeter(fdb, time.Hour)
+	now := time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	meter.now = func() time.Time { return now }
+
+	// Two requests on the same endpoint, one of them causing lookups after its response
+	first := meter.StartRequest(1, "POST /api/v1/agents")
+	first.ObserveUpstreamLookups(1)
+	first.Finish(201)
+	first.Finish(201)
+
+	second := meter.StartRequest(1, "POST /api/v1/agents")
+	second.Finish(201)
+	second.ObserveUpstreamLookups(3)
+
+	failed := meter.StartRequest(2, "GET /api/v1/agents")
+	failed.Finish(500)
+
+	// Work of a background worker in the next hour
+	now = now.Add(time.Hour)
+	meter.Background(2, "enrichment").ObserveUpstreamLookups(1)
+
+	// The usage is kept if it cannot be added
+	fdb.err = errors.New("connection refused")
+	assert.Error(t, meter.Flush(ctx))
+	fdb.err = nil
+	assert.NoError(t, meter.Flush(ctx))
+	assert.NoError(t, meter.Flush(ctx), "flushing nothing should not fail")
+
+	slices.SortFunc(fdb.rollups, func(a, b db.UsageRollup) int {
+		return strings.Compare(a.Endpoint, b.Endpoint)
+	})
+	hour := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, []db.UsageRollup{
+		{APIKeyID: 2, Bucket: hour, Endpoint: "GET /api/v1/agents", Status: 500, Requests: 1},
+		{APIKeyID: 1, Bucket: hour, Endpoint: "POST /api/v1/agents", Status: 201, Requests: 2, UpstreamLookups: 4},
+		{APIKeyID: 2, Bucket: hour.Add(time.Hour), Endpoint: "enrichment", UpstreamLookups: 1},
+	}, fdb.rollups)
+}
+
+func TestMeter_Close(t *testing.T) {
+	ctx := context.Background()
+	fdb := &fakeDB{}
+	meter := NewMeter(fdb, time.Hour)
+
+	// The usage counted before closing is flushed by it
+	meter.StartRequest(1, "GET /api/v1/agents").Finish(200)
+	assert.NoError(t, meter.Close(ctx))
+	assert.NoError(t, meter.Close(ctx), "closing twice should not fail")
+	if assert.Len(t, fdb.rollups, 1) {
+		assert.Equal(t, int64(1), fdb.rollups[0].Requests)
+	}
+}
@@ -0,0 +1,146 @@
+package filterql
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type of values a field is compared with
+type FieldType int
+
+const (
+	Text FieldType = iota
+	Number
+	Time
+)
+
+// Field describes a field which can be used in queries
+type Field struct {
+	// Column is the SQL expression of the field, it is used in the SQL as it is
+	Column string
+	Type   FieldType
+}
+
+// Fields is the allow-list of the fields that can be used in queries, keyed by their name in queries
+type Fields map[string]Field
+
+// Compile converts the syntax tree into a parameterized SQL condition.
+// Only the columns of fields are written into the SQL, values are always passed as arguments.
+// The returned error is always an *Error.
+func Compile(node Node, fields Fields) (string, []any, error) {
+	c := &compiler{fields: fields}
+	if err := c.compile(node); err != nil {
+		return "", nil, err
+	}
+
+	return c.sql.String(), c.args, nil
+}
+
+type compiler struct {
+	fields Fields
+	sql    strings.Builder
+	args   []any
+}
+
+func (c *compiler) compile(node Node) error {
+	switch n := node.(type) {
+	case *Binary:
+		c.sql.WriteString("(")
+		if err := c.compile(n.Left); err != nil {
+			return err
+		}
+		c.sql.WriteString(" " + n.Op + " ")
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.sql.WriteString(")")
+	case *Not:
+		c.sql.WriteString("(NOT ")
+		if err := c.compile(n.Expr); err != nil {
+			return err
+		}
+		c.sql.WriteString(")")
+	case *Comparison:
+		return c.compileComparison(n)
+	default:
+		return errorf(node.Pos(), "unsupported expression")
+	}
+
+	return nil
+}
+
+func (c *compiler) write(sql string, args ...any) {
+	c.sql.WriteString(sql)
+	c.args = append(c.args, args...)
+}
+
+func (c *compiler) compileComparison(n *Comparison) error {
+	field, ok := c.fields[n.Field]
+	if !ok {
+		return errorf(n.Pos(), "unknown field %q", n.Field)
+	}
+
+	switch field.Type {
+	case Text:
+		switch n.Operator {
+		case ":":
+			c.write("("+field.Column+" ILIKE ?)", likePattern(n.Value))
+		case "=":
+			c.write("("+field.Column+" = ?)", n.Value)
+		case "!=":
+			c.write("("+field.Column+" <> ?)", n.Value)
+		default:
+			return errorf(n.Pos(), "operator %q is not supported for text field %q", n.Operator, n.Field)
+		}
+	case Number:
+		value, err := strconv.ParseInt(n.Value, 10, 64)
+		if err != nil {
+			return errorf(n.ValuePos(), "field %q expects a number", n.Field)
+		}
+		c.write("("+field.Column+" "+sqlOperator(n.Operator)+" ?)", value)
+	case Time:
+		value, isDate, err := parseTime(n.Value)
+		if err != nil {
+			return errorf(n.ValuePos(), "field %q expects a time in format of RFC 3339 or YYYY-MM-DD", n.Field)
+		}
+		if isDate && (n.Operator == ":" || n.Operator == "=") {
+			c.write("("+field.Column+" >= ? AND "+field.Column+" < ?)", value, value.AddDate(0, 0, 1))
+			return nil
+		}
+		c.write("("+field.Column+" "+sqlOperator(n.Operator)+" ?)", value)
+	}
+
+	return nil
+}
+
+// sqlOperator converts the query operator to the SQL one
+func sqlOperator(operator string) string {
+	switch operator {
+	case ":":
+		return "="
+	case "!=":
+		return "<>"
+	default:
+		return operator
+	}
+}
+
+// likePattern converts a value with "*" wildcards to an ILIKE pattern
+func likePattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// parseTime parses a time in RFC 3339 or a date in YYYY-MM-DD format
+func parseTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return t, true, nil
+}
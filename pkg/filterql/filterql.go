@@ -0,0 +1,88 @@
+// Package filterql implements a small query language for filtering records and compiles it into
+// parameterized SQL conditions.
+//
+// The grammar of the language is:
+//
+//	query      = or
+//	or         = and { "OR" and }
+//	and        = not { "AND" not }
+//	not        = "NOT" not | primary
+//	primary    = "(" or ")" | comparison
+//	comparison = field operator value
+//	operator   = ":" | "=" | "!=" | ">" | ">=" | "<" | "<="
+//	value      = word | '"' { character } '"'
+//
+// Keywords are case-sensitive. A word is a sequence of characters other than whitespace, parentheses,
+// quotes and operator characters, other values should be quoted. Inside quotes, a backslash escapes the
+// next character. As ":" is an operator, IPv6 addresses and RFC 3339 timestamps must be quoted, e.g.
+// created_at>"2026-01-01T10:30:00Z", otherwise the query is rejected at their first ":".
+//
+// The ":" operator matches case-insensitively and supports "*" as a wildcard on text fields,
+// e.g. isp:"Cloudflare*". On time fields, ":" and "=" with a date (YYYY-MM-DD) match the whole day.
+//
+// Example:
+//
+//	country:US AND (asn:AS15169 OR isp:"Cloudflare*") AND created_at>2026-01-01
+package filterql
+
+import "fmt"
+
+// MaxQueryLength is the maximum length of a query in bytes
+const MaxQueryLength = 2048
+
+// MaxDepth is the maximum nesting depth of the expressions
+const MaxDepth = 32
+
+// Error is a parse or compile error of a query, Pos is the 1-based position of the error in the query.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Node is a node of the parsed query
+type Node interface {
+	// Pos returns the 1-based position of the node in the query
+	Pos() int
+}
+
+// Binary is a logical AND or OR of two nodes
+type Binary struct {
+	Op    string
+	Left  Node
+	Right Node
+	pos   int
+}
+
+func (b *Binary) Pos() int { return b.pos }
+
+// Not is the logical negation of a node
+type Not struct {
+	Expr Node
+	pos  int
+}
+
+func (n *Not) Pos() int { return n.pos }
+
+// Comparison compares a field with a value
+type Comparison struct {
+	Field    string
+	Operator string
+	Value    string
+	// Quoted reports whether the value was quoted in the query
+	Quoted   bool
+	pos      int
+	valuePos int
+}
+
+func (c *Comparison) Pos() int { return c.pos }
+
+// ValuePos returns the 1-based position of the value in the query
+func (c *Comparison) ValuePos() int { return c.valuePos }
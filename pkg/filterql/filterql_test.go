@@ -0,0 +1,124 @@
+package filterql
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFields = Fields{
+	"id":         {Column: "t.id", Type: Number},
+	"country":    {Column: "t.country", Type: Text},
+	"asn":        {Column: "t.asn", Type: Text},
+	"isp":        {Column: "t.isp", Type: Text},
+	"created_at": {Column: "t.created_at", Type: Time},
+}
+
+func TestCompile(t *testing.T) {
+	newYear := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "Single Comparison",
+			query:        "country:US",
+			expectedSQL:  "(t.country ILIKE ?)",
+			expectedArgs: []any{"US"},
+		},
+		{
+			name:         "Precedence",
+			query:        `country:US AND (asn:AS15169 OR isp:"Cloudflare*") AND created_at>2026-01-01`,
+			expectedSQL:  "(((t.country ILIKE ?) AND ((t.asn ILIKE ?) OR (t.isp ILIKE ?))) AND (t.created_at > ?))",
+			expectedArgs: []any{"US", "AS15169", "Cloudflare%", newYear},
+		},
+		{
+			name:         "OR Binds Looser Than AND",
+			query:        "country:US OR country:DE AND asn=AS3320",
+			expectedSQL:  "((t.country ILIKE ?) OR ((t.country ILIKE ?) AND (t.asn = ?)))",
+			expectedArgs: []any{"US", "DE", "AS3320"},
+		},
+		{
+			name:         "Not And Numbers",
+			query:        "NOT id>=10",
+			expectedSQL:  "(NOT (t.id >= ?))",
+			expectedArgs: []any{int64(10)},
+		},
+		{
+			name:         "Escaped Wildcards",
+			query:        `isp:"50%_\"off\"*"`,
+			expectedSQL:  "(t.isp ILIKE ?)",
+			expectedArgs: []any{`50\%\_"off"%`},
+		},
+		{
+			name:         "Whole Day",
+			query:        "created_at:2026-01-01",
+			expectedSQL:  "(t.created_at >= ? AND t.created_at < ?)",
+			expectedArgs: []any{newYear, newYear.AddDate(0, 0, 1)},
+		},
+		{
+			name:         "Quoted Timestamp",
+			query:        `created_at>="2026-01-01T08:30:00Z"`,
+			expectedSQL:  "(t.created_at >= ?)",
+			expectedArgs: []any{newYear.Add(8*time.Hour + 30*time.Minute)},
+		},
+		{
+			name:         "Not Equal",
+			query:        "country!=US",
+			expectedSQL:  "(t.country <> ?)",
+			expectedArgs: []any{"US"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			assert.NoError(t, err)
+
+			sql, args, err := Compile(node, testFields)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expectedPos int
+	}{
+		{name: "Empty Query", query: "", expectedPos: 1},
+		{name: "Missing Operator", query: "country US", expectedPos: 9},
+		{name: "Missing Value", query: "country:", expectedPos: 9},
+		{name: "Unclosed Parenthesis", query: "(country:US", expectedPos: 12},
+		{name: "Unexpected Parenthesis", query: "country:US)", expectedPos: 11},
+		{name: "Unterminated Quote", query: `isp:"Cloud`, expectedPos: 5},
+		{name: "Dangling Keyword", query: "country:US AND", expectedPos: 15},
+		{name: "Invalid Bang", query: "country!US", expectedPos: 8},
+		{name: "Unknown Field", query: "country:US AND password:x", expectedPos: 16},
+		{name: "Unsupported Operator", query: "country>US", expectedPos: 1},
+		{name: "Invalid Number", query: "id=ten", expectedPos: 4},
+		{name: "Invalid Time", query: "created_at>yesterday", expectedPos: 12},
+		{name: "Unquoted Timestamp", query: "created_at>2026-01-01T10:30:00Z", expectedPos: 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if err == nil {
+				_, _, err = Compile(node, testFields)
+			}
+
+			var queryErr *Error
+			assert.True(t, errors.As(err, &queryErr), "error should be a query error")
+			assert.Equal(t, tt.expectedPos, queryErr.Pos, queryErr.Error())
+		})
+	}
+}
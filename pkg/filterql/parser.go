@@ -0,0 +1,256 @@
+package filterql
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// describe returns a human-readable form of the token for error messages
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return "quoted value"
+	default:
+		return `"` + t.value + `"`
+	}
+}
+
+// isWordRune reports whether the rune can be a part of a word
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`()":=!<>`, r)
+}
+
+// tokenize splits the query into tokens
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: pos})
+			i++
+		case r == ':' || r == '=':
+			tokens = append(tokens, token{kind: tokenOperator, value: string(r), pos: pos})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			if i+1 < len(query) && query[i+1] == '=' {
+				tokens = append(tokens, token{kind: tokenOperator, value: query[i : i+2], pos: pos})
+				i += 2
+				continue
+			}
+			if r == '!' {
+				return nil, errorf(pos, `expected "=" after "!"`)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, value: string(r), pos: pos})
+			i++
+		case r == '"':
+			var value strings.Builder
+			closed := false
+			j := i + 1
+			for j < len(query) {
+				c, cSize := utf8.DecodeRuneInString(query[j:])
+				if c == '\\' && j+1 < len(query) {
+					escaped, escapedSize := utf8.DecodeRuneInString(query[j+1:])
+					value.WriteRune(escaped)
+					j += 1 + escapedSize
+					continue
+				}
+				j += cSize
+				if c == '"' {
+					closed = true
+					break
+				}
+				value.WriteRune(c)
+			}
+			if !closed {
+				return nil, errorf(pos, "unterminated quoted value")
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value.String(), pos: pos})
+			i = j
+		default:
+			j := i
+			for j < len(query) {
+				c, cSize := utf8.DecodeRuneInString(query[j:])
+				if !isWordRune(c) {
+					break
+				}
+				j += cSize
+			}
+			word := query[i:j]
+			kind := tokenWord
+			switch word {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, value: word, pos: pos})
+			i = j
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(query) + 1})
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// Parse parses the query into its syntax tree, the returned error is always an *Error
+func Parse(query string) (Node, error) {
+	if len(query) > MaxQueryLength {
+		return nil, errorf(MaxQueryLength+1, "query is longer than %d characters", MaxQueryLength)
+	}
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s, expected AND, OR or end of query", t.describe())
+	}
+
+	return node, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		op := p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "OR", Left: left, Right: right, pos: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		op := p.advance()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "AND", Left: left, Right: right, pos: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	t := p.peek()
+	if t.kind != tokenNot {
+		return p.parsePrimary()
+	}
+	p.advance()
+
+	if p.depth++; p.depth > MaxDepth {
+		return nil, errorf(t.pos, "query is nested deeper than %d levels", MaxDepth)
+	}
+	expr, err := p.parseNot()
+	p.depth--
+	if err != nil {
+		return nil, err
+	}
+
+	return &Not{Expr: expr, pos: t.pos}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenLParen:
+		if p.depth++; p.depth > MaxDepth {
+			return nil, errorf(t.pos, "query is nested deeper than %d levels", MaxDepth)
+		}
+		node, err := p.parseOr()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, errorf(closing.pos, `unexpected %s, expected ")"`, closing.describe())
+		}
+		return node, nil
+	case tokenWord:
+		operator := p.advance()
+		if operator.kind != tokenOperator {
+			return nil, errorf(operator.pos, "unexpected %s, expected an operator after field %q", operator.describe(), t.value)
+		}
+		value := p.advance()
+		if value.kind != tokenWord && value.kind != tokenString {
+			return nil, errorf(value.pos, "unexpected %s, expected a value", value.describe())
+		}
+		return &Comparison{
+			Field:    t.value,
+			Operator: operator.value,
+			Value:    value.value,
+			Quoted:   value.kind == tokenString,
+			pos:      t.pos,
+			valuePos: value.pos,
+		}, nil
+	default:
+		return nil, errorf(t.pos, "unexpected %s, expected a field or \"(\"", t.describe())
+	}
+}
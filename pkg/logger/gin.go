@@ -1,27 +1,55 @@
 package logger
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// ContextKeyUser is the key of the user of the request in the gin context, e.g. the subject of the authenticated client
+const ContextKeyUser = "username"
+
+// ContextKeyRequestID is the key of the ID of the request in the gin context
+const ContextKeyRequestID = "request_id"
+
+// RequestIDHeader carries the ID of the request, it is kept if the client or a proxy sends a valid one
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern is the format of the request IDs accepted from the clients, e.g. UUIDs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func GinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
-		// Check the logged-in user
-		username, loggedIn := c.Get("username")
-		if loggedIn {
-			username = username.(string)
-		} else {
-			username = "_"
+		// Identify the request, the ID is sent back so the clients can refer to it
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
 		}
+		c.Set(ContextKeyRequestID, requestID)
+		c.Header(RequestIDHeader, requestID)
 
 		// Process the request
 		c.Next()
 
+		// Check the logged-in user, it is set while processing the request
+		username, loggedIn := c.Get(ContextKeyUser)
+		if !loggedIn {
+			username = "_"
+		}
+
 		// Log the request
 		log.l.WithFields(logrus.Fields{
 			"method":     c.Request.Method,
@@ -30,6 +58,7 @@ func GinMiddleware() gin.HandlerFunc {
 			"latency":    time.Since(start).String(),
 			"clientIP":   c.ClientIP(),
 			"user":       username,
+			"requestID":  requestID,
 		}).Info("Request handled")
 	}
 }
@@ -0,0 +1,79 @@
+// Package ratelimit limits the rate of requests of each client.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter limits the rate of the events of each key
+type Limiter interface {
+	// Allow reports whether an event of the key can happen now, otherwise retryAfter is the duration to wait
+	Allow(key string) (allowed bool, retryAfter time.Duration)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket is an in-memory Limiter with a token bucket for each key.
+// Each bucket holds at most burst tokens and is refilled by rate tokens per second.
+type TokenBucket struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (tb *TokenBucket) Allow(key string) (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	tb.sweep(now)
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if tb.rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+
+	return false, time.Duration((1 - b.tokens) / tb.rate * float64(time.Second))
+}
+
+// sweep removes the buckets which are full again, as they are the same as new ones, the lock should be held
+func (tb *TokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.lastSweep) < time.Minute {
+		return
+	}
+	tb.lastSweep = now
+
+	for key, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst {
+			delete(tb.buckets, key)
+		}
+	}
+}
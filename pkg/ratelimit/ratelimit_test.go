@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewTokenBucket(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is allowed at once
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("client")
+		assert.True(t, allowed, "request %d should be allowed", i)
+	}
+	allowed, retryAfter := limiter.Allow("client")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// Other keys have their own buckets
+	allowed, _ = limiter.Allow("other")
+	assert.True(t, allowed)
+
+	// The bucket is refilled by the rate
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.Allow("client")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("client")
+	assert.False(t, allowed)
+
+	// Full buckets are removed
+	now = now.Add(time.Hour)
+	limiter.Allow("client")
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -0,0 +1,110 @@
+// Package tlsutil serves TLS with certificates reloaded when their files change.
+package tlsutil
+
+import (
+	"argus/pkg/logger"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader provides the certificate of a TLS server and reloads it when its files are modified. The files are
+// checked on the handshakes, at most once per interval.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads the certificate and its private key from the PEM files
+func NewCertReloader(certFile string, keyFile string, interval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		now:      time.Now,
+	}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the certificate: %w", err)
+	}
+	r.cert, r.modTime, r.checkedAt = &cert, modTime, r.now()
+
+	return r, nil
+}
+
+// GetCertificate can be used as the GetCertificate of tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checkedAt) < r.interval {
+		return r.cert, nil
+	}
+	r.checkedAt = now
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logger.WithError(err).Warn("cannot check the certificate files, the loaded certificate is used")
+		return r.cert, nil
+	}
+	if !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	// The files may be written one after the other, a mismatching pair is retried on the next check
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		logger.WithError(err).Warn("cannot reload the certificate, the loaded certificate is used")
+		return r.cert, nil
+	}
+	r.cert, r.modTime = &cert, modTime
+	logger.WithField("cert_file", r.certFile).Info("the certificate is reloaded")
+
+	return r.cert, nil
+}
+
+// latestModTime returns the last modification time of the certificate and key files
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCertPool loads the PEM certificates of the file, e.g. a CA bundle
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("the file has no PEM certificate")
+	}
+	return pool, nil
+}
@@ -0,0 +1,114 @@
+package tlsutil
+
+import (
+	"argus/pkg/logger"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Setup the logger
+	logger.SetupLogger(logrus.New())
+
+	m.Run()
+}
+
+// writeCert writes a self-signed certificate of the common name and its key to the files
+func writeCert(t *testing.T, commonName string, certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+// commonName returns the common name of the certificate
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, "first", certFile, keyFile)
+
+	reloader, err := NewCertReloader(certFile, keyFile, time.Minute)
+	assert.NoError(t, err)
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	cert, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert))
+
+	// The files are not checked before the interval
+	writeCert(t, "second", certFile, keyFile)
+	modTime := now.Add(time.Second)
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert))
+
+	now = now.Add(time.Minute)
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", commonName(t, cert))
+
+	// A certificate not matching its key is not loaded
+	otherDir := t.TempDir()
+	writeCert(t, "third", filepath.Join(otherDir, "tls.crt"), keyFile)
+	modTime = modTime.Add(time.Second)
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	now = now.Add(time.Minute)
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", commonName(t, cert))
+
+	// The certificate should be valid at the start
+	_, err = NewCertReloader(filepath.Join(otherDir, "tls.crt"), filepath.Join(dir, "missing.key"), time.Minute)
+	assert.Error(t, err)
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	writeCert(t, "ca", certFile, keyFile)
+
+	pool, err := LoadCertPool(certFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = LoadCertPool(keyFile)
+	assert.Error(t, err, "the file has no certificate")
+	_, err = LoadCertPool(filepath.Join(dir, "missing.crt"))
+	assert.Error(t, err)
+}
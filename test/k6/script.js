@@ -10,6 +10,9 @@ export const options = {
     ],
 };
 
+// The key of the load test, the default bootstrap key is refused in production mode
+const apiKey = __ENV.API_KEY;
+
 function getRandomIp() {
     const segments = [];
     for (let i = 0; i < 4; i++) {
@@ -26,7 +29,7 @@ function testCreateAgent() {
     const params = {
         headers: {
             'Content-Type': 'application/json',
-            'API-Key': "test_api_key",
+            'API-Key': apiKey,
         },
     };
     const createRes = http.post(url, payload, params);
@@ -59,7 +62,7 @@ function testGetAgents() {
     const params = {
         headers: {
             'Content-Type': 'application/json',
-            'API-Key': "test_api_key",
+            'API-Key': apiKey,
         },
     };
 
@@ -77,7 +80,7 @@ export default function () {
     let res = http.get('https://argus.ghasvari.com/api/v1/health/ping', {
         headers: {
             'Content-Type': 'application/json',
-            'API-Key': "test_api_key",
+            'API-Key': apiKey,
         },
     });
     console.log(`Ping Response status: ${res.status}`);